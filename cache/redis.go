@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/metrics"
 
 	"github.com/yeahyf/go_base/immut"
 )
@@ -324,6 +326,32 @@ func (p *RedisPool) CloseRedisPool() {
 	CloseAction(p)
 }
 
+// HealthCheck 使用PING检测Redis是否可用,可以注册到 server.Health
+func (p *RedisPool) HealthCheck(ctx context.Context) error {
+	c, err := p.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer CloseAction(c)
+	_, err = redis.DoContext(c, ctx, "PING")
+	return err
+}
+
+// RegisterMetrics 将连接池的统计信息注册到 reg,name 用于区分多个连接池
+func (p *RedisPool) RegisterMetrics(reg *metrics.Registry, name string) {
+	metrics.RegisterPool(reg, "redis", name, func() metrics.PoolStats {
+		st := p.Stats()
+		return metrics.PoolStats{
+			MaxOpen:      p.MaxActive,
+			Open:         st.ActiveCount,
+			Idle:         st.IdleCount,
+			InUse:        st.ActiveCount - st.IdleCount,
+			WaitCount:    st.WaitCount,
+			WaitDuration: st.WaitDuration,
+		}
+	})
+}
+
 func CloseAction(c io.Closer) {
 	err := c.Close()
 	if err != nil {
@@ -1,7 +1,11 @@
 package cache
 
 import (
+	"context"
+	"strings"
 	"testing"
+
+	"github.com/yeahyf/go_base/metrics"
 )
 
 var testPool *RedisPool
@@ -623,3 +627,34 @@ func BenchmarkMGetValue(b *testing.B) {
 		}
 	}
 }
+
+// TestRegisterMetrics 测试注册连接池的统计信息
+func TestRegisterMetrics(t *testing.T) {
+	setupTestRedis(t)
+	pool := NewRedisPool(1, 5, 30, getTestRedisAddr(), "")
+	defer pool.CloseRedisPool()
+	if err := pool.SetValue("metrics", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	reg := metrics.NewRegistry()
+	pool.RegisterMetrics(reg, "main")
+	var b strings.Builder
+	if _, err := reg.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if !strings.Contains(out, `redis_pool_max_open_connections{pool="main"} 5`) ||
+		!strings.Contains(out, `redis_pool_idle_connections{pool="main"} 1`) {
+		t.Fatalf("unexpected metrics\n%s", out)
+	}
+}
+
+// TestHealthCheck 测试连接池的健康检查
+func TestHealthCheck(t *testing.T) {
+	setupTestRedis(t)
+	pool := NewRedisPool(1, 5, 30, getTestRedisAddr(), "")
+	defer pool.CloseRedisPool()
+	if err := pool.HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,14 +1,22 @@
 package ept
 
 import (
-	"fmt"
+	"errors"
 	"runtime/debug"
+
+	"github.com/yeahyf/go_base/log"
+)
+
+const (
+	CodeUnknown    uint32 = 1                       //非 *Error 的错误返回给客户端的错误码
+	UnknownMessage        = "internal server error" //非 *Error 的错误返回给客户端的信息
 )
 
 // Error 自定义错误类型
 type Error struct {
 	Code    uint32 //错误代码采用1000-9999整形
-	Message string //消息的说明
+	Message string //消息的说明,会返回给客户端
+	Cause   error  //内部的错误,只用于日志,不会返回给客户端
 }
 
 func New(code uint32, message string) *Error {
@@ -18,10 +26,21 @@ func New(code uint32, message string) *Error {
 	}
 }
 
+// NewWrapper 使用 err 的信息作为 Message,内部的错误信息会返回给客户端,不希望暴露时使用 Wrap
 func NewWrapper(code uint32, err error) *Error {
 	return &Error{
 		Code:    code,
 		Message: err.Error(),
+		Cause:   err,
+	}
+}
+
+// Wrap 使用公开的 message 包装内部的错误 cause
+func Wrap(code uint32, message string, cause error) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+		Cause:   cause,
 	}
 }
 
@@ -30,14 +49,28 @@ func (err *Error) Error() string {
 	return err.Message
 }
 
+// Unwrap 返回内部的错误,用于 errors.Is/errors.As
+func (err *Error) Unwrap() error {
+	return err.Cause
+}
+
+// From 使用 errors.As 获取错误链中的 *Error
+// 不存在时返回 CodeUnknown 与 UnknownMessage,原始的错误保存在 Cause 中
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{
+		Code:    CodeUnknown,
+		Message: UnknownMessage,
+		Cause:   err,
+	}
+}
+
+// PanicHandle 恢复panic并记录日志以及堆栈,需要使用 defer 调用
 func PanicHandle() {
 	if r := recover(); r != nil {
-		//判断是否是某种类型的错误
-		err, ok := r.(error)
-		if !ok {
-			debug.PrintStack()
-		} else {
-			fmt.Println(err)
-		}
+		log.Errorf("panic: %v\n%s", r, debug.Stack())
 	}
 }
@@ -0,0 +1,264 @@
+package hbase
+
+import (
+	"context"
+	"time"
+
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+	"github.com/yeahyf/go_base/log"
+)
+
+// defaultNamespace HBase默认的命名空间
+const defaultNamespace = "default"
+
+// restoreTimeout 清空失败后重新启用表的超时时间,不受调用方 ctx 取消的影响
+const restoreTimeout = 10 * time.Second
+
+// FamilyOption 列族的可选配置
+type FamilyOption func(desc *th.TColumnFamilyDescriptor)
+
+// NewFamilyDescriptor 构建列族描述,未设置的选项使用服务端的默认值
+func NewFamilyDescriptor(name string, opts ...FamilyOption) *th.TColumnFamilyDescriptor {
+	desc := &th.TColumnFamilyDescriptor{Name: []byte(name)}
+	for _, opt := range opts {
+		opt(desc)
+	}
+	return desc
+}
+
+// WithMaxVersions 保留的最多的版本数
+func WithMaxVersions(n int32) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		desc.MaxVersions = &n
+	}
+}
+
+// WithMinVersions 数据过期后仍然保留的最少的版本数
+func WithMinVersions(n int32) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		desc.MinVersions = &n
+	}
+}
+
+// WithTTL 数据的存活时间,精度为秒
+func WithTTL(ttl time.Duration) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		seconds := int32(ttl / time.Second)
+		desc.TimeToLive = &seconds
+	}
+}
+
+// WithCompression 数据的压缩算法
+func WithCompression(compression th.TCompressionAlgorithm) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		desc.CompressionType = &compression
+	}
+}
+
+// WithBloomFilter 布隆过滤器的类型
+func WithBloomFilter(bloom th.TBloomFilterType) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		desc.BloomnFilterType = &bloom
+	}
+}
+
+// WithDataBlockEncoding 数据块的编码方式
+func WithDataBlockEncoding(encoding th.TDataBlockEncoding) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		desc.DataBlockEncoding = &encoding
+	}
+}
+
+// WithBlockSize 数据块的大小,单位字节
+func WithBlockSize(size int32) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		desc.BlockSize = &size
+	}
+}
+
+// WithInMemory 是否优先保留在内存中
+func WithInMemory(inMemory bool) FamilyOption {
+	return func(desc *th.TColumnFamilyDescriptor) {
+		desc.InMemory = &inMemory
+	}
+}
+
+// CreateTableWithDesc 按照列族描述创建表,splitKeys 为预分区的分割点,为空时不预分区
+// 如果表已经存在,返回TableExistErr
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) CreateTableWithDesc(ctx context.Context, tableName string, families []*th.TColumnFamilyDescriptor,
+	splitKeys [][]byte, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpCreateTableWithDesc, tableName, time.Now(), &err, namespace...)
+	return hb.createTable(ctx, tableName, families, splitKeys, namespace...)
+}
+
+// createTable 创建表,表已经存在时返回TableExistErr
+func (hb *ThriftHbaseConn) createTable(ctx context.Context, tableName string, families []*th.TColumnFamilyDescriptor,
+	splitKeys [][]byte, namespace ...string) error {
+	tbName := hb.buildTTableName(tableName, namespace...)
+	result, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.TableExists(ctx, tbName)
+	})
+	if err != nil {
+		return hb.handleError(ctx, err)
+	}
+	if result {
+		return TableExistErr
+	}
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.CreateTable(ctx,
+			&th.TTableDescriptor{
+				TableName: tbName,
+				Columns:   families,
+			}, splitKeys)
+	})
+	return hb.handleError(ctx, err)
+}
+
+// AddColumnFamily 为表增加列族
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) AddColumnFamily(ctx context.Context, tableName string, family *th.TColumnFamilyDescriptor,
+	namespace ...string) (err error) {
+	defer hb.observe(ctx, OpAddColumnFamily, tableName, time.Now(), &err, namespace...)
+	tbName := hb.buildTTableName(tableName, namespace...)
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.AddColumnFamily(ctx, tbName, family)
+	})
+	return hb.handleError(ctx, err)
+}
+
+// ModifyColumnFamily 修改表中已经存在的列族,未设置的选项会被重置为服务端的默认值
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) ModifyColumnFamily(ctx context.Context, tableName string, family *th.TColumnFamilyDescriptor,
+	namespace ...string) (err error) {
+	defer hb.observe(ctx, OpModifyColumnFamily, tableName, time.Now(), &err, namespace...)
+	tbName := hb.buildTTableName(tableName, namespace...)
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.ModifyColumnFamily(ctx, tbName, family)
+	})
+	return hb.handleError(ctx, err)
+}
+
+// DeleteColumnFamily 删除表中的列族,列族中的数据会一并删除
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) DeleteColumnFamily(ctx context.Context, tableName, familyName string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpDeleteColumnFamily, tableName, time.Now(), &err, namespace...)
+	tbName := hb.buildTTableName(tableName, namespace...)
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.DeleteColumnFamily(ctx, tbName, []byte(familyName))
+	})
+	return hb.handleError(ctx, err)
+}
+
+// TruncateTable 清空表中的数据,preserveSplits 为true时保留原有的分区
+// 清空之前表必须是disabled,如果表是enabled的会先停用,清空完成后服务端会重新启用该表
+// 清空失败时会尽量重新启用被停用的表,重新启用也失败时只记录日志,需要调用方调用 EnableTable 恢复
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) TruncateTable(ctx context.Context, tableName string, preserveSplits bool, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpTruncateTable, tableName, time.Now(), &err, namespace...)
+	tbName := hb.buildTTableName(tableName, namespace...)
+	//先判断表是否存在
+	exist, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.TableExists(ctx, tbName)
+	})
+	if err != nil {
+		return hb.handleError(ctx, err)
+	}
+	if !exist {
+		return TableNotExistErr
+	}
+	enabled, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.IsTableEnabled(ctx, tbName)
+	})
+	if err != nil {
+		return hb.handleError(ctx, err)
+	}
+	if enabled {
+		err = hb.retry(ctx, false, func(ctx context.Context) error {
+			return hb.ServiceClient.DisableTable(ctx, tbName)
+		})
+		if err != nil {
+			return hb.handleError(ctx, err)
+		}
+	}
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.TruncateTable(ctx, tbName, preserveSplits)
+	})
+	if err = hb.handleError(ctx, err); err != nil && enabled {
+		hb.restoreEnabled(ctx, tbName)
+	}
+	return err
+}
+
+// restoreEnabled 清空失败之后重新启用 TruncateTable 停用的表,避免表一直处于下线状态
+func (hb *ThriftHbaseConn) restoreEnabled(ctx context.Context, tbName *th.TTableName) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+	defer cancel()
+	err := hb.ServiceClient.EnableTable(ctx, tbName)
+	if err = hb.handleError(ctx, err); err != nil {
+		log.Errorf("couldn't re-enable table %s:%s after truncate failed, %v", tbName.GetNs(), tbName.GetQualifier(), err)
+	}
+}
+
+// GetTableDescriptor 获取表的描述信息,包括所有列族的配置
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) GetTableDescriptor(ctx context.Context, tableName string, namespace ...string) (_ *th.TTableDescriptor, err error) {
+	defer hb.observe(ctx, OpGetTableDescriptor, tableName, time.Now(), &err, namespace...)
+	tbName := hb.buildTTableName(tableName, namespace...)
+	desc, err := retryCall(ctx, hb, true, func(ctx context.Context) (*th.TTableDescriptor, error) {
+		return hb.ServiceClient.GetTableDescriptor(ctx, tbName)
+	})
+	if err != nil {
+		return nil, hb.handleError(ctx, err)
+	}
+	return desc, nil
+}
+
+// IsTableAvailable 判断表是否可用,即表的所有region都已经上线
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) IsTableAvailable(ctx context.Context, tableName string, namespace ...string) (_ bool, err error) {
+	defer hb.observe(ctx, OpIsTableAvailable, tableName, time.Now(), &err, namespace...)
+	tbName := hb.buildTTableName(tableName, namespace...)
+	available, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.IsTableAvailable(ctx, tbName)
+	})
+	if err != nil {
+		return false, hb.handleError(ctx, err)
+	}
+	return available, nil
+}
+
+// ListTableByPattern 按照正则表达式列出所有命名空间中匹配的表,返回的表名格式为 namespace:table
+// includeSysTables 为true时包含系统表
+func (hb *ThriftHbaseConn) ListTableByPattern(ctx context.Context, regex string, includeSysTables bool) (_ []string, err error) {
+	defer hb.observe(ctx, OpListTableByPattern, "", time.Now(), &err)
+	list, err := retryCall(ctx, hb, true, func(ctx context.Context) ([]*th.TTableName, error) {
+		return hb.ServiceClient.GetTableNamesByPattern(ctx, regex, includeSysTables)
+	})
+	if err != nil {
+		return nil, hb.handleError(ctx, err)
+	}
+	tList := make([]string, 0, len(list))
+	for _, v := range list {
+		ns := string(v.Ns)
+		if ns == "" {
+			ns = defaultNamespace
+		}
+		tList = append(tList, ns+":"+string(v.Qualifier))
+	}
+	return tList, nil
+}
+
+// GetRegionLocations 获取表所有region的位置信息
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) GetRegionLocations(ctx context.Context, tableName string, namespace ...string) (_ []*th.THRegionLocation, err error) {
+	defer hb.observe(ctx, OpGetRegionLocations, tableName, time.Now(), &err, namespace...)
+	tbName := hb.buildTableName(tableName, namespace...)
+	locations, err := retryCall(ctx, hb, true, func(ctx context.Context) ([]*th.THRegionLocation, error) {
+		return hb.ServiceClient.GetAllRegionLocations(ctx, tbName)
+	})
+	if err != nil {
+		return nil, hb.handleError(ctx, err)
+	}
+	return locations, nil
+}
@@ -0,0 +1,171 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+// adminHandler 记录管理接口收到的参数
+type adminHandler struct {
+	th.THBaseService
+
+	created   *th.TTableDescriptor
+	splitKeys [][]byte
+	truncated bool
+	enabled   bool
+	failTrunc bool
+	calls     []string
+}
+
+func (h *adminHandler) TableExists(ctx context.Context, tableName *th.TTableName) (bool, error) {
+	return h.created != nil, nil
+}
+
+func (h *adminHandler) CreateTable(ctx context.Context, desc *th.TTableDescriptor, splitKeys [][]byte) error {
+	h.created, h.splitKeys, h.enabled = desc, splitKeys, true
+	return nil
+}
+
+func (h *adminHandler) IsTableEnabled(ctx context.Context, tableName *th.TTableName) (bool, error) {
+	return h.enabled, nil
+}
+
+func (h *adminHandler) DisableTable(ctx context.Context, tableName *th.TTableName) error {
+	h.calls = append(h.calls, "disable")
+	h.enabled = false
+	return nil
+}
+
+func (h *adminHandler) EnableTable(ctx context.Context, tableName *th.TTableName) error {
+	h.calls = append(h.calls, "enable")
+	h.enabled = true
+	return nil
+}
+
+func (h *adminHandler) TruncateTable(ctx context.Context, tableName *th.TTableName, preserveSplits bool) error {
+	if h.failTrunc {
+		msg := "truncate failed"
+		return &th.TIOError{Message: &msg}
+	}
+	if h.enabled {
+		msg := "table is enabled"
+		return &th.TIOError{Message: &msg}
+	}
+	h.calls = append(h.calls, "truncate")
+	h.truncated = preserveSplits
+	return nil
+}
+
+func (h *adminHandler) GetTableDescriptor(ctx context.Context, table *th.TTableName) (*th.TTableDescriptor, error) {
+	if h.created == nil {
+		msg := "TableNotFoundException"
+		return nil, &th.TIOError{Message: &msg}
+	}
+	return h.created, nil
+}
+
+func (h *adminHandler) GetTableNamesByPattern(ctx context.Context, regex string, includeSysTables bool) ([]*th.TTableName, error) {
+	return []*th.TTableName{
+		{Ns: []byte(SpaceName), Qualifier: []byte("t1")},
+		{Qualifier: []byte("t2")},
+	}, nil
+}
+
+func (h *adminHandler) GetAllRegionLocations(ctx context.Context, table []byte) ([]*th.THRegionLocation, error) {
+	return []*th.THRegionLocation{{
+		ServerName: &th.TServerName{HostName: "rs1"},
+		RegionInfo: &th.THRegionInfo{TableName: table, StartKey: []byte("a")},
+	}}, nil
+}
+
+func TestAdmin(t *testing.T) {
+	h := &adminHandler{}
+	var requests atomic.Int32
+	srv := newThriftServer(h, 0, &requests)
+	defer srv.Close()
+	c := newRetryConn(t, srv.URL, nil, nil)
+	ctx := context.Background()
+
+	families := []*th.TColumnFamilyDescriptor{
+		NewFamilyDescriptor("a", WithMaxVersions(3), WithTTL(24*time.Hour),
+			WithCompression(th.TCompressionAlgorithm_SNAPPY), WithBloomFilter(th.TBloomFilterType_ROW)),
+		NewFamilyDescriptor("e"),
+	}
+	splits := [][]byte{[]byte("1"), []byte("2")}
+	if err := c.CreateTableWithDesc(ctx, "user", families, splits); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateTableWithDesc(ctx, "user", families, splits); !errors.Is(err, TableExistErr) {
+		t.Fatalf("expect TableExistErr, got %v", err)
+	}
+	if len(h.splitKeys) != 2 || string(h.created.TableName.Ns) != SpaceName {
+		t.Fatalf("unexpected create request %+v", h.created)
+	}
+
+	desc, err := c.GetTableDescriptor(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := desc.Columns[0]
+	if a.GetMaxVersions() != 3 || a.GetTimeToLive() != 86400 ||
+		a.GetCompressionType() != th.TCompressionAlgorithm_SNAPPY || a.GetBloomnFilterType() != th.TBloomFilterType_ROW {
+		t.Fatalf("unexpected family descriptor %+v", a)
+	}
+
+	if err = c.TruncateTable(ctx, "user", true); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.calls) != 2 || h.calls[0] != "disable" || !h.truncated {
+		t.Fatalf("truncate should disable the table first, calls=%v", h.calls)
+	}
+
+	//清空失败时重新启用表
+	h.enabled, h.failTrunc, h.calls = true, true, nil
+	if err = c.TruncateTable(ctx, "user", true); err == nil {
+		t.Fatal("expect truncate error")
+	}
+	if !h.enabled || len(h.calls) != 2 || h.calls[1] != "enable" {
+		t.Fatalf("table should be re-enabled after failed truncate, calls=%v", h.calls)
+	}
+	h.failTrunc = false
+
+	tables, err := c.ListTableByPattern(ctx, "t.*", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 || tables[0] != SpaceName+":t1" || tables[1] != "default:t2" {
+		t.Fatalf("unexpected tables %v", tables)
+	}
+
+	locations, err := c.GetRegionLocations(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || string(locations[0].RegionInfo.TableName) != SpaceName+":user" {
+		t.Fatalf("unexpected locations %+v", locations)
+	}
+}
+
+func TestAdminServerError(t *testing.T) {
+	var requests atomic.Int32
+	srv := newThriftServer(&adminHandler{}, 0, &requests)
+	defer srv.Close()
+	c := newRetryConn(t, srv.URL, nil, nil)
+
+	_, err := c.GetTableDescriptor(context.Background(), "none")
+	var ioErr *th.TIOError
+	if err == nil || err.Error() != "TableNotFoundException" || !errors.As(err, &ioErr) {
+		t.Fatalf("expect server error, got %v", err)
+	}
+	if c.IsBroken() {
+		t.Fatal("server error should not break the connection")
+	}
+	if err = c.TruncateTable(context.Background(), "none", false); !errors.Is(err, TableNotExistErr) {
+		t.Fatalf("expect TableNotExistErr, got %v", err)
+	}
+}
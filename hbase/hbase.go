@@ -3,6 +3,7 @@ package hbase
 import (
 	"context"
 	"errors"
+	"net/http"
 	"time"
 
 	th "github.com/yeahyf/go_base/hbase/t2hbase"
@@ -20,18 +21,42 @@ var (
 	RowNotFoundErr   = errors.New("row not found")
 )
 
-// convertError 将TIOError 转为 普通error
+// convertError 将TIOError、TIllegalArgument 转为 普通error
+// 错误信息只保留服务端返回的消息,原始错误仍然可以通过 errors.As 获取
 func convertError(err error) error {
 	if err == nil {
 		return nil
 	}
+	//保留重试的次数,只转换最后一次的原始错误
+	var attemptsErr *attemptsError
+	if errors.As(err, &attemptsErr) {
+		return &attemptsError{attempts: attemptsErr.attempts, err: convertError(attemptsErr.err)}
+	}
 	var tio *th.TIOError
 	if errors.As(err, &tio) {
-		return errors.New(*tio.Message)
+		return &serverError{msg: tio.GetMessage(), err: err}
+	}
+	var illegal *th.TIllegalArgument
+	if errors.As(err, &illegal) {
+		return &serverError{msg: illegal.GetMessage(), err: err}
 	}
 	return err
 }
 
+// serverError 服务端返回的异常
+type serverError struct {
+	msg string
+	err error
+}
+
+func (e *serverError) Error() string {
+	return e.msg
+}
+
+func (e *serverError) Unwrap() error {
+	return e.err
+}
+
 // getNamespace 获取命名空间，支持可选的命名空间参数
 // 如果 namespace 为空，使用默认的 SpaceName
 func (hb *ThriftHbaseConn) getNamespace(namespace ...string) string {
@@ -63,58 +88,62 @@ func (hb *ThriftHbaseConn) buildTTableName(tableName string, namespace ...string
 // CreateNameSpace 创建命名空间
 // 如果是已经创建过,返回NSExistErr,如果命名空间不存在则创建
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) CreateNameSpace(namespace ...string) error {
+func (hb *ThriftHbaseConn) CreateNameSpace(ctx context.Context, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpCreateNameSpace, "", time.Now(), &err, namespace...)
 	ns := hb.getNamespace(namespace...)
-	descriptor, err := hb.ServiceClient.GetNamespaceDescriptor(context.Background(), ns)
-	if err != nil {
-		// 查询出错，可能是命名空间不存在，尝试创建
-		createErr := hb.ServiceClient.CreateNamespace(context.Background(),
+	_, err = hb.namespaceDescriptor(ctx, ns)
+	if err == nil {
+		//说明该命名空间已经存在过了
+		return NSExistErr
+	}
+	if !errors.Is(err, NSNotExistErr) {
+		return err
+	}
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.CreateNamespace(ctx,
 			&th.TNamespaceDescriptor{Name: ns})
-		if createErr != nil {
-			// 创建失败，返回原始查询错误（可能包含更多信息）
-			return convertError(err)
+	})
+	//并发创建时,检查之后可能已经被其他调用方创建
+	if isServerError(err) {
+		if exist, e := hb.existNamespace(ctx, ns); e == nil && exist {
+			return NSExistErr
 		}
-		return convertError(createErr)
-	}
-	//说明该命名空间已经存在过了
-	if descriptor != nil {
-		return NSExistErr
 	}
-	// descriptor 为 nil 且 err 为 nil，说明命名空间不存在，创建它
-	err = hb.ServiceClient.CreateNamespace(context.Background(),
-		&th.TNamespaceDescriptor{Name: ns})
-	return convertError(err)
+	return hb.handleError(ctx, err)
 }
 
-// DeleteNameSpace 删除命名空间
+// DeleteNameSpace 删除命名空间,不存在时返回NSNotExistErr
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) DeleteNameSpace(namespace ...string) error {
+func (hb *ThriftHbaseConn) DeleteNameSpace(ctx context.Context, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpDeleteNameSpace, "", time.Now(), &err, namespace...)
 	ns := hb.getNamespace(namespace...)
-	descriptor, err := hb.ServiceClient.GetNamespaceDescriptor(context.Background(), ns)
-	if err != nil {
-		return convertError(err)
-	}
-	if descriptor == nil {
-		return NSNotExistErr
+	if _, err = hb.namespaceDescriptor(ctx, ns); err != nil {
+		return err
 	}
 	// 直接删除,注意删除需要所有的表都被删除掉才可以删掉命名空间
-	err = hb.ServiceClient.DeleteNamespace(context.Background(), ns)
-	return convertError(err)
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.DeleteNamespace(ctx, ns)
+	})
+	return hb.handleError(ctx, err)
 }
 
 // CreateTable 创建表,不带版本,只存储最新的数据
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) CreateTable(tableName string, familyNames []string, namespace ...string) error {
-	return hb.CreateTableWithVer(tableName, familyNames, 0, namespace...)
+func (hb *ThriftHbaseConn) CreateTable(ctx context.Context, tableName string, familyNames []string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpCreateTable, tableName, time.Now(), &err, namespace...)
+	return hb.createTable(ctx, tableName, familyDescriptors(familyNames, 0), nil, namespace...)
 }
 
 // ExistTable 判断表是否存在
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) ExistTable(tableName string, namespace ...string) (bool, error) {
+func (hb *ThriftHbaseConn) ExistTable(ctx context.Context, tableName string, namespace ...string) (_ bool, err error) {
+	defer hb.observe(ctx, OpExistTable, tableName, time.Now(), &err, namespace...)
 	tbName := hb.buildTTableName(tableName, namespace...)
-	result, err := hb.ServiceClient.TableExists(context.Background(), tbName)
+	result, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.TableExists(ctx, tbName)
+	})
 	if err != nil {
-		return false, convertError(err)
+		return false, hb.handleError(ctx, err)
 	}
 	return result, nil
 }
@@ -122,57 +151,50 @@ func (hb *ThriftHbaseConn) ExistTable(tableName string, namespace ...string) (bo
 // CreateTableWithVer 创建表，增加历史版本，一般情况下是不需要直接调用该接口的
 // maxVersion 可以保留的最多的版本数，每次修改都会生成一个新的版本，并且必须是全部所有字段统一更新
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) CreateTableWithVer(tableName string, familyNames []string, maxVersion int32, namespace ...string) error {
-	tbName := hb.buildTTableName(tableName, namespace...)
-	result, err := hb.ServiceClient.TableExists(context.Background(), tbName)
-	if err != nil {
-		return convertError(err)
-	}
-	if result {
-		return TableExistErr
-	}
+func (hb *ThriftHbaseConn) CreateTableWithVer(ctx context.Context, tableName string, familyNames []string, maxVersion int32, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpCreateTableWithVer, tableName, time.Now(), &err, namespace...)
+	return hb.createTable(ctx, tableName, familyDescriptors(familyNames, maxVersion), nil, namespace...)
+}
+
+// familyDescriptors 按照列族名称创建列族描述,maxVersion 大于0时保留历史版本
+func familyDescriptors(familyNames []string, maxVersion int32) []*th.TColumnFamilyDescriptor {
 	columnFamilyDescriptor := make([]*th.TColumnFamilyDescriptor, 0, len(familyNames))
 	for _, v := range familyNames {
 		if maxVersion > 0 {
-			columnFamilyDescriptor = append(columnFamilyDescriptor,
-				&th.TColumnFamilyDescriptor{
-					Name:        []byte(v),
-					MaxVersions: &maxVersion,
-					//MinVersions: &minVersion,
-				})
+			columnFamilyDescriptor = append(columnFamilyDescriptor, NewFamilyDescriptor(v, WithMaxVersions(maxVersion)))
 		} else {
-			columnFamilyDescriptor = append(columnFamilyDescriptor,
-				&th.TColumnFamilyDescriptor{
-					Name: []byte(v),
-				})
+			columnFamilyDescriptor = append(columnFamilyDescriptor, NewFamilyDescriptor(v))
 		}
 	}
-	err = hb.ServiceClient.CreateTable(context.Background(),
-		&th.TTableDescriptor{
-			TableName: tbName,
-			Columns:   columnFamilyDescriptor,
-		}, nil)
-	return convertError(err)
+	return columnFamilyDescriptor
 }
 
 // DisableTable 停用表
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) DisableTable(tableName string, namespace ...string) error {
+func (hb *ThriftHbaseConn) DisableTable(ctx context.Context, tableName string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpDisableTable, tableName, time.Now(), &err, namespace...)
 	tbName := hb.buildTTableName(tableName, namespace...)
 	//先判断表是否存在
-	exist, err := hb.ServiceClient.TableExists(context.Background(), tbName)
+	exist, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.TableExists(ctx, tbName)
+	})
 	if err != nil {
-		return convertError(err)
+		return hb.handleError(ctx, err)
 	}
 	if !exist {
 		return TableNotExistErr
 	}
-	enabled, err := hb.ServiceClient.IsTableEnabled(context.Background(), tbName)
+	enabled, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.IsTableEnabled(ctx, tbName)
+	})
 	if err != nil {
-		return convertError(err)
+		return hb.handleError(ctx, err)
 	}
 	if enabled {
-		return hb.ServiceClient.DisableTable(context.Background(), tbName)
+		err = hb.retry(ctx, false, func(ctx context.Context) error {
+			return hb.ServiceClient.DisableTable(ctx, tbName)
+		})
+		return hb.handleError(ctx, err)
 	}
 	// 表已经是 disabled 状态，直接返回成功
 	return nil
@@ -180,22 +202,30 @@ func (hb *ThriftHbaseConn) DisableTable(tableName string, namespace ...string) e
 
 // EnableTable 启用表
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) EnableTable(tableName string, namespace ...string) error {
+func (hb *ThriftHbaseConn) EnableTable(ctx context.Context, tableName string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpEnableTable, tableName, time.Now(), &err, namespace...)
 	tbName := hb.buildTTableName(tableName, namespace...)
 	//先判断表是否存在
-	exist, err := hb.ServiceClient.TableExists(context.Background(), tbName)
+	exist, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.TableExists(ctx, tbName)
+	})
 	if err != nil {
-		return convertError(err)
+		return hb.handleError(ctx, err)
 	}
 	if !exist {
 		return TableNotExistErr
 	}
-	disabled, err := hb.ServiceClient.IsTableDisabled(context.Background(), tbName)
+	disabled, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.IsTableDisabled(ctx, tbName)
+	})
 	if err != nil {
-		return convertError(err)
+		return hb.handleError(ctx, err)
 	}
 	if disabled {
-		return hb.ServiceClient.EnableTable(context.Background(), tbName)
+		err = hb.retry(ctx, false, func(ctx context.Context) error {
+			return hb.ServiceClient.EnableTable(ctx, tbName)
+		})
+		return hb.handleError(ctx, err)
 	}
 	// 表已经是 enabled 状态，直接返回成功
 	return nil
@@ -203,25 +233,33 @@ func (hb *ThriftHbaseConn) EnableTable(tableName string, namespace ...string) er
 
 // DeleteTable 删除表 必须要具备的条件，1. 表存在，2 表是disabled
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) DeleteTable(tableName string, namespace ...string) error {
+func (hb *ThriftHbaseConn) DeleteTable(ctx context.Context, tableName string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpDeleteTable, tableName, time.Now(), &err, namespace...)
 	tbName := hb.buildTTableName(tableName, namespace...)
 	//先判断表是否存在
-	exist, err := hb.ServiceClient.TableExists(context.Background(), tbName)
+	exist, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.TableExists(ctx, tbName)
+	})
 	if err != nil {
-		return convertError(err)
+		return hb.handleError(ctx, err)
 	}
 	if !exist {
 		//表不存在
 		return TableNotExistErr
 	}
 	//存在,删除
-	disabled, err := hb.ServiceClient.IsTableDisabled(context.Background(), tbName)
+	disabled, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.IsTableDisabled(ctx, tbName)
+	})
 	if err != nil {
-		return convertError(err)
+		return hb.handleError(ctx, err)
 	}
 	// 表不是enable的,才能够删除
 	if disabled {
-		return hb.ServiceClient.DeleteTable(context.Background(), tbName)
+		err = hb.retry(ctx, false, func(ctx context.Context) error {
+			return hb.ServiceClient.DeleteTable(ctx, tbName)
+		})
+		return hb.handleError(ctx, err)
 	}
 	// 表是enable的,不能删除
 	return TableEnabledErr
@@ -229,11 +267,14 @@ func (hb *ThriftHbaseConn) DeleteTable(tableName string, namespace ...string) er
 
 // ListAllTable 列出空间中所有的表名
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) ListAllTable(namespace ...string) ([]string, error) {
+func (hb *ThriftHbaseConn) ListAllTable(ctx context.Context, namespace ...string) (_ []string, err error) {
+	defer hb.observe(ctx, OpListAllTable, "", time.Now(), &err, namespace...)
 	ns := hb.getNamespace(namespace...)
-	list, err := hb.ServiceClient.GetTableNamesByNamespace(context.Background(), ns)
+	list, err := retryCall(ctx, hb, true, func(ctx context.Context) ([]*th.TTableName, error) {
+		return hb.ServiceClient.GetTableNamesByNamespace(ctx, ns)
+	})
 	if err != nil {
-		return nil, convertError(err)
+		return nil, hb.handleError(ctx, err)
 	}
 	tList := make([]string, 0, len(list))
 	for _, v := range list {
@@ -244,7 +285,8 @@ func (hb *ThriftHbaseConn) ListAllTable(namespace ...string) ([]string, error) {
 
 // UpdateRow 更新row
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) UpdateRow(tableName, rowKey string, values map[string]map[string][]byte, namespace ...string) error {
+func (hb *ThriftHbaseConn) UpdateRow(ctx context.Context, tableName, rowKey string, values map[string]map[string][]byte, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpUpdateRow, tableName, time.Now(), &err, namespace...)
 	//做DML操作时，表名参数为bytes，表名的规则是namespace + 冒号 + 表名  []byte("ass:tableName")
 	//先计算需要更新的Column的数量
 	number := 0
@@ -264,13 +306,16 @@ func (hb *ThriftHbaseConn) UpdateRow(tableName, rowKey string, values map[string
 	}
 	//此处需要注意，需要增加NameSpace前缀
 	tbName := hb.buildTableName(tableName, namespace...)
-	err := hb.ServiceClient.Put(context.Background(), tbName, tPut)
-	return convertError(err)
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.Put(ctx, tbName, tPut)
+	})
+	return hb.handleError(ctx, err)
 }
 
 // FetchRow 获取一条Row
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) FetchRow(tableName, rowKey string, columnKeys map[string][]string, namespace ...string) (map[string][]byte, error) {
+func (hb *ThriftHbaseConn) FetchRow(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, namespace ...string) (_ map[string][]byte, err error) {
+	defer hb.observe(ctx, OpFetchRow, tableName, time.Now(), &err, namespace...)
 	//做DML操作时，表名参数为bytes，表名的规则是namespace + 冒号 + 表名
 	var tGet *th.TGet
 	//根据参数获取不同的数据
@@ -297,9 +342,11 @@ func (hb *ThriftHbaseConn) FetchRow(tableName, rowKey string, columnKeys map[str
 	}
 	//此处需要注意，需要增加NameSpace前缀
 	tbName := hb.buildTableName(tableName, namespace...)
-	result, err := hb.ServiceClient.Get(context.Background(), tbName, tGet)
+	result, err := retryCall(ctx, hb, true, func(ctx context.Context) (*th.TResult_, error) {
+		return hb.ServiceClient.Get(ctx, tbName, tGet)
+	})
 	if err != nil {
-		return nil, convertError(err)
+		return nil, hb.handleError(ctx, err)
 	}
 	m := make(map[string][]byte, len(result.ColumnValues))
 	for _, v := range result.ColumnValues {
@@ -310,7 +357,8 @@ func (hb *ThriftHbaseConn) FetchRow(tableName, rowKey string, columnKeys map[str
 
 // FetchRowByVer 按照版本获取一条Row,最新的版本号最小,从1开始（在创建表的时候需要设置版本信息）
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) FetchRowByVer(tableName, rowKey string, columnKeys map[string][]string, maxVer int32, namespace ...string) (map[string][]byte, error) {
+func (hb *ThriftHbaseConn) FetchRowByVer(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, maxVer int32, namespace ...string) (_ map[string][]byte, err error) {
+	defer hb.observe(ctx, OpFetchRowByVer, tableName, time.Now(), &err, namespace...)
 	//做DML操作时，表名参数为bytes，表名的规则是namespace + 冒号 + 表名
 	number := 0
 	for _, v := range columnKeys {
@@ -339,9 +387,11 @@ func (hb *ThriftHbaseConn) FetchRowByVer(tableName, rowKey string, columnKeys ma
 	}
 	//此处需要注意，需要增加NameSpace前缀
 	tbName := hb.buildTableName(tableName, namespace...)
-	result, err := hb.ServiceClient.Get(context.Background(), tbName, tGet)
+	result, err := retryCall(ctx, hb, true, func(ctx context.Context) (*th.TResult_, error) {
+		return hb.ServiceClient.Get(ctx, tbName, tGet)
+	})
 	if err != nil {
-		return nil, convertError(err)
+		return nil, hb.handleError(ctx, err)
 	}
 	m := make(map[string][]byte, len(result.ColumnValues))
 	for _, v := range result.ColumnValues {
@@ -352,11 +402,19 @@ func (hb *ThriftHbaseConn) FetchRowByVer(tableName, rowKey string, columnKeys ma
 
 // ExistRow 判断某行数据是否存在
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) ExistRow(tableName string, rowKey string, namespace ...string) (bool, error) {
+func (hb *ThriftHbaseConn) ExistRow(ctx context.Context, tableName string, rowKey string, namespace ...string) (_ bool, err error) {
+	defer hb.observe(ctx, OpExistRow, tableName, time.Now(), &err, namespace...)
+	return hb.existRow(ctx, tableName, rowKey, namespace...)
+}
+
+// existRow 判断行是否存在,不触发 OpHooks,供删除等操作内部使用
+func (hb *ThriftHbaseConn) existRow(ctx context.Context, tableName string, rowKey string, namespace ...string) (bool, error) {
 	tbName := hb.buildTTableName(tableName, namespace...)
-	exist, err := hb.ServiceClient.TableExists(context.Background(), tbName)
+	exist, err := retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.TableExists(ctx, tbName)
+	})
 	if err != nil {
-		return false, convertError(err)
+		return false, hb.handleError(ctx, err)
 	}
 	if !exist {
 		return false, TableNotExistErr
@@ -365,17 +423,25 @@ func (hb *ThriftHbaseConn) ExistRow(tableName string, rowKey string, namespace .
 		Row: []byte(rowKey),
 	}
 	tbNameBytes := hb.buildTableName(tableName, namespace...)
-	exist, err = hb.ServiceClient.Exists(context.Background(), tbNameBytes, tGet)
-	return exist, convertError(err)
+	exist, err = retryCall(ctx, hb, true, func(ctx context.Context) (bool, error) {
+		return hb.ServiceClient.Exists(ctx, tbNameBytes, tGet)
+	})
+	return exist, hb.handleError(ctx, err)
 }
 
 // DeleteRow 删除某行数据
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) DeleteRow(tableName, rowKey string, namespace ...string) error {
+func (hb *ThriftHbaseConn) DeleteRow(ctx context.Context, tableName, rowKey string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpDeleteRow, tableName, time.Now(), &err, namespace...)
+	return hb.deleteRow(ctx, tableName, rowKey, namespace...)
+}
+
+// deleteRow 删除某行数据,不触发 OpHooks
+func (hb *ThriftHbaseConn) deleteRow(ctx context.Context, tableName, rowKey string, namespace ...string) error {
 	//先判断是否存在再删除
-	exist, err := hb.ExistRow(tableName, rowKey, namespace...)
+	exist, err := hb.existRow(ctx, tableName, rowKey, namespace...)
 	if err != nil {
-		return convertError(err)
+		return err
 	}
 	//要删除的row不存在
 	if !exist {
@@ -387,21 +453,24 @@ func (hb *ThriftHbaseConn) DeleteRow(tableName, rowKey string, namespace ...stri
 	}
 	//此处需要注意，需要增加NameSpace前缀
 	tbName := hb.buildTableName(tableName, namespace...)
-	err = hb.ServiceClient.DeleteSingle(context.Background(), tbName, tDelete)
-	return convertError(err)
+	err = hb.retry(ctx, true, func(ctx context.Context) error {
+		return hb.ServiceClient.DeleteSingle(ctx, tbName, tDelete)
+	})
+	return hb.handleError(ctx, err)
 }
 
 // DeleteColumns 删除某些列
 // namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
-func (hb *ThriftHbaseConn) DeleteColumns(tableName, rowKey string, columnKeys map[string][]string, namespace ...string) error {
+func (hb *ThriftHbaseConn) DeleteColumns(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpDeleteColumns, tableName, time.Now(), &err, namespace...)
 	//如果columnKeys位空,则删除所有,直接使用DeleteRow代替
 	if columnKeys == nil {
-		return hb.DeleteRow(tableName, rowKey, namespace...)
+		return hb.deleteRow(ctx, tableName, rowKey, namespace...)
 	}
 	//先判断是否存在再删除
-	exist, err := hb.ExistRow(tableName, rowKey, namespace...)
+	exist, err := hb.existRow(ctx, tableName, rowKey, namespace...)
 	if err != nil {
-		return convertError(err)
+		return err
 	}
 	//要删除的row不存在
 	if !exist {
@@ -429,77 +498,208 @@ func (hb *ThriftHbaseConn) DeleteColumns(tableName, rowKey string, columnKeys ma
 	}
 	//此处需要注意，需要增加NameSpace前缀
 	tbName := hb.buildTableName(tableName, namespace...)
-	err = hb.ServiceClient.DeleteSingle(context.Background(), tbName, tDelete)
+	err = hb.retry(ctx, true, func(ctx context.Context) error {
+		return hb.ServiceClient.DeleteSingle(ctx, tbName, tDelete)
+	})
+	return hb.handleError(ctx, err)
+}
+
+// scanBatchSize 扫描时每次请求返回的最多行数
+const scanBatchSize = 1000
+
+// Row 扫描返回的一行数据
+type Row struct {
+	RowKey string                       //行键
+	Values map[string]map[string][]byte //列族 -> 列名 -> 最新版本的值
+}
+
+// ScanRows 扫描[startRow, stopRow)范围内的行,按照行键的字典序返回
+// startRow 为空时从表头开始,stopRow 为空时扫描到表尾,limit 小于等于0时不限制返回的行数
+// columnKeys 为空时返回所有列,某个列族对应的列名为空时返回该列族的所有列
+// 每次请求最多返回 scanBatchSize 行,下一次请求从上一批的最后一行之后继续,因此每次请求都可以独立重试
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) ScanRows(ctx context.Context, tableName, startRow, stopRow string, columnKeys map[string][]string,
+	limit int, namespace ...string) (_ []*Row, err error) {
+	defer hb.observe(ctx, OpScanRows, tableName, time.Now(), &err, namespace...)
+	var tColumns []*th.TColumn
+	for k, v := range columnKeys {
+		if len(v) == 0 {
+			tColumns = append(tColumns, &th.TColumn{Family: []byte(k)})
+			continue
+		}
+		for _, c := range v {
+			tColumns = append(tColumns, &th.TColumn{Family: []byte(k), Qualifier: []byte(c)})
+		}
+	}
+	tScan := &th.TScan{Columns: tColumns}
+	if startRow != "" {
+		tScan.StartRow = []byte(startRow)
+	}
+	if stopRow != "" {
+		tScan.StopRow = []byte(stopRow)
+	}
+	//此处需要注意，需要增加NameSpace前缀
+	tbName := hb.buildTableName(tableName, namespace...)
+	var rows []*Row
+	for {
+		batch := scanBatchSize
+		if limit > 0 {
+			batch = min(batch, limit-len(rows))
+		}
+		results, err := retryCall(ctx, hb, true, func(ctx context.Context) ([]*th.TResult_, error) {
+			return hb.ServiceClient.GetScannerResults(ctx, tbName, tScan, int32(batch))
+		})
+		if err != nil {
+			return nil, hb.handleError(ctx, err)
+		}
+		for _, result := range results {
+			rows = append(rows, toRow(result))
+		}
+		if len(results) < batch || (limit > 0 && len(rows) >= limit) {
+			return rows, nil
+		}
+		//从上一批最后一行的下一个行键继续扫描
+		last := results[len(results)-1].Row
+		tScan.StartRow = append(append(make([]byte, 0, len(last)+1), last...), 0)
+	}
+}
+
+// toRow 将Thrift返回的结果转为Row
+func toRow(result *th.TResult_) *Row {
+	row := &Row{RowKey: string(result.Row), Values: make(map[string]map[string][]byte)}
+	for _, v := range result.ColumnValues {
+		family := row.Values[string(v.Family)]
+		if family == nil {
+			family = make(map[string][]byte)
+			row.Values[string(v.Family)] = family
+		}
+		family[string(v.Qualifier)] = v.Value
+	}
+	return row
+}
+
+// handleError 统一处理一次调用的错误
+// 如果是上下文被取消或超时导致的失败,底层的HTTP响应可能没有读完,
+// 此时重置通讯链路,保证连接归还后仍然可以被连接池继续使用
+func (hb *ThriftHbaseConn) handleError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		hb.reset()
+		return ctxErr
+	}
+	//通讯链路或者协议层面的异常,连接归还时由连接池丢弃
+	if isTransportError(err) {
+		hb.broken = true
+	}
 	return convertError(err)
 }
 
+// isTransportError 判断是否为通讯链路或者协议层面的异常,服务端返回的业务异常不在此列
+func isTransportError(err error) bool {
+	var transportErr thrift.TTransportException
+	var protocolErr thrift.TProtocolException
+	return errors.As(err, &transportErr) || errors.As(err, &protocolErr)
+}
+
+// reset 丢弃当前的通讯链路并重新建立一个新的链路
+func (hb *ThriftHbaseConn) reset() {
+	hb.Close()
+	if err := hb.Open(); err != nil {
+		log.Errorf("failed to reset hbase connection: %v", err)
+	}
+}
+
 // IsOpen 是否处于打开状态
-func (hb *ThriftHbaseConn) isOpen() bool {
-	return hb.HttpClient.IsOpen()
+func (hb *ThriftHbaseConn) IsOpen() bool {
+	return hb.transport != nil && hb.transport.IsOpen()
 }
 
-// Open 打开状态
-func (hb *ThriftHbaseConn) open() error {
-	return hb.HttpClient.Open()
+// Open 打开状态,如果通讯链路已经被关闭,则重新建立
+func (hb *ThriftHbaseConn) Open() error {
+	if hb.IsOpen() {
+		return nil
+	}
+	transport, client, err := newTransport(hb.conf)
+	if err != nil {
+		log.Errorf("create transport error! %v", err)
+		return err
+	}
+	if err = transport.Open(); err != nil {
+		log.Errorf("open transport error! %v", err)
+		return err
+	}
+	protocolFactory, err := newProtocolFactory(hb.conf)
+	if err != nil {
+		_ = transport.Close()
+		return err
+	}
+	hb.transport = transport
+	hb.HttpClient, _ = transport.(*thrift.THttpClient)
+	//使用通讯链路生成交互的客户端
+	hb.ServiceClient = th.NewTHBaseServiceClientFactory(transport, protocolFactory)
+	hb.client = client
+	hb.broken = false
+	return nil
 }
 
 // Close 关闭
-func (hb *ThriftHbaseConn) close() {
-	if hb.HttpClient != nil {
-		err := hb.HttpClient.Close()
+func (hb *ThriftHbaseConn) Close() {
+	if hb.transport != nil {
+		err := hb.transport.Close()
 		if err != nil {
 			log.Errorf("failed to close hbase connection: %v", err)
 		}
 	}
+	if hb.client != nil {
+		hb.client.CloseIdleConnections()
+	}
 }
 
 // IsOverdue 是否超过最大生命周期
-func (hb *ThriftHbaseConn) isOverdue(t time.Duration) bool {
+func (hb *ThriftHbaseConn) IsOverdue(t time.Duration) bool {
 	return time.Since(hb.CreateTime) > t
 }
 
+// IsBroken 调用过程中通讯链路是否出现过异常
+func (hb *ThriftHbaseConn) IsBroken() bool {
+	return hb.broken
+}
+
+// Ping 通过一次轻量的查询检测连接是否可用
+// 服务端返回的业务异常同样说明链路是通的,只有通讯异常才认为连接不可用
+func (hb *ThriftHbaseConn) Ping(ctx context.Context) error {
+	_, err := hb.ServiceClient.TableExists(ctx, hb.buildTTableName("meta", "hbase"))
+	if err != nil && (ctx.Err() != nil || isTransportError(err)) {
+		return err
+	}
+	return nil
+}
+
 // ThriftHbaseConn 链接封装
 type ThriftHbaseConn struct {
-	HttpClient    *thrift.THttpClient
+	HttpClient    *thrift.THttpClient //HTTP方式的通讯链路,其他方式时为nil
 	ServiceClient *th.THBaseServiceClient
 	CreateTime    time.Time
 	SpaceName     string
+
+	conf      *PoolConf         //连接配置,重建链路时使用
+	transport thrift.TTransport //底层的通讯链路
+	client    *http.Client      //连接自己创建的HTTP客户端,关闭时释放空闲的TCP连接
+	broken    bool              //通讯链路是否出现过异常
 }
 
 // thriftHBaseConnFactory 用于产生连接的工厂
-func thriftHBaseConnFactory(url, user, passwd, spaceName string) (Connection, error) {
-	//部分基础配置
-	conf := &thrift.TConfiguration{
-		ConnectTimeout: time.Second, //连接超时时间
-		SocketTimeout:  time.Second, //通讯超时时间
-		//MaxMessageSize:     1024 * 1024 * 256,
-		MaxFrameSize:       1024 * 1024 * 256,    //数据帧大小
-		TBinaryStrictRead:  thrift.BoolPtr(true), //二进制严格读
-		TBinaryStrictWrite: thrift.BoolPtr(true), //二进制严格写
-	}
-	//协议工厂
-	protocolFactory := thrift.NewTBinaryProtocolFactoryConf(conf)
-
-	//生成通讯链路
-	transport, err := thrift.NewTHttpClient(url)
-	if err != nil {
-		log.Errorf("create transport error! %v", err)
-		return nil, err
-	}
-	// TTransport 是一个接口, THttpClient是具体的实现
-	// 设置用户名密码
-	httpClient := transport.(*thrift.THttpClient)
-	httpClient.SetHeader("ACCESSKEYID", user)
-	httpClient.SetHeader("ACCESSSIGNATURE", passwd)
-
-	//使用通讯链路生成交互的客户端
-	serviceClient := th.NewTHBaseServiceClientFactory(httpClient, protocolFactory)
-
+func thriftHBaseConnFactory(conf *PoolConf) (Connection, error) {
 	hbaseConn := &ThriftHbaseConn{
-		HttpClient:    httpClient,    //底层通讯链路
-		ServiceClient: serviceClient, //业务接口封装
-		CreateTime:    time.Now(),
-		SpaceName:     spaceName, //命名空间
+		CreateTime: time.Now(),
+		SpaceName:  conf.SpaceName, //命名空间
+		conf:       conf,
+	}
+	//建立底层通讯链路以及业务接口封装
+	if err := hbaseConn.Open(); err != nil {
+		return nil, err
 	}
 	return hbaseConn, nil
 }
@@ -9,11 +9,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/yeahyf/go_base/file"
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
 	"github.com/yeahyf/go_base/strutil"
 	"github.com/yeahyf/go_base/utils"
 
@@ -36,16 +40,16 @@ var (
 )
 
 var conf = &PoolConf{
-	SpaceName,
-	URL,
-	USER,
-	PASSWORD,
-
-	1,
-	2,
-	10,
-	300 * time.Second,
-	3600 * time.Second,
+	SpaceName: SpaceName,
+	Address:   URL,
+	User:      USER,
+	Passwd:    PASSWORD,
+
+	MinIdleSize: 1,
+	MaxIdleSize: 2,
+	MaxOpenSize: 10,
+	MaxIdleTime: 300 * time.Second,
+	MaxLifeTime: 3600 * time.Second,
 }
 
 func TestCreateNameSpace(t *testing.T) {
@@ -61,7 +65,7 @@ func TestCreateNameSpace(t *testing.T) {
 	}
 	defer pool.Put(conn)
 
-	err = conn.CreateNameSpace()
+	err = conn.CreateNameSpace(context.Background())
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -81,7 +85,7 @@ func TestDeleteNameSpace(t *testing.T) {
 	}
 	defer pool.Put(conn)
 
-	err = conn.DeleteNameSpace()
+	err = conn.DeleteNameSpace(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -101,7 +105,7 @@ func TestListAllTable(t *testing.T) {
 	}
 	defer pool.Put(conn)
 
-	list, err := conn.ListAllTable()
+	list, err := conn.ListAllTable(context.Background())
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -129,7 +133,7 @@ func TestCreateTable(t *testing.T) {
 
 	tableName := "playcity"
 	familys := []string{"a", "e"}
-	err = conn.CreateTable(tableName, familys)
+	err = conn.CreateTable(context.Background(), tableName, familys)
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -151,7 +155,7 @@ func TestExistsTable(t *testing.T) {
 
 	tableName := "playcity1"
 
-	result, err := conn.ExistTable(tableName)
+	result, err := conn.ExistTable(context.Background(), tableName)
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -175,7 +179,7 @@ func TestCreateTableWithVersion(t *testing.T) {
 
 	tableName := "new_with_version"
 	familys := []string{"a", "e"}
-	err = conn.CreateTableWithVer(tableName, familys, 10)
+	err = conn.CreateTableWithVer(context.Background(), tableName, familys, 10)
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -196,8 +200,8 @@ func TestDeleteTable(t *testing.T) {
 	defer pool.Put(conn)
 
 	tableName := "playcity"
-	err = conn.DisableTable(tableName)
-	err = conn.DeleteTable(tableName)
+	err = conn.DisableTable(context.Background(), tableName)
+	err = conn.DeleteTable(context.Background(), tableName)
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -226,7 +230,7 @@ func TestFetchRow(t *testing.T) {
 	columnKeys := make(map[string][]string, 4)
 	columnKeys["a"] = []string{"z9"}
 
-	m, err := conn.FetchRow(tableName, rowKey, columnKeys)
+	m, err := conn.FetchRow(context.Background(), tableName, rowKey, columnKeys)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -291,7 +295,7 @@ func TestDeleteRow(t *testing.T) {
 	tableName := "fsaq0"
 	rowKey := "4tpsjvaebx4:0"
 
-	err = conn.DeleteRow(tableName, rowKey)
+	err = conn.DeleteRow(context.Background(), tableName, rowKey)
 	if err != nil {
 		if !errors.Is(err, RowNotFoundErr) {
 			t.Fatal(err)
@@ -362,7 +366,7 @@ func TestUpdateRow(t *testing.T) {
 		m[archiveFamilyName] = bMap
 		m[extendFamilyName] = extends
 
-		err = conn.UpdateRow(tableName, rowKey, m)
+		err = conn.UpdateRow(context.Background(), tableName, rowKey, m)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -392,7 +396,7 @@ func TestExistRow(t *testing.T) {
 	tableName := "oncn1"
 	rowKey := "4le91psw1p1:1"
 
-	exist, err := conn.ExistRow(tableName, rowKey)
+	exist, err := conn.ExistRow(context.Background(), tableName, rowKey)
 	if err != nil {
 		t.Fatal(err)
 		t.Log(exist)
@@ -423,7 +427,7 @@ func TestDeleteColumns(t *testing.T) {
 	m["a"] = s
 	// m["e"] = t1
 
-	err = conn.DeleteColumns(tableName, rowKey, m)
+	err = conn.DeleteColumns(context.Background(), tableName, rowKey, m)
 	if err != nil {
 		t.Fatal(err)
 	} else {
@@ -463,7 +467,7 @@ func TestFetchRowWithVersion(t *testing.T) {
 		tableName := record[4]
 		userid := record[0]
 		rowKey := userid[:len(userid)-1] + ":" + userid[len(userid)-1:]
-		m, err := conn.FetchRowByVer(tableName, rowKey, nil, 11)
+		m, err := conn.FetchRowByVer(context.Background(), tableName, rowKey, nil, 11)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -523,10 +527,138 @@ func TestUpdateAbnormalCount(t *testing.T) {
 
 		fmt.Println(tableName, rowKey, values)
 		// time.Sleep(3 * time.Minute)
-		err = conn.UpdateRow(tableName, rowKey, values)
+		err = conn.UpdateRow(context.Background(), tableName, rowKey, values)
 		if err != nil {
 			fmt.Println(record)
 		}
 		pool.Put(conn)
 	}
 }
+
+func TestContextCancel(t *testing.T) {
+	//模拟一个迟迟不返回的Thrift网关
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	c, err := thriftHBaseConnFactory(&PoolConf{
+		SpaceName:      SpaceName,
+		Address:        srv.URL,
+		ConnectTimeout: time.Second,
+		SocketTimeout:  10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.ExistTable(ctx, "test")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("call not aborted by context")
+	}
+	//链路被重置后,连接仍然是可用状态
+	if !c.IsOpen() {
+		t.Fatal("connection should be reopened after cancel")
+	}
+}
+
+func TestOpHook(t *testing.T) {
+	//网关返回5xx,模拟通讯异常
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	var events []*OpEvent
+	c, err := thriftHBaseConnFactory(&PoolConf{
+		SpaceName: SpaceName,
+		Address:   srv.URL,
+		OpHooks: []OpHook{func(ctx context.Context, event *OpEvent) {
+			events = append(events, event)
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err = c.ExistTable(context.Background(), "test"); err == nil {
+		t.Fatal("expect error from bad gateway")
+	}
+	if len(events) != 1 {
+		t.Fatalf("expect 1 event, got %d", len(events))
+	}
+	e := events[0]
+	if e.Op != OpExistTable || e.Table != "test" || e.Namespace != SpaceName || e.Err == nil {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if !c.IsBroken() {
+		t.Fatal("connection should be marked broken after transport error")
+	}
+
+	//删除内部的存在判断不单独触发
+	events = nil
+	_ = c.DeleteColumns(context.Background(), "test", "row", nil)
+	if len(events) != 1 || events[0].Op != OpDeleteColumns {
+		t.Fatalf("expect 1 delete event, got %+v", events)
+	}
+
+	events = nil
+	_ = c.CreateTable(context.Background(), "test", []string{"a"})
+	if len(events) != 1 || events[0].Op != OpCreateTable {
+		t.Fatalf("expect 1 create event, got %+v", events)
+	}
+}
+
+// scanHandler 记录扫描请求,按照请求的行数返回数据
+type scanHandler struct {
+	th.THBaseService
+
+	scans []*th.TScan
+}
+
+func (h *scanHandler) GetScannerResults(ctx context.Context, table []byte, tscan *th.TScan, numRows int32) ([]*th.TResult_, error) {
+	h.scans = append(h.scans, tscan)
+	results := make([]*th.TResult_, 0, numRows)
+	for i := int32(0); i < numRows; i++ {
+		results = append(results, &th.TResult_{
+			Row: []byte(fmt.Sprintf("r%d", i)),
+			ColumnValues: []*th.TColumnValue{
+				{Family: []byte("a"), Qualifier: []byte("x"), Value: []byte("v")},
+			},
+		})
+	}
+	return results, nil
+}
+
+func TestScanRows(t *testing.T) {
+	h := &scanHandler{}
+	var requests atomic.Int32
+	srv := newThriftServer(h, 0, &requests)
+	defer srv.Close()
+	c := newRetryConn(t, srv.URL, nil, nil)
+
+	rows, err := c.ScanRows(context.Background(), "user", "", "r9", map[string][]string{"a": nil}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[2].RowKey != "r2" || string(rows[0].Values["a"]["x"]) != "v" {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	scan := h.scans[0]
+	if scan.StartRow != nil || string(scan.StopRow) != "r9" ||
+		len(scan.Columns) != 1 || string(scan.Columns[0].Family) != "a" || scan.Columns[0].Qualifier != nil {
+		t.Fatalf("unexpected scan %+v", scan)
+	}
+}
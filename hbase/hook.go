@@ -0,0 +1,70 @@
+package hbase
+
+import (
+	"context"
+	"time"
+)
+
+// 操作名称,与 Connection 中的方法名一致
+const (
+	OpCreateNameSpace    = "CreateNameSpace"
+	OpDeleteNameSpace    = "DeleteNameSpace"
+	OpListNameSpaces     = "ListNameSpaces"
+	OpExistNameSpace     = "ExistNameSpace"
+	OpGetNameSpaceProps  = "GetNameSpaceProps"
+	OpModifyNameSpace    = "ModifyNameSpace"
+	OpCreateTable        = "CreateTable"
+	OpCreateTableWithVer = "CreateTableWithVer"
+	OpExistTable         = "ExistTable"
+	OpDisableTable       = "DisableTable"
+	OpEnableTable        = "EnableTable"
+	OpDeleteTable        = "DeleteTable"
+	OpListAllTable       = "ListAllTable"
+	OpUpdateRow          = "UpdateRow"
+	OpFetchRow           = "FetchRow"
+	OpFetchRowByVer      = "FetchRowByVer"
+	OpExistRow           = "ExistRow"
+	OpDeleteRow          = "DeleteRow"
+	OpDeleteColumns      = "DeleteColumns"
+	OpScanRows           = "ScanRows"
+
+	OpCreateTableWithDesc = "CreateTableWithDesc"
+	OpAddColumnFamily     = "AddColumnFamily"
+	OpModifyColumnFamily  = "ModifyColumnFamily"
+	OpDeleteColumnFamily  = "DeleteColumnFamily"
+	OpTruncateTable       = "TruncateTable"
+	OpGetTableDescriptor  = "GetTableDescriptor"
+	OpIsTableAvailable    = "IsTableAvailable"
+	OpListTableByPattern  = "ListTableByPattern"
+	OpGetRegionLocations  = "GetRegionLocations"
+)
+
+// OpEvent 一次操作完成后的信息
+type OpEvent struct {
+	Namespace string        //命名空间
+	Table     string        //表名,命名空间相关的操作为空
+	Op        string        //操作名称
+	Latency   time.Duration //操作耗时
+	Err       error         //操作返回的错误,成功时为nil
+}
+
+// OpHook 操作完成后的回调,可以桥接到日志或者监控系统
+// 回调在调用方的协程中同步执行,不应该有耗时的逻辑
+type OpHook func(ctx context.Context, event *OpEvent)
+
+// observe 操作完成后依次执行配置的回调,需要通过defer调用
+func (hb *ThriftHbaseConn) observe(ctx context.Context, op, table string, start time.Time, err *error, namespace ...string) {
+	if hb.conf == nil || len(hb.conf.OpHooks) == 0 {
+		return
+	}
+	event := &OpEvent{
+		Namespace: hb.getNamespace(namespace...),
+		Table:     table,
+		Op:        op,
+		Latency:   time.Since(start),
+		Err:       *err,
+	}
+	for _, hook := range hb.conf.OpHooks {
+		hook(ctx, event)
+	}
+}
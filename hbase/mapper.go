@@ -0,0 +1,399 @@
+package hbase
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 对象与行之间的映射
+//
+// 结构体字段通过 hbase 标签绑定到列,格式为 `hbase:"family:qualifier"`:
+//   - 只写列族 `hbase:"family"` 时,列名使用protobuf标签中的字段名,没有protobuf标签时使用Go字段名,
+//     protoc生成的消息可以借助 protoc-go-inject-tag 等工具为字段加上 hbase 标签
+//   - `hbase:"-"` 或者没有 hbase 标签的字段不参与映射
+//   - 选项 le 表示整数按照小端序编码,用于兼容使用 utils.GetBytesForInt64 写入的数据
+//
+// 支持的字段类型及编码方式:
+//   - string、[]byte 原样存储
+//   - 整数按照类型的宽度使用大端序编码,int、int64、uint、uint64 为8字节,与Java客户端的 Bytes.toBytes 一致
+//   - float32、float64 按照IEEE 754大端序编码,bool 编码为一个字节,true 为0xff
+//   - 实现了 proto.Message 的字段使用 proto.Marshal 编码,为nil时不写入
+//   - 以上类型的指针,为nil时不写入
+//
+// 注意 utils.GetBytesForInt64 实际使用小端序,与HBase的习惯相反,
+// 混用时需要在标签中加上 le 选项,否则读出的数值不正确
+
+// 映射相关的错误
+var (
+	MapperTypeErr  = errors.New("hbase mapper: value must be a non-nil pointer to struct")
+	MapperFieldErr = errors.New("hbase mapper: unknown field")
+)
+
+// hbaseTag 结构体标签的名称
+const hbaseTag = "hbase"
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// columnField 一个映射到列的字段
+type columnField struct {
+	name         string //Go字段名
+	index        []int  //字段的位置
+	family       string //列族
+	qualifier    string //列名
+	littleEndian bool   //整数是否按照小端序编码
+}
+
+// rowMapping 结构体与行之间的映射关系
+type rowMapping struct {
+	fields []*columnField
+	byName map[string]*columnField
+}
+
+// mappings 按类型缓存的映射关系
+var mappings sync.Map
+
+// getMapping 获取类型的映射关系,t 为结构体类型
+func getMapping(t reflect.Type) (*rowMapping, error) {
+	if m, ok := mappings.Load(t); ok {
+		return m.(*rowMapping), nil
+	}
+	m := &rowMapping{byName: make(map[string]*columnField)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(hbaseTag)
+		if !ok || tag == "-" || !sf.IsExported() {
+			continue
+		}
+		if err := checkFieldType(sf.Type); err != nil {
+			return nil, fmt.Errorf("hbase mapper: field %s.%s: %w", t.Name(), sf.Name, err)
+		}
+		f := &columnField{name: sf.Name, index: sf.Index}
+		column, options, _ := strings.Cut(tag, ",")
+		f.family, f.qualifier, _ = strings.Cut(column, ":")
+		if f.family == "" {
+			return nil, fmt.Errorf("hbase mapper: field %s.%s: empty family", t.Name(), sf.Name)
+		}
+		if f.qualifier == "" {
+			f.qualifier = protoFieldName(sf)
+		}
+		for _, opt := range strings.Split(options, ",") {
+			if opt == "le" {
+				f.littleEndian = true
+			}
+		}
+		m.fields = append(m.fields, f)
+		m.byName[f.name] = f
+	}
+	actual, _ := mappings.LoadOrStore(t, m)
+	return actual.(*rowMapping), nil
+}
+
+// protoFieldName 列名缺省时使用protobuf标签中的字段名,没有时使用Go字段名
+func protoFieldName(sf reflect.StructField) string {
+	for _, v := range strings.Split(sf.Tag.Get("protobuf"), ",") {
+		if name, ok := strings.CutPrefix(v, "name="); ok {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// checkFieldType 检查字段类型是否支持
+func checkFieldType(t reflect.Type) error {
+	if t.Implements(protoMessageType) {
+		return nil
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported type %s", t)
+}
+
+// structValue 检查 v 是否为指向结构体的非nil指针,返回结构体的值
+func structValue(v any) (reflect.Value, *rowMapping, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil, MapperTypeErr
+	}
+	m, err := getMapping(rv.Elem().Type())
+	if err != nil {
+		return reflect.Value{}, nil, err
+	}
+	return rv.Elem(), m, nil
+}
+
+// MarshalRow 将结构体编码为 UpdateRow 使用的 列族 -> 列名 -> 值
+// fields 为需要编码的Go字段名,为空时编码所有映射的字段,值为nil的指针字段不会写入
+func MarshalRow(v any, fields ...string) (map[string]map[string][]byte, error) {
+	rv, m, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	selected := m.fields
+	if len(fields) > 0 {
+		selected = make([]*columnField, 0, len(fields))
+		for _, name := range fields {
+			f, ok := m.byName[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", MapperFieldErr, name)
+			}
+			selected = append(selected, f)
+		}
+	}
+	values := make(map[string]map[string][]byte)
+	for _, f := range selected {
+		data, ok, err := encodeValue(rv.FieldByIndex(f.index), f.littleEndian)
+		if err != nil {
+			return nil, fmt.Errorf("hbase mapper: field %s: %w", f.name, err)
+		}
+		if !ok {
+			continue
+		}
+		family := values[f.family]
+		if family == nil {
+			family = make(map[string][]byte)
+			values[f.family] = family
+		}
+		family[f.qualifier] = data
+	}
+	return values, nil
+}
+
+// UnmarshalRow 将 列族 -> 列名 -> 值 解码到结构体中,不存在的列保持字段原有的值
+func UnmarshalRow(values map[string]map[string][]byte, v any) error {
+	rv, m, err := structValue(v)
+	if err != nil {
+		return err
+	}
+	for _, f := range m.fields {
+		data, ok := values[f.family][f.qualifier]
+		if !ok {
+			continue
+		}
+		if err = decodeValue(rv.FieldByIndex(f.index), data, f.littleEndian); err != nil {
+			return fmt.Errorf("hbase mapper: field %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// MappedColumns 返回结构体映射的所有列,可以作为 FetchRow、ScanRows 的 columnKeys 参数
+func MappedColumns(v any) (map[string][]string, error) {
+	_, m, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string][]string)
+	for _, f := range m.fields {
+		columns[f.family] = append(columns[f.family], f.qualifier)
+	}
+	return columns, nil
+}
+
+// SaveRow 将结构体所有映射的字段写入到 rowKey 对应的行中
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func SaveRow(ctx context.Context, conn Connection, tableName, rowKey string, v any, namespace ...string) error {
+	values, err := MarshalRow(v)
+	if err != nil {
+		return err
+	}
+	return conn.UpdateRow(ctx, tableName, rowKey, values, namespace...)
+}
+
+// UpdateRowFields 只将结构体中指定的字段写入到 rowKey 对应的行中,fields 为Go字段名
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func UpdateRowFields(ctx context.Context, conn Connection, tableName, rowKey string, v any, fields []string, namespace ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	values, err := MarshalRow(v, fields...)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return conn.UpdateRow(ctx, tableName, rowKey, values, namespace...)
+}
+
+// LoadRow 读取 rowKey 对应的行并解码到结构体中,行不存在时返回RowNotFoundErr
+// FetchRow 返回的结果只以列名为key,不同列族的同名列会相互覆盖,因此这里通过单行的 ScanRows 读取
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func LoadRow(ctx context.Context, conn Connection, tableName, rowKey string, v any, namespace ...string) error {
+	columns, err := MappedColumns(v)
+	if err != nil {
+		return err
+	}
+	//rowKey 之后紧邻的行键,保证只扫描一行
+	rows, err := conn.ScanRows(ctx, tableName, rowKey, rowKey+"\x00", columns, 1, namespace...)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 || rows[0].RowKey != rowKey {
+		return RowNotFoundErr
+	}
+	return UnmarshalRow(rows[0].Values, v)
+}
+
+// encodeValue 编码一个字段,返回false表示字段为nil不需要写入
+func encodeValue(v reflect.Value, littleEndian bool) ([]byte, bool, error) {
+	if v.Type().Implements(protoMessageType) {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		data, err := proto.Marshal(v.Interface().(proto.Message))
+		return data, err == nil, err
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		v = v.Elem()
+	}
+	order := byteOrder(littleEndian)
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String()), true, nil
+	case reflect.Slice:
+		return v.Bytes(), true, nil
+	case reflect.Bool:
+		if v.Bool() {
+			return []byte{0xff}, true, nil
+		}
+		return []byte{0}, true, nil
+	case reflect.Float32:
+		return order.AppendUint32(nil, math.Float32bits(float32(v.Float()))), true, nil
+	case reflect.Float64:
+		return order.AppendUint64(nil, math.Float64bits(v.Float())), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendUint(order, uint64(v.Int()), v.Type().Size()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return appendUint(order, v.Uint(), v.Type().Size()), true, nil
+	}
+	return nil, false, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// decodeValue 解码一个字段
+func decodeValue(v reflect.Value, data []byte, littleEndian bool) error {
+	if v.Type().Implements(protoMessageType) {
+		msg := reflect.New(v.Type().Elem())
+		if err := proto.Unmarshal(data, msg.Interface().(proto.Message)); err != nil {
+			return err
+		}
+		v.Set(msg)
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeValue(elem.Elem(), data, littleEndian); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	order := byteOrder(littleEndian)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(data))
+		return nil
+	case reflect.Slice:
+		v.SetBytes(append([]byte(nil), data...))
+		return nil
+	case reflect.Bool:
+		if len(data) != 1 {
+			return fmt.Errorf("invalid bool length %d", len(data))
+		}
+		v.SetBool(data[0] != 0)
+		return nil
+	case reflect.Float32:
+		if len(data) != 4 {
+			return fmt.Errorf("invalid float32 length %d", len(data))
+		}
+		v.SetFloat(float64(math.Float32frombits(order.Uint32(data))))
+		return nil
+	case reflect.Float64:
+		if len(data) != 8 {
+			return fmt.Errorf("invalid float64 length %d", len(data))
+		}
+		v.SetFloat(math.Float64frombits(order.Uint64(data)))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := readUint(order, data, v.Type().Size())
+		if err != nil {
+			return err
+		}
+		//按照宽度做符号扩展
+		shift := 64 - 8*v.Type().Size()
+		v.SetInt(int64(n<<shift) >> shift)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := readUint(order, data, v.Type().Size())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// endian 同时支持读取与追加写入的字节序
+type endian interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// byteOrder 整数与浮点数的字节序
+func byteOrder(littleEndian bool) endian {
+	if littleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// appendUint 按照宽度编码整数
+func appendUint(order endian, n uint64, size uintptr) []byte {
+	switch size {
+	case 1:
+		return []byte{byte(n)}
+	case 2:
+		return order.AppendUint16(nil, uint16(n))
+	case 4:
+		return order.AppendUint32(nil, uint32(n))
+	}
+	return order.AppendUint64(nil, n)
+}
+
+// readUint 按照宽度解码整数
+func readUint(order endian, data []byte, size uintptr) (uint64, error) {
+	if uintptr(len(data)) != size {
+		return 0, fmt.Errorf("invalid integer length %d, expect %d", len(data), size)
+	}
+	switch size {
+	case 1:
+		return uint64(data[0]), nil
+	case 2:
+		return uint64(order.Uint16(data)), nil
+	case 4:
+		return uint64(order.Uint32(data)), nil
+	}
+	return order.Uint64(data), nil
+}
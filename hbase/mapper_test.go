@@ -0,0 +1,100 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/utils"
+)
+
+type archive struct {
+	Name    string             `hbase:"info:name"`
+	Level   int32              `hbase:"info:level"`
+	Coins   int64              `hbase:"info:coins"`
+	Legacy  int64              `hbase:"info:legacy,le"`
+	Score   float64            `hbase:"stat:score"`
+	Vip     bool               `hbase:"stat:vip"`
+	Avatar  []byte             `hbase:"data:avatar"`
+	Nick    *string            `hbase:"info:nick"`
+	Err     *ept.ErrorResponse `hbase:"data:err"`
+	Code    uint32             `hbase:"stat" protobuf:"varint,1,opt,name=code,proto3"`
+	Ignored string             `hbase:"-"`
+	Plain   string
+}
+
+func TestMarshalRow(t *testing.T) {
+	a := &archive{Name: "bob", Level: -2, Coins: 1 << 40, Legacy: 7, Score: 1.5, Vip: true,
+		Err: &ept.ErrorResponse{Code: 1001, Info: "x"}, Code: 3, Ignored: "i", Plain: "p"}
+	values, err := MarshalRow(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values["info"]["level"]; len(got) != 4 || got[0] != 0xff || got[3] != 0xfe {
+		t.Fatalf("int32 should be 4 bytes big-endian, got %v", got)
+	}
+	if got := values["info"]["coins"]; len(got) != 8 || got[2] != 1 {
+		t.Fatalf("int64 should be 8 bytes big-endian, got %v", got)
+	}
+	if got := utils.GetInt64FromBytes(values["info"]["legacy"]); got != 7 {
+		t.Fatalf("le option should match utils.GetBytesForInt64, got %d", got)
+	}
+	if _, ok := values["info"]["nick"]; ok {
+		t.Fatal("nil pointer should not be written")
+	}
+	if _, ok := values["stat"]["code"]; !ok {
+		t.Fatalf("qualifier should default to the proto name, got %v", values["stat"])
+	}
+
+	var b archive
+	if err = UnmarshalRow(values, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != a.Name || b.Level != a.Level || b.Coins != a.Coins || b.Legacy != a.Legacy ||
+		b.Score != a.Score || !b.Vip || b.Code != 3 || b.Err.GetCode() != 1001 || b.Ignored != "" || b.Plain != "" {
+		t.Fatalf("unexpected value %+v", b)
+	}
+
+	if _, err = MarshalRow(a, "Unknown"); !errors.Is(err, MapperFieldErr) {
+		t.Fatalf("expected MapperFieldErr, got %v", err)
+	}
+	if _, err = MarshalRow(*a); !errors.Is(err, MapperTypeErr) {
+		t.Fatalf("expected MapperTypeErr, got %v", err)
+	}
+	type bad struct {
+		Tags []string `hbase:"info:tags"`
+	}
+	if _, err = MarshalRow(&bad{}); err == nil {
+		t.Fatal("expected error for unsupported field type")
+	}
+}
+
+func TestMapperLoadSave(t *testing.T) {
+	store := NewMemoryStore()
+	conn := store.NewConn(defaultNamespace)
+	ctx := context.Background()
+	if err := conn.CreateTable(ctx, "archive", []string{"info", "stat", "data"}); err != nil {
+		t.Fatal(err)
+	}
+	nick := "b"
+	a := &archive{Name: "bob", Level: 3, Nick: &nick}
+	if err := SaveRow(ctx, conn, "archive", "u1", a); err != nil {
+		t.Fatal(err)
+	}
+	a.Name, a.Level = "alice", 4
+	if err := UpdateRowFields(ctx, conn, "archive", "u1", a, []string{"Level"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var b archive
+	if err := LoadRow(ctx, conn, "archive", "u1", &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != "bob" || b.Level != 4 || b.Nick == nil || *b.Nick != "b" || b.Err != nil {
+		t.Fatalf("unexpected value %+v", b)
+	}
+	if err := LoadRow(ctx, conn, "archive", "u", &b); !errors.Is(err, RowNotFoundErr) {
+		t.Fatalf("expected RowNotFoundErr, got %v", err)
+	}
+}
@@ -0,0 +1,843 @@
+package hbase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+// MemoryConnClosedErr 内存连接已经关闭
+var MemoryConnClosedErr = errors.New("memory connection closed")
+
+// 与HBase服务端一致的异常名称,内存实现通过 TIOError 返回,调用方的处理逻辑与真实环境一致
+const (
+	namespaceNotFoundEx   = "org.apache.hadoop.hbase.NamespaceNotFoundException"
+	namespaceNotEmptyEx   = "org.apache.hadoop.hbase.constraint.ConstraintException: namespace is not empty"
+	tableNotFoundEx       = "org.apache.hadoop.hbase.TableNotFoundException"
+	tableNotEnabledEx     = "org.apache.hadoop.hbase.TableNotEnabledException"
+	noSuchFamilyEx        = "org.apache.hadoop.hbase.regionserver.NoSuchColumnFamilyException"
+	invalidFamilyOpEx     = "org.apache.hadoop.hbase.InvalidFamilyOperationException"
+	systemNamespace       = "hbase"
+	memoryRegionServer    = "localhost"
+	memoryRegionPort      = int32(16020)
+	defaultFamilyVersions = int32(1)
+)
+
+// memoryServerError 构建与Thrift实现一致的服务端异常
+func memoryServerError(msg string) error {
+	return convertError(&th.TIOError{Message: &msg})
+}
+
+// MemoryStore 内存中的HBase,用于单元测试
+// 支持命名空间、表、列族、带时间戳的多版本数据以及范围扫描,所有连接共享同一份数据
+// 列族的 MaxVersions 与 TimeToLive 会在写入和读取时生效,其他列族配置只做保存
+type MemoryStore struct {
+	mu         sync.RWMutex
+	namespaces map[string]map[string]*memTable //命名空间 -> 表名 -> 表
+	nsProps    map[string]map[string]string    //命名空间的配置
+	lastTs     int64                           //最后一次写入的时间戳,保证时间戳单调递增
+	regionId   int64                           //region编号
+	now        func() time.Time                //时钟,测试时可以替换
+}
+
+// memTable 内存中的表
+type memTable struct {
+	families  map[string]*th.TColumnFamilyDescriptor //列族描述
+	enabled   bool                                   //是否启用
+	splitKeys [][]byte                               //预分区的分割点
+	regionIds []int64                                //每个region的编号
+	rows      map[string]map[string]map[string][]memCell
+}
+
+// memCell 一个版本的数据
+type memCell struct {
+	ts    int64 //时间戳,单位毫秒
+	value []byte
+}
+
+// NewMemoryStore 构建一个空的内存HBase,只包含 default 与 hbase 两个命名空间以及 hbase:meta 表
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		namespaces: map[string]map[string]*memTable{
+			defaultNamespace: {},
+			systemNamespace:  {},
+		},
+		nsProps: make(map[string]map[string]string),
+		now:     time.Now,
+	}
+	s.namespaces[systemNamespace]["meta"] = s.newTable([]*th.TColumnFamilyDescriptor{NewFamilyDescriptor("info")}, nil)
+	return s
+}
+
+// ConnFactory 返回创建内存连接的工厂,与 NewPoolByFactory 配合使用
+// 连接默认的命名空间为 PoolConf 中的 SpaceName
+func (s *MemoryStore) ConnFactory() ConnFactory {
+	return func(conf *PoolConf) (Connection, error) {
+		return s.NewConn(conf.SpaceName), nil
+	}
+}
+
+// NewConn 创建一个内存连接,spaceName 为默认的命名空间
+func (s *MemoryStore) NewConn(spaceName string) *MemoryConn {
+	c := &MemoryConn{store: s, SpaceName: spaceName, CreateTime: time.Now()}
+	c.open.Store(true)
+	return c
+}
+
+// newTable 创建表,调用方需要持有写锁
+func (s *MemoryStore) newTable(families []*th.TColumnFamilyDescriptor, splitKeys [][]byte) *memTable {
+	t := &memTable{
+		families: make(map[string]*th.TColumnFamilyDescriptor, len(families)),
+		enabled:  true,
+		rows:     make(map[string]map[string]map[string][]memCell),
+	}
+	for _, f := range families {
+		t.families[string(f.Name)] = copyFamily(f)
+	}
+	s.splitTable(t, splitKeys)
+	return t
+}
+
+// splitTable 按照分割点重新生成region,调用方需要持有写锁
+func (s *MemoryStore) splitTable(t *memTable, splitKeys [][]byte) {
+	t.splitKeys = make([][]byte, 0, len(splitKeys))
+	for _, k := range splitKeys {
+		t.splitKeys = append(t.splitKeys, slices.Clone(k))
+	}
+	slices.SortFunc(t.splitKeys, bytes.Compare)
+	t.regionIds = make([]int64, len(t.splitKeys)+1)
+	for i := range t.regionIds {
+		s.regionId++
+		t.regionIds[i] = s.regionId
+	}
+}
+
+// nextTs 生成写入的时间戳,单位毫秒,调用方需要持有写锁
+func (s *MemoryStore) nextTs() int64 {
+	ts := s.now().UnixMilli()
+	if ts <= s.lastTs {
+		ts = s.lastTs + 1
+	}
+	s.lastTs = ts
+	return ts
+}
+
+// copyFamily 复制列族描述,避免调用方修改内部的数据
+func copyFamily(f *th.TColumnFamilyDescriptor) *th.TColumnFamilyDescriptor {
+	c := *f
+	c.Name = slices.Clone(f.Name)
+	return &c
+}
+
+var _ Connection = (*MemoryConn)(nil)
+
+// MemoryConn 内存HBase的连接,实现了 Connection 接口
+type MemoryConn struct {
+	CreateTime time.Time
+	SpaceName  string
+
+	store *MemoryStore
+	open  atomic.Bool //连接池的检测以及 Close 可能在其他goroutine中调用
+}
+
+// getNamespace 获取命名空间,namespace 为空时使用默认的 SpaceName
+func (c *MemoryConn) getNamespace(namespace ...string) string {
+	if len(namespace) > 0 && namespace[0] != "" {
+		return namespace[0]
+	}
+	return c.SpaceName
+}
+
+// check 操作前检查连接与上下文的状态
+func (c *MemoryConn) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !c.open.Load() {
+		return MemoryConnClosedErr
+	}
+	return nil
+}
+
+// table 查找表,表不存在时返回与服务端一致的异常,调用方需要持有锁
+func (c *MemoryConn) table(tableName string, namespace ...string) (*memTable, error) {
+	tables, ok := c.store.namespaces[c.getNamespace(namespace...)]
+	if !ok {
+		return nil, memoryServerError(namespaceNotFoundEx)
+	}
+	t, ok := tables[tableName]
+	if !ok {
+		return nil, memoryServerError(tableNotFoundEx)
+	}
+	return t, nil
+}
+
+// enabledTable 查找可以读写的表,调用方需要持有锁
+func (c *MemoryConn) enabledTable(tableName string, namespace ...string) (*memTable, error) {
+	t, err := c.table(tableName, namespace...)
+	if err != nil {
+		return nil, err
+	}
+	if !t.enabled {
+		return nil, memoryServerError(tableNotEnabledEx)
+	}
+	return t, nil
+}
+
+// CreateNameSpace 创建命名空间,已经存在时返回NSExistErr
+func (c *MemoryConn) CreateNameSpace(ctx context.Context, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	ns := c.getNamespace(namespace...)
+	if _, ok := c.store.namespaces[ns]; ok {
+		return NSExistErr
+	}
+	c.store.namespaces[ns] = make(map[string]*memTable)
+	return nil
+}
+
+// ListNameSpaces 列出所有的命名空间,按照名称排列
+func (c *MemoryConn) ListNameSpaces(ctx context.Context) ([]string, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	return slices.Sorted(maps.Keys(c.store.namespaces)), nil
+}
+
+// ExistNameSpace 命名空间是否存在
+func (c *MemoryConn) ExistNameSpace(ctx context.Context, namespace ...string) (bool, error) {
+	if err := c.check(ctx); err != nil {
+		return false, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	_, ok := c.store.namespaces[c.getNamespace(namespace...)]
+	return ok, nil
+}
+
+// GetNameSpaceProps 获取命名空间的配置,不存在时返回NSNotExistErr
+func (c *MemoryConn) GetNameSpaceProps(ctx context.Context, namespace ...string) (map[string]string, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	ns := c.getNamespace(namespace...)
+	if _, ok := c.store.namespaces[ns]; !ok {
+		return nil, NSNotExistErr
+	}
+	props := make(map[string]string, len(c.store.nsProps[ns]))
+	maps.Copy(props, c.store.nsProps[ns])
+	return props, nil
+}
+
+// ModifyNameSpace 使用 props 替换命名空间的全部配置,不存在时返回NSNotExistErr
+func (c *MemoryConn) ModifyNameSpace(ctx context.Context, props map[string]string, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	ns := c.getNamespace(namespace...)
+	if _, ok := c.store.namespaces[ns]; !ok {
+		return NSNotExistErr
+	}
+	c.store.nsProps[ns] = maps.Clone(props)
+	return nil
+}
+
+// DeleteNameSpace 删除命名空间,不存在时返回NSNotExistErr,命名空间中还有表时返回服务端异常
+func (c *MemoryConn) DeleteNameSpace(ctx context.Context, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	ns := c.getNamespace(namespace...)
+	tables, ok := c.store.namespaces[ns]
+	if !ok {
+		return NSNotExistErr
+	}
+	if len(tables) > 0 {
+		return memoryServerError(namespaceNotEmptyEx)
+	}
+	delete(c.store.namespaces, ns)
+	delete(c.store.nsProps, ns)
+	return nil
+}
+
+// CreateTable 创建表,不带版本,只存储最新的数据
+func (c *MemoryConn) CreateTable(ctx context.Context, tableName string, familyNames []string, namespace ...string) error {
+	return c.CreateTableWithVer(ctx, tableName, familyNames, defaultFamilyVersions, namespace...)
+}
+
+// CreateTableWithVer 创建表,每个列族保留 maxVersion 个版本
+func (c *MemoryConn) CreateTableWithVer(ctx context.Context, tableName string, familyNames []string, maxVersion int32, namespace ...string) error {
+	families := make([]*th.TColumnFamilyDescriptor, 0, len(familyNames))
+	for _, v := range familyNames {
+		families = append(families, NewFamilyDescriptor(v, WithMaxVersions(maxVersion)))
+	}
+	return c.CreateTableWithDesc(ctx, tableName, families, nil, namespace...)
+}
+
+// CreateTableWithDesc 按照列族描述创建表,表已经存在时返回TableExistErr
+func (c *MemoryConn) CreateTableWithDesc(ctx context.Context, tableName string, families []*th.TColumnFamilyDescriptor,
+	splitKeys [][]byte, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	tables, ok := c.store.namespaces[c.getNamespace(namespace...)]
+	if !ok {
+		return memoryServerError(namespaceNotFoundEx)
+	}
+	if _, ok = tables[tableName]; ok {
+		return TableExistErr
+	}
+	tables[tableName] = c.store.newTable(families, splitKeys)
+	return nil
+}
+
+// ExistTable 表是否存在
+func (c *MemoryConn) ExistTable(ctx context.Context, tableName string, namespace ...string) (bool, error) {
+	if err := c.check(ctx); err != nil {
+		return false, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	_, ok := c.store.namespaces[c.getNamespace(namespace...)][tableName]
+	return ok, nil
+}
+
+// DisableTable 停用表,表不存在时返回TableNotExistErr
+func (c *MemoryConn) DisableTable(ctx context.Context, tableName string, namespace ...string) error {
+	return c.setEnabled(ctx, tableName, false, namespace...)
+}
+
+// EnableTable 启用表,表不存在时返回TableNotExistErr
+func (c *MemoryConn) EnableTable(ctx context.Context, tableName string, namespace ...string) error {
+	return c.setEnabled(ctx, tableName, true, namespace...)
+}
+
+// setEnabled 修改表的启用状态
+func (c *MemoryConn) setEnabled(ctx context.Context, tableName string, enabled bool, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	t, ok := c.store.namespaces[c.getNamespace(namespace...)][tableName]
+	if !ok {
+		return TableNotExistErr
+	}
+	t.enabled = enabled
+	return nil
+}
+
+// DeleteTable 删除表,表不存在时返回TableNotExistErr,表没有停用时返回TableEnabledErr
+func (c *MemoryConn) DeleteTable(ctx context.Context, tableName string, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	tables := c.store.namespaces[c.getNamespace(namespace...)]
+	t, ok := tables[tableName]
+	if !ok {
+		return TableNotExistErr
+	}
+	if t.enabled {
+		return TableEnabledErr
+	}
+	delete(tables, tableName)
+	return nil
+}
+
+// ListAllTable 列出命名空间中所有的表名,按照字典序排列
+func (c *MemoryConn) ListAllTable(ctx context.Context, namespace ...string) ([]string, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	tables, ok := c.store.namespaces[c.getNamespace(namespace...)]
+	if !ok {
+		return nil, memoryServerError(namespaceNotFoundEx)
+	}
+	list := make([]string, 0, len(tables))
+	for k := range tables {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// AddColumnFamily 为表增加列族,列族已经存在时返回服务端异常
+func (c *MemoryConn) AddColumnFamily(ctx context.Context, tableName string, family *th.TColumnFamilyDescriptor, namespace ...string) error {
+	return c.alterFamily(ctx, tableName, string(family.Name), false, namespace, func(t *memTable) {
+		t.families[string(family.Name)] = copyFamily(family)
+	})
+}
+
+// ModifyColumnFamily 修改表中已经存在的列族,列族不存在时返回服务端异常
+func (c *MemoryConn) ModifyColumnFamily(ctx context.Context, tableName string, family *th.TColumnFamilyDescriptor, namespace ...string) error {
+	return c.alterFamily(ctx, tableName, string(family.Name), true, namespace, func(t *memTable) {
+		t.families[string(family.Name)] = copyFamily(family)
+	})
+}
+
+// DeleteColumnFamily 删除表中的列族,列族中的数据会一并删除
+func (c *MemoryConn) DeleteColumnFamily(ctx context.Context, tableName, familyName string, namespace ...string) error {
+	return c.alterFamily(ctx, tableName, familyName, true, namespace, func(t *memTable) {
+		delete(t.families, familyName)
+		for rowKey, row := range t.rows {
+			delete(row, familyName)
+			if len(row) == 0 {
+				delete(t.rows, rowKey)
+			}
+		}
+	})
+}
+
+// alterFamily 修改列族,exist 表示要求列族已经存在
+func (c *MemoryConn) alterFamily(ctx context.Context, tableName, familyName string, exist bool, namespace []string, fn func(t *memTable)) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	t, err := c.table(tableName, namespace...)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.families[familyName]; ok != exist {
+		return memoryServerError(invalidFamilyOpEx)
+	}
+	fn(t)
+	return nil
+}
+
+// TruncateTable 清空表中的数据,preserveSplits 为true时保留原有的分区,清空完成后表处于启用状态
+func (c *MemoryConn) TruncateTable(ctx context.Context, tableName string, preserveSplits bool, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	t, ok := c.store.namespaces[c.getNamespace(namespace...)][tableName]
+	if !ok {
+		return TableNotExistErr
+	}
+	t.rows = make(map[string]map[string]map[string][]memCell)
+	t.enabled = true
+	if preserveSplits {
+		c.store.splitTable(t, t.splitKeys)
+	} else {
+		c.store.splitTable(t, nil)
+	}
+	return nil
+}
+
+// GetTableDescriptor 获取表的描述信息,列族按照名称排列
+func (c *MemoryConn) GetTableDescriptor(ctx context.Context, tableName string, namespace ...string) (*th.TTableDescriptor, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	t, err := c.table(tableName, namespace...)
+	if err != nil {
+		return nil, err
+	}
+	desc := &th.TTableDescriptor{
+		TableName: &th.TTableName{Ns: []byte(c.getNamespace(namespace...)), Qualifier: []byte(tableName)},
+		Columns:   make([]*th.TColumnFamilyDescriptor, 0, len(t.families)),
+	}
+	for _, name := range t.familyNames() {
+		desc.Columns = append(desc.Columns, copyFamily(t.families[name]))
+	}
+	return desc, nil
+}
+
+// IsTableAvailable 表是否可用,内存实现中启用的表即为可用
+func (c *MemoryConn) IsTableAvailable(ctx context.Context, tableName string, namespace ...string) (bool, error) {
+	if err := c.check(ctx); err != nil {
+		return false, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	t, err := c.table(tableName, namespace...)
+	if err != nil {
+		return false, err
+	}
+	return t.enabled, nil
+}
+
+// ListTableByPattern 按照正则表达式列出所有命名空间中匹配的表,返回的表名格式为 namespace:table
+// 与服务端一致,default 命名空间中的表使用不带命名空间的表名匹配
+func (c *MemoryConn) ListTableByPattern(ctx context.Context, regex string, includeSysTables bool) ([]string, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		msg := err.Error()
+		return nil, convertError(&th.TIllegalArgument{Message: &msg})
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	var list []string
+	for ns, tables := range c.store.namespaces {
+		if ns == systemNamespace && !includeSysTables {
+			continue
+		}
+		for name := range tables {
+			fullName := ns + ":" + name
+			matchName := fullName
+			if ns == defaultNamespace {
+				matchName = name
+			}
+			if re.MatchString(matchName) {
+				list = append(list, fullName)
+			}
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// GetRegionLocations 获取表所有region的位置信息,region按照预分区的分割点划分
+func (c *MemoryConn) GetRegionLocations(ctx context.Context, tableName string, namespace ...string) ([]*th.THRegionLocation, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	t, err := c.table(tableName, namespace...)
+	if err != nil {
+		return nil, err
+	}
+	tbName := []byte(c.getNamespace(namespace...) + ":" + tableName)
+	port := memoryRegionPort
+	locations := make([]*th.THRegionLocation, 0, len(t.regionIds))
+	for i, id := range t.regionIds {
+		info := &th.THRegionInfo{RegionId: id, TableName: tbName}
+		if i > 0 {
+			info.StartKey = slices.Clone(t.splitKeys[i-1])
+		}
+		if i < len(t.splitKeys) {
+			info.EndKey = slices.Clone(t.splitKeys[i])
+		}
+		locations = append(locations, &th.THRegionLocation{
+			ServerName: &th.TServerName{HostName: memoryRegionServer, Port: &port},
+			RegionInfo: info,
+		})
+	}
+	return locations, nil
+}
+
+// UpdateRow 写入一行数据,列族不存在时返回服务端异常,超出列族 MaxVersions 的旧版本会被丢弃
+func (c *MemoryConn) UpdateRow(ctx context.Context, tableName, rowKey string, values map[string]map[string][]byte, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	t, err := c.enabledTable(tableName, namespace...)
+	if err != nil {
+		return err
+	}
+	for family := range values {
+		if _, ok := t.families[family]; !ok {
+			return memoryServerError(noSuchFamilyEx)
+		}
+	}
+	ts := c.store.nextTs()
+	row := t.rows[rowKey]
+	if row == nil {
+		row = make(map[string]map[string][]memCell)
+		t.rows[rowKey] = row
+	}
+	for family, columns := range values {
+		maxVersions := t.maxVersions(family)
+		cells := row[family]
+		if cells == nil {
+			cells = make(map[string][]memCell)
+			row[family] = cells
+		}
+		for qualifier, value := range columns {
+			//最新的版本放在最前面
+			versions := append([]memCell{{ts: ts, value: slices.Clone(value)}}, cells[qualifier]...)
+			if len(versions) > maxVersions {
+				versions = versions[:maxVersions]
+			}
+			cells[qualifier] = versions
+		}
+	}
+	return nil
+}
+
+// FetchRow 获取一行数据中每一列最新的版本,返回的map以列名为key
+func (c *MemoryConn) FetchRow(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, namespace ...string) (map[string][]byte, error) {
+	return c.FetchRowByVer(ctx, tableName, rowKey, columnKeys, 1, namespace...)
+}
+
+// FetchRowByVer 按照版本获取一行数据,与Thrift实现一致,
+// 每一列从新到旧取最多 maxVer 个版本依次写入以列名为key的map,因此返回的是其中最旧的版本
+func (c *MemoryConn) FetchRowByVer(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string,
+	maxVer int32, namespace ...string) (map[string][]byte, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	t, err := c.enabledTable(tableName, namespace...)
+	if err != nil {
+		return nil, err
+	}
+	number := 0
+	for family, v := range columnKeys {
+		if _, ok := t.families[family]; !ok {
+			return nil, memoryServerError(noSuchFamilyEx)
+		}
+		number += len(v)
+	}
+	m := make(map[string][]byte)
+	row := t.rows[rowKey]
+	if row == nil {
+		return m, nil
+	}
+	now := c.store.now().UnixMilli()
+	visit := func(family, qualifier string) {
+		n := 0
+		for _, cell := range row[family][qualifier] {
+			if n >= int(max(maxVer, 1)) {
+				break
+			}
+			if t.expired(family, cell, now) {
+				continue
+			}
+			m[qualifier] = cell.value
+			n++
+		}
+	}
+	if number == 0 {
+		for _, family := range t.familyNames() {
+			for qualifier := range row[family] {
+				visit(family, qualifier)
+			}
+		}
+		return m, nil
+	}
+	for family, qualifiers := range columnKeys {
+		for _, qualifier := range qualifiers {
+			visit(family, qualifier)
+		}
+	}
+	return m, nil
+}
+
+// ExistRow 判断某行数据是否存在,表不存在时返回TableNotExistErr
+func (c *MemoryConn) ExistRow(ctx context.Context, tableName string, rowKey string, namespace ...string) (bool, error) {
+	if err := c.check(ctx); err != nil {
+		return false, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	t, ok := c.store.namespaces[c.getNamespace(namespace...)][tableName]
+	if !ok {
+		return false, TableNotExistErr
+	}
+	if !t.enabled {
+		return false, memoryServerError(tableNotEnabledEx)
+	}
+	return t.liveRow(rowKey, c.store.now().UnixMilli()), nil
+}
+
+// DeleteRow 删除一行数据,行不存在时返回RowNotFoundErr
+func (c *MemoryConn) DeleteRow(ctx context.Context, tableName, rowKey string, namespace ...string) error {
+	return c.DeleteColumns(ctx, tableName, rowKey, nil, namespace...)
+}
+
+// DeleteColumns 删除某些列的所有版本,columnKeys 为nil时删除整行,行不存在时返回RowNotFoundErr
+func (c *MemoryConn) DeleteColumns(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, namespace ...string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	t, ok := c.store.namespaces[c.getNamespace(namespace...)][tableName]
+	if !ok {
+		return TableNotExistErr
+	}
+	if !t.enabled {
+		return memoryServerError(tableNotEnabledEx)
+	}
+	if !t.liveRow(rowKey, c.store.now().UnixMilli()) {
+		return RowNotFoundErr
+	}
+	if columnKeys == nil {
+		delete(t.rows, rowKey)
+		return nil
+	}
+	row := t.rows[rowKey]
+	for family, qualifiers := range columnKeys {
+		for _, qualifier := range qualifiers {
+			delete(row[family], qualifier)
+		}
+		if len(row[family]) == 0 {
+			delete(row, family)
+		}
+	}
+	if len(row) == 0 {
+		delete(t.rows, rowKey)
+	}
+	return nil
+}
+
+// ScanRows 扫描[startRow, stopRow)范围内的行,按照行键的字典序返回每一列最新的版本
+func (c *MemoryConn) ScanRows(ctx context.Context, tableName, startRow, stopRow string, columnKeys map[string][]string,
+	limit int, namespace ...string) ([]*Row, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	t, err := c.enabledTable(tableName, namespace...)
+	if err != nil {
+		return nil, err
+	}
+	for family := range columnKeys {
+		if _, ok := t.families[family]; !ok {
+			return nil, memoryServerError(noSuchFamilyEx)
+		}
+	}
+	keys := make([]string, 0, len(t.rows))
+	for k := range t.rows {
+		if k >= startRow && (stopRow == "" || k < stopRow) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	now := c.store.now().UnixMilli()
+	var rows []*Row
+	for _, k := range keys {
+		if limit > 0 && len(rows) >= limit {
+			break
+		}
+		row := &Row{RowKey: k, Values: make(map[string]map[string][]byte)}
+		for family, cells := range t.rows[k] {
+			qualifiers, selected := columnKeys[family]
+			if len(columnKeys) > 0 && !selected {
+				continue
+			}
+			for qualifier, versions := range cells {
+				if len(qualifiers) > 0 && !slices.Contains(qualifiers, qualifier) {
+					continue
+				}
+				for _, cell := range versions {
+					if t.expired(family, cell, now) {
+						continue
+					}
+					if row.Values[family] == nil {
+						row.Values[family] = make(map[string][]byte)
+					}
+					row.Values[family][qualifier] = cell.value
+					break
+				}
+			}
+		}
+		//与服务端一致,没有任何匹配列的行不返回
+		if len(row.Values) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// familyNames 按照名称排列的列族
+func (t *memTable) familyNames() []string {
+	names := make([]string, 0, len(t.families))
+	for k := range t.families {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maxVersions 列族保留的最多版本数,未设置时为1
+func (t *memTable) maxVersions(family string) int {
+	if f := t.families[family]; f != nil && f.MaxVersions != nil && *f.MaxVersions > 0 {
+		return int(*f.MaxVersions)
+	}
+	return int(defaultFamilyVersions)
+}
+
+// expired 数据是否已经超过列族的存活时间
+func (t *memTable) expired(family string, cell memCell, now int64) bool {
+	f := t.families[family]
+	if f == nil || f.TimeToLive == nil || *f.TimeToLive <= 0 {
+		return false
+	}
+	return cell.ts+int64(*f.TimeToLive)*1000 <= now
+}
+
+// liveRow 行中是否存在没有过期的数据
+func (t *memTable) liveRow(rowKey string, now int64) bool {
+	for family, cells := range t.rows[rowKey] {
+		for _, versions := range cells {
+			for _, cell := range versions {
+				if !t.expired(family, cell, now) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// IsOpen 是否处于打开状态
+func (c *MemoryConn) IsOpen() bool {
+	return c.open.Load()
+}
+
+// Open 打开连接
+func (c *MemoryConn) Open() error {
+	c.open.Store(true)
+	return nil
+}
+
+// Close 关闭连接,数据仍然保留在 MemoryStore 中
+func (c *MemoryConn) Close() {
+	c.open.Store(false)
+}
+
+// IsOverdue 是否超过最大生命周期
+func (c *MemoryConn) IsOverdue(t time.Duration) bool {
+	return time.Since(c.CreateTime) > t
+}
+
+// IsBroken 内存连接不会出现通讯异常
+func (c *MemoryConn) IsBroken() bool {
+	return false
+}
+
+// Ping 检测连接是否可用
+func (c *MemoryConn) Ping(ctx context.Context) error {
+	return c.check(ctx)
+}
@@ -0,0 +1,260 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+func newMemoryPool(t *testing.T) (*MemoryStore, *ConnectionPool) {
+	store := NewMemoryStore()
+	pool := NewPoolByFactory(store.ConnFactory(), &PoolConf{
+		SpaceName:   "test",
+		MinIdleSize: 1,
+		MaxIdleSize: 2,
+		MaxOpenSize: 4,
+	})
+	t.Cleanup(pool.Close)
+	return store, pool
+}
+
+func TestMemoryTable(t *testing.T) {
+	_, pool := newMemoryPool(t)
+	ctx := context.Background()
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(conn)
+
+	if err = conn.CreateTable(ctx, "user", []string{"info"}); err == nil {
+		t.Fatal("expected error when namespace does not exist")
+	}
+	if err = conn.CreateNameSpace(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.CreateNameSpace(ctx); !errors.Is(err, NSExistErr) {
+		t.Fatalf("expected NSExistErr, got %v", err)
+	}
+	if err = conn.CreateTable(ctx, "user", []string{"info"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.CreateTable(ctx, "user", []string{"info"}); !errors.Is(err, TableExistErr) {
+		t.Fatalf("expected TableExistErr, got %v", err)
+	}
+	if exist, _ := conn.ExistTable(ctx, "user"); !exist {
+		t.Fatal("table should exist")
+	}
+	tables, err := conn.ListAllTable(ctx)
+	if err != nil || !reflect.DeepEqual(tables, []string{"user"}) {
+		t.Fatalf("unexpected tables %v, %v", tables, err)
+	}
+	tables, err = conn.ListTableByPattern(ctx, ".*", true)
+	if err != nil || !reflect.DeepEqual(tables, []string{"hbase:meta", "test:user"}) {
+		t.Fatalf("unexpected tables %v, %v", tables, err)
+	}
+
+	if err = conn.DeleteNameSpace(ctx); err == nil {
+		t.Fatal("expected error when namespace has tables")
+	}
+	if err = conn.DeleteTable(ctx, "user"); !errors.Is(err, TableEnabledErr) {
+		t.Fatalf("expected TableEnabledErr, got %v", err)
+	}
+	if err = conn.DisableTable(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.FetchRow(ctx, "user", "r1", nil)
+	var ioErr *th.TIOError
+	if !errors.As(err, &ioErr) {
+		t.Fatalf("expected TIOError reading a disabled table, got %v", err)
+	}
+	if err = conn.DeleteTable(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.DeleteTable(ctx, "user"); !errors.Is(err, TableNotExistErr) {
+		t.Fatalf("expected TableNotExistErr, got %v", err)
+	}
+	if err = conn.DeleteNameSpace(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.DeleteNameSpace(ctx); !errors.Is(err, NSNotExistErr) {
+		t.Fatalf("expected NSNotExistErr, got %v", err)
+	}
+}
+
+func TestMemoryVersions(t *testing.T) {
+	store, pool := newMemoryPool(t)
+	ctx := context.Background()
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(conn)
+
+	if err = conn.CreateTableWithVer(ctx, "user", []string{"info"}, 2, defaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"v1", "v2", "v3"} {
+		err = conn.UpdateRow(ctx, "user", "r1", map[string]map[string][]byte{"info": {"name": []byte(v)}}, defaultNamespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := conn.FetchRow(ctx, "user", "r1", nil, defaultNamespace)
+	if err != nil || string(m["name"]) != "v3" {
+		t.Fatalf("unexpected latest value %q, %v", m["name"], err)
+	}
+	//只保留两个版本,与Thrift实现一致返回其中最旧的版本
+	m, err = conn.FetchRowByVer(ctx, "user", "r1", map[string][]string{"info": {"name"}}, 5, defaultNamespace)
+	if err != nil || string(m["name"]) != "v2" {
+		t.Fatalf("unexpected versioned value %q, %v", m["name"], err)
+	}
+
+	err = conn.UpdateRow(ctx, "user", "r1", map[string]map[string][]byte{"other": {"name": []byte("x")}}, defaultNamespace)
+	if err == nil {
+		t.Fatal("expected error writing an unknown family")
+	}
+
+	//列族设置了存活时间,过期之后数据不可见
+	err = conn.AddColumnFamily(ctx, "user", NewFamilyDescriptor("tmp", WithTTL(time.Second)), defaultNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.UpdateRow(ctx, "user", "r2", map[string]map[string][]byte{"tmp": {"code": []byte("1")}}, defaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+	if exist, _ := conn.ExistRow(ctx, "user", "r2", defaultNamespace); !exist {
+		t.Fatal("row should exist before expiration")
+	}
+	store.mu.Lock()
+	store.now = func() time.Time { return time.Now().Add(2 * time.Second) }
+	store.mu.Unlock()
+	if exist, _ := conn.ExistRow(ctx, "user", "r2", defaultNamespace); exist {
+		t.Fatal("row should expire")
+	}
+	if err = conn.DeleteRow(ctx, "user", "r2", defaultNamespace); !errors.Is(err, RowNotFoundErr) {
+		t.Fatalf("expected RowNotFoundErr, got %v", err)
+	}
+}
+
+func TestMemoryScan(t *testing.T) {
+	_, pool := newMemoryPool(t)
+	ctx := context.Background()
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(conn)
+
+	err = conn.CreateTableWithDesc(ctx, "event", []*th.TColumnFamilyDescriptor{
+		NewFamilyDescriptor("a"), NewFamilyDescriptor("b"),
+	}, [][]byte{[]byte("r3")}, defaultNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"r4", "r1", "r3", "r2"} {
+		err = conn.UpdateRow(ctx, "event", k, map[string]map[string][]byte{
+			"a": {"x": []byte(k + "x"), "y": []byte(k + "y")},
+			"b": {"z": []byte(k + "z")},
+		}, defaultNamespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = conn.DeleteColumns(ctx, "event", "r2", map[string][]string{"a": {"x", "y"}}, defaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := conn.ScanRows(ctx, "event", "r1", "r4", nil, 0, defaultNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, r := range rows {
+		keys = append(keys, r.RowKey)
+	}
+	if !reflect.DeepEqual(keys, []string{"r1", "r2", "r3"}) {
+		t.Fatalf("unexpected rows %v", keys)
+	}
+	if string(rows[0].Values["a"]["x"]) != "r1x" || rows[1].Values["a"] != nil {
+		t.Fatalf("unexpected values %v %v", rows[0].Values, rows[1].Values)
+	}
+
+	//只选择a列族,r2已经没有a列族的数据,不再返回
+	rows, err = conn.ScanRows(ctx, "event", "", "", map[string][]string{"a": nil}, 2, defaultNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].RowKey != "r1" || rows[1].RowKey != "r3" || rows[1].Values["b"] != nil {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+
+	locations, err := conn.GetRegionLocations(ctx, "event", defaultNamespace)
+	if err != nil || len(locations) != 2 || string(locations[0].RegionInfo.EndKey) != "r3" ||
+		string(locations[1].RegionInfo.StartKey) != "r3" {
+		t.Fatalf("unexpected locations %v, %v", locations, err)
+	}
+	if err = conn.TruncateTable(ctx, "event", false, defaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ = conn.ScanRows(ctx, "event", "", "", nil, 0, defaultNamespace); len(rows) != 0 {
+		t.Fatalf("expected empty table, got %d rows", len(rows))
+	}
+	if locations, _ = conn.GetRegionLocations(ctx, "event", defaultNamespace); len(locations) != 1 {
+		t.Fatalf("expected splits to be dropped, got %d regions", len(locations))
+	}
+}
+
+func TestMemorySharedStore(t *testing.T) {
+	_, pool := newMemoryPool(t)
+	ctx := context.Background()
+	c1, _ := pool.Get(ctx)
+	c2, _ := pool.Get(ctx)
+	defer pool.Put(c1)
+	defer pool.Put(c2)
+
+	if err := c1.CreateTable(ctx, "user", []string{"info"}, defaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.UpdateRow(ctx, "user", "r1", map[string]map[string][]byte{"info": {"k": []byte("v")}}, defaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+	m, err := c2.FetchRow(ctx, "user", "r1", map[string][]string{"info": {"k"}}, defaultNamespace)
+	if err != nil || string(m["k"]) != "v" {
+		t.Fatalf("unexpected value %q, %v", m["k"], err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = c2.FetchRow(cancelled, "user", "r1", nil, defaultNamespace); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMemoryConnConcurrentClose(t *testing.T) {
+	c := NewMemoryStore().NewConn("test")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = c.IsOpen()
+				_, _ = c.ExistTable(context.Background(), "user")
+			}
+		}()
+	}
+	c.Close()
+	wg.Wait()
+	if c.IsOpen() {
+		t.Fatal("connection should be closed")
+	}
+	if _, err := c.ExistTable(context.Background(), "user"); !errors.Is(err, MemoryConnClosedErr) {
+		t.Fatalf("expected MemoryConnClosedErr, got %v", err)
+	}
+}
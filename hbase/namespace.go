@@ -0,0 +1,110 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+// ListNameSpaces 列出所有的命名空间,按照名称排列
+func (hb *ThriftHbaseConn) ListNameSpaces(ctx context.Context) (_ []string, err error) {
+	defer hb.observe(ctx, OpListNameSpaces, "", time.Now(), &err)
+	list, err := retryCall(ctx, hb, true, func(ctx context.Context) ([]string, error) {
+		return hb.ServiceClient.ListNamespaces(ctx)
+	})
+	if err != nil {
+		return nil, hb.handleError(ctx, err)
+	}
+	slices.Sort(list)
+	return list, nil
+}
+
+// ExistNameSpace 命名空间是否存在
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) ExistNameSpace(ctx context.Context, namespace ...string) (_ bool, err error) {
+	defer hb.observe(ctx, OpExistNameSpace, "", time.Now(), &err, namespace...)
+	exist, err := hb.existNamespace(ctx, hb.getNamespace(namespace...))
+	if err != nil {
+		return false, hb.handleError(ctx, err)
+	}
+	return exist, nil
+}
+
+// GetNameSpaceProps 获取命名空间的配置,例如配额 hbase.namespace.quota.maxtables
+// 命名空间不存在时返回NSNotExistErr
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) GetNameSpaceProps(ctx context.Context, namespace ...string) (_ map[string]string, err error) {
+	defer hb.observe(ctx, OpGetNameSpaceProps, "", time.Now(), &err, namespace...)
+	desc, err := hb.namespaceDescriptor(ctx, hb.getNamespace(namespace...))
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string, len(desc.Configuration))
+	maps.Copy(props, desc.Configuration)
+	return props, nil
+}
+
+// ModifyNameSpace 使用 props 替换命名空间的全部配置,没有包含的配置项会被删除
+// 只修改部分配置时,需要先通过 GetNameSpaceProps 获取原有的配置再合并
+// 命名空间不存在时返回NSNotExistErr
+// namespace 为可选的命名空间参数，如果不提供则使用默认的 SpaceName
+func (hb *ThriftHbaseConn) ModifyNameSpace(ctx context.Context, props map[string]string, namespace ...string) (err error) {
+	defer hb.observe(ctx, OpModifyNameSpace, "", time.Now(), &err, namespace...)
+	ns := hb.getNamespace(namespace...)
+	if _, err = hb.namespaceDescriptor(ctx, ns); err != nil {
+		return err
+	}
+	err = hb.retry(ctx, false, func(ctx context.Context) error {
+		return hb.ServiceClient.ModifyNamespace(ctx,
+			&th.TNamespaceDescriptor{Name: ns, Configuration: props})
+	})
+	return hb.handleError(ctx, err)
+}
+
+// existNamespace 通过列出所有命名空间判断是否存在
+// 服务端对不存在的命名空间返回的异常信息只包含命名空间的名称,无法与其他异常区分,因此不依赖异常判断
+func (hb *ThriftHbaseConn) existNamespace(ctx context.Context, ns string) (bool, error) {
+	list, err := retryCall(ctx, hb, true, func(ctx context.Context) ([]string, error) {
+		return hb.ServiceClient.ListNamespaces(ctx)
+	})
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(list, ns), nil
+}
+
+// namespaceDescriptor 获取命名空间的描述,不存在时返回NSNotExistErr,其他错误已经经过 handleError 处理
+func (hb *ThriftHbaseConn) namespaceDescriptor(ctx context.Context, ns string) (*th.TNamespaceDescriptor, error) {
+	desc, err := retryCall(ctx, hb, true, func(ctx context.Context) (*th.TNamespaceDescriptor, error) {
+		return hb.ServiceClient.GetNamespaceDescriptor(ctx, ns)
+	})
+	if err == nil && desc != nil {
+		return desc, nil
+	}
+	//通讯异常直接返回,服务端异常需要确认命名空间是否存在
+	if err != nil && !isServerError(err) {
+		return nil, hb.handleError(ctx, err)
+	}
+	exist, e := hb.existNamespace(ctx, ns)
+	if e != nil {
+		return nil, hb.handleError(ctx, e)
+	}
+	if !exist {
+		return nil, NSNotExistErr
+	}
+	if err != nil {
+		return nil, hb.handleError(ctx, err)
+	}
+	return &th.TNamespaceDescriptor{Name: ns}, nil
+}
+
+// isServerError 是否为服务端返回的业务异常
+func isServerError(err error) bool {
+	var ioErr *th.TIOError
+	var illegalErr *th.TIllegalArgument
+	return errors.As(err, &ioErr) || errors.As(err, &illegalErr)
+}
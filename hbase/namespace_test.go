@@ -0,0 +1,117 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+// namespaceHandler 模拟服务端的命名空间管理,不存在时与HBase一致只返回命名空间的名称
+type namespaceHandler struct {
+	th.THBaseService
+
+	namespaces map[string]map[string]string
+}
+
+func (h *namespaceHandler) notFound(name string) error {
+	return &th.TIOError{Message: &name}
+}
+
+func (h *namespaceHandler) ListNamespaces(ctx context.Context) ([]string, error) {
+	list := make([]string, 0, len(h.namespaces))
+	for k := range h.namespaces {
+		list = append(list, k)
+	}
+	return list, nil
+}
+
+func (h *namespaceHandler) GetNamespaceDescriptor(ctx context.Context, name string) (*th.TNamespaceDescriptor, error) {
+	props, ok := h.namespaces[name]
+	if !ok {
+		return nil, h.notFound(name)
+	}
+	return &th.TNamespaceDescriptor{Name: name, Configuration: props}, nil
+}
+
+func (h *namespaceHandler) CreateNamespace(ctx context.Context, desc *th.TNamespaceDescriptor) error {
+	h.namespaces[desc.Name] = desc.Configuration
+	return nil
+}
+
+func (h *namespaceHandler) ModifyNamespace(ctx context.Context, desc *th.TNamespaceDescriptor) error {
+	if _, ok := h.namespaces[desc.Name]; !ok {
+		return h.notFound(desc.Name)
+	}
+	h.namespaces[desc.Name] = desc.Configuration
+	return nil
+}
+
+func (h *namespaceHandler) DeleteNamespace(ctx context.Context, name string) error {
+	delete(h.namespaces, name)
+	return nil
+}
+
+// checkNamespaceOps 对任意 Connection 实现验证命名空间的管理
+func checkNamespaceOps(t *testing.T, conn Connection) {
+	ctx := context.Background()
+	if exist, err := conn.ExistNameSpace(ctx, "ns1"); err != nil || exist {
+		t.Fatalf("unexpected exist %v, %v", exist, err)
+	}
+	if _, err := conn.GetNameSpaceProps(ctx, "ns1"); !errors.Is(err, NSNotExistErr) {
+		t.Fatalf("expected NSNotExistErr, got %v", err)
+	}
+	if err := conn.ModifyNameSpace(ctx, map[string]string{"k": "v"}, "ns1"); !errors.Is(err, NSNotExistErr) {
+		t.Fatalf("expected NSNotExistErr, got %v", err)
+	}
+	if err := conn.DeleteNameSpace(ctx, "ns1"); !errors.Is(err, NSNotExistErr) {
+		t.Fatalf("expected NSNotExistErr, got %v", err)
+	}
+	if err := conn.CreateNameSpace(ctx, "ns1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CreateNameSpace(ctx, "ns1"); !errors.Is(err, NSExistErr) {
+		t.Fatalf("expected NSExistErr, got %v", err)
+	}
+	list, err := conn.ListNameSpaces(ctx)
+	if err != nil || !reflect.DeepEqual(list, []string{"default", "hbase", "ns1"}) {
+		t.Fatalf("unexpected namespaces %v, %v", list, err)
+	}
+	props := map[string]string{"hbase.namespace.quota.maxtables": "10"}
+	if err = conn.ModifyNameSpace(ctx, props, "ns1"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := conn.GetNameSpaceProps(ctx, "ns1")
+	if err != nil || !reflect.DeepEqual(got, props) {
+		t.Fatalf("unexpected props %v, %v", got, err)
+	}
+	if err = conn.DeleteNameSpace(ctx, "ns1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	h := &namespaceHandler{namespaces: map[string]map[string]string{"default": nil, "hbase": nil}}
+	var requests atomic.Int32
+	srv := newThriftServer(h, 0, &requests)
+	defer srv.Close()
+	checkNamespaceOps(t, newRetryConn(t, srv.URL, nil, nil))
+}
+
+func TestMemoryNamespace(t *testing.T) {
+	checkNamespaceOps(t, NewMemoryStore().NewConn(defaultNamespace))
+}
+
+func TestNamespaceTransportError(t *testing.T) {
+	var requests atomic.Int32
+	srv := newFlakyServer(100, &requests)
+	defer srv.Close()
+	c := newRetryConn(t, srv.URL, fastRetry, nil)
+	_, err := c.GetNameSpaceProps(context.Background(), "ns1")
+	if err == nil || errors.Is(err, NSNotExistErr) || !c.IsBroken() {
+		t.Fatalf("transport failure should not look like a missing namespace: %v", err)
+	}
+}
@@ -2,12 +2,16 @@ package hbase
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
 	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/metrics"
 )
 
 //
@@ -17,36 +21,67 @@ import (
 
 var PoolClosedErr = errors.New("connection pool closed")
 
+const (
+	DefaultConnectTimeout = time.Second //默认的连接超时时间
+	DefaultSocketTimeout  = time.Second //默认的通讯超时时间
+
+	balanceInterval = 5 * time.Second //后台维护空闲连接的周期
+)
+
 // Connection 连接接口，按照业务需求定制
+// 所有方法的第一个参数为 context.Context，用于控制单次调用的超时与取消，并传递到底层的Thrift客户端
 // 所有表操作方法都支持可选的命名空间参数（通过可变参数传递）
 // 如果不提供命名空间参数，则使用连接创建时指定的默认命名空间
 type Connection interface {
-	CreateNameSpace(namespace ...string) error //创建表空间
-	DeleteNameSpace(namespace ...string) error //删除表空间
-
-	CreateTable(tableName string, familyNames []string, namespace ...string) error                      //创建表
-	CreateTableWithVer(tableName string, familyNames []string, maxVer int32, namespace ...string) error //创建表
-	ExistTable(tableName string, namespace ...string) (bool, error)                                     //表是否存在
-	DisableTable(tableName string, namespace ...string) error                                           //停用表
-	EnableTable(tableName string, namespace ...string) error                                            //启用表
-	DeleteTable(tableName string, namespace ...string) error                                            //删除表
-	ListAllTable(namespace ...string) ([]string, error)                                                 //列出所有的表名
-
-	UpdateRow(tableName, rowKey string, values map[string]map[string][]byte, namespace ...string) error                                   //更新存档
-	FetchRow(tableName, rowKey string, columnKeys map[string][]string, namespace ...string) (map[string][]byte, error)                    //获取存档
-	FetchRowByVer(tableName, rowKey string, columnKeys map[string][]string, maxVer int32, namespace ...string) (map[string][]byte, error) //获取存档
-	DeleteRow(tableName, rowKey string, namespace ...string) error                                                                        //删除存档
-	DeleteColumns(tableName, rowKey string, columnKeys map[string][]string, namespace ...string) error                                    //删除存档中的一些Key
-	ExistRow(tableName string, rowKey string, namespace ...string) (bool, error)
-
-	isOpen() bool                   //连接是否打开
-	open() error                    //打开连接
-	close()                         //关闭连接
-	isOverdue(t time.Duration) bool //是否超期
+	CreateNameSpace(ctx context.Context, namespace ...string) error                          //创建表空间
+	DeleteNameSpace(ctx context.Context, namespace ...string) error                          //删除表空间
+	ListNameSpaces(ctx context.Context) ([]string, error)                                    //列出所有的表空间
+	ExistNameSpace(ctx context.Context, namespace ...string) (bool, error)                   //表空间是否存在
+	GetNameSpaceProps(ctx context.Context, namespace ...string) (map[string]string, error)   //获取表空间的配置
+	ModifyNameSpace(ctx context.Context, props map[string]string, namespace ...string) error //替换表空间的配置
+
+	CreateTable(ctx context.Context, tableName string, familyNames []string, namespace ...string) error                      //创建表
+	CreateTableWithVer(ctx context.Context, tableName string, familyNames []string, maxVer int32, namespace ...string) error //创建表
+	ExistTable(ctx context.Context, tableName string, namespace ...string) (bool, error)                                     //表是否存在
+	DisableTable(ctx context.Context, tableName string, namespace ...string) error                                           //停用表
+	EnableTable(ctx context.Context, tableName string, namespace ...string) error                                            //启用表
+	DeleteTable(ctx context.Context, tableName string, namespace ...string) error                                            //删除表
+	ListAllTable(ctx context.Context, namespace ...string) ([]string, error)                                                 //列出所有的表名
+
+	CreateTableWithDesc(ctx context.Context, tableName string, families []*th.TColumnFamilyDescriptor, splitKeys [][]byte, namespace ...string) error //按照列族描述创建表,支持预分区
+	AddColumnFamily(ctx context.Context, tableName string, family *th.TColumnFamilyDescriptor, namespace ...string) error                             //增加列族
+	ModifyColumnFamily(ctx context.Context, tableName string, family *th.TColumnFamilyDescriptor, namespace ...string) error                          //修改列族
+	DeleteColumnFamily(ctx context.Context, tableName, familyName string, namespace ...string) error                                                  //删除列族
+	TruncateTable(ctx context.Context, tableName string, preserveSplits bool, namespace ...string) error                                              //清空表
+	GetTableDescriptor(ctx context.Context, tableName string, namespace ...string) (*th.TTableDescriptor, error)                                      //获取表的描述
+	IsTableAvailable(ctx context.Context, tableName string, namespace ...string) (bool, error)                                                        //表是否可用
+	ListTableByPattern(ctx context.Context, regex string, includeSysTables bool) ([]string, error)                                                    //按照正则列出表名
+	GetRegionLocations(ctx context.Context, tableName string, namespace ...string) ([]*th.THRegionLocation, error)                                    //获取region的位置
+
+	UpdateRow(ctx context.Context, tableName, rowKey string, values map[string]map[string][]byte, namespace ...string) error                                   //更新存档
+	FetchRow(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, namespace ...string) (map[string][]byte, error)                    //获取存档
+	FetchRowByVer(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, maxVer int32, namespace ...string) (map[string][]byte, error) //获取存档
+	DeleteRow(ctx context.Context, tableName, rowKey string, namespace ...string) error                                                                        //删除存档
+	DeleteColumns(ctx context.Context, tableName, rowKey string, columnKeys map[string][]string, namespace ...string) error                                    //删除存档中的一些Key
+	ExistRow(ctx context.Context, tableName string, rowKey string, namespace ...string) (bool, error)
+	ScanRows(ctx context.Context, tableName, startRow, stopRow string, columnKeys map[string][]string, limit int, namespace ...string) ([]*Row, error) //按照范围扫描
+
+	Lifecycle
+}
+
+// Lifecycle 连接的生命周期管理,由连接池负责调用,业务代码不需要直接使用
+// 自定义的 Connection 实现(例如测试用的假连接)需要实现这些方法
+type Lifecycle interface {
+	IsOpen() bool                   //连接是否打开
+	Open() error                    //打开连接
+	Close()                         //关闭连接
+	IsOverdue(t time.Duration) bool //是否超期
+	IsBroken() bool                 //调用过程中通讯链路是否出现过异常
+	Ping(ctx context.Context) error //检测连接是否可用
 }
 
 // ConnFactory 创建连接资源的工厂方法
-type ConnFactory func(url, user, passwd, spaceName string) (Connection, error)
+type ConnFactory func(conf *PoolConf) (Connection, error)
 
 // CommonConn 连接结构体，
 type CommonConn struct {
@@ -54,18 +89,98 @@ type CommonConn struct {
 	idleTime time.Time  //开始空闲的时间
 }
 
+// connRequest 等待连接的请求结果,由归还连接或者新建连接的一方投递
+type connRequest struct {
+	conn   *CommonConn
+	reused bool // 连接是其他调用方归还的,而不是新建的
+	err    error
+}
+
 // ConnectionPool 连接池
+// 所有状态都由mutex保护,获取不到连接的请求按照先来先服务的顺序排队,
+// 有连接归还时直接交给最早的等待者
 type ConnectionPool struct {
-	mutex       sync.Mutex       // 互斥量，用于并发访问控制
-	cons        chan *CommonConn // 实际的“池”，用一个通道保存连接
-	connFactory ConnFactory      // 创建连接的工厂方法
-	closed      bool             // 连接池是否关闭
-	conf        *PoolConf        // 连接池的配置参数
-	inUsed      int32            //正在被用的连接数
-	notify      chan struct{}    //获取不到连接时候的通知
+	mutex       sync.Mutex         // 互斥量，用于并发访问控制
+	idle        []*CommonConn      // 空闲的连接,末尾为最近归还的连接
+	waiters     []chan connRequest // 等待连接的请求队列
+	connFactory ConnFactory        // 创建连接的工厂方法
+	closed      bool               // 连接池是否关闭
+	conf        *PoolConf          // 连接池的配置参数
+	numOpen     int                // 已经打开的连接数,包括空闲、在用以及正在创建的连接
+	inUsed      int                // 正在被用的连接数
+	stop        chan struct{}      // 关闭时通知后台维护协程退出
+	drained     chan struct{}      // 关闭后所有连接都释放完毕时关闭
+
+	waitCount    int64         // 排队等待连接的总次数
+	waitDuration time.Duration // 排队等待连接的总时长
+	timeouts     int64         // 排队等待超时或者取消的次数
+	created      atomic.Int64  // 创建的连接总数
+	closedCount  atomic.Int64  // 关闭的连接总数
 }
 
-func newConnPool(factory func(url, user, passwd, spaceName string) (Connection, error), conf *PoolConf) *ConnectionPool {
+// PoolStats 连接池的统计信息快照
+type PoolStats struct {
+	MaxOpen int // 最大连接数
+	Open    int // 已经打开的连接数,包括空闲、在用以及正在创建的连接
+	Idle    int // 空闲的连接数
+	InUse   int // 正在被用的连接数
+
+	Created      int64         // 创建的连接总数
+	Closed       int64         // 关闭的连接总数
+	WaitCount    int64         // 排队等待连接的总次数
+	WaitDuration time.Duration // 排队等待连接的总时长
+	Timeouts     int64         // 排队等待超时或者取消的次数
+}
+
+// Stats 获取连接池当前的统计信息
+func (pool *ConnectionPool) Stats() PoolStats {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return PoolStats{
+		MaxOpen:      pool.conf.MaxOpenSize,
+		Open:         pool.numOpen,
+		Idle:         len(pool.idle),
+		InUse:        pool.inUsed,
+		Created:      pool.created.Load(),
+		Closed:       pool.closedCount.Load(),
+		WaitCount:    pool.waitCount,
+		WaitDuration: pool.waitDuration,
+		Timeouts:     pool.timeouts,
+	}
+}
+
+// HealthCheck 从连接池中获取一个连接并检测是否可用,可以注册到 server.Health
+func (pool *ConnectionPool) HealthCheck(ctx context.Context) error {
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if err = conn.Ping(ctx); err != nil {
+		pool.Discard(conn)
+		return err
+	}
+	return pool.Put(conn)
+}
+
+// RegisterMetrics 将连接池的统计信息注册到 reg,name 用于区分多个连接池
+func (pool *ConnectionPool) RegisterMetrics(reg *metrics.Registry, name string) {
+	metrics.RegisterPool(reg, "hbase", name, func() metrics.PoolStats {
+		st := pool.Stats()
+		return metrics.PoolStats{
+			MaxOpen:      st.MaxOpen,
+			Open:         st.Open,
+			Idle:         st.Idle,
+			InUse:        st.InUse,
+			WaitCount:    st.WaitCount,
+			WaitDuration: st.WaitDuration,
+			Created:      st.Created,
+			Closed:       st.Closed,
+			Timeouts:     st.Timeouts,
+		}
+	})
+}
+
+func newConnPool(factory ConnFactory, conf *PoolConf) *ConnectionPool {
 	if conf.MaxOpenSize <= 0 {
 		conf.MaxOpenSize = 50
 	}
@@ -74,184 +189,384 @@ func newConnPool(factory func(url, user, passwd, spaceName string) (Connection,
 	}
 	// 如果最大空闲时间等于0,则无须考虑这个值
 	if conf.MaxIdleTime < 0 {
-		conf.MaxIdleTime = 600
+		conf.MaxIdleTime = 600 * time.Second
 	}
 	if conf.MinIdleSize >= conf.MaxOpenSize {
 		conf.MinIdleSize = conf.MaxOpenSize
 	}
+	if conf.MaxIdleSize <= 0 || conf.MaxIdleSize > conf.MaxOpenSize {
+		conf.MaxIdleSize = conf.MaxOpenSize
+	}
+	if conf.MaxIdleSize < conf.MinIdleSize {
+		conf.MaxIdleSize = conf.MinIdleSize
+	}
+	if conf.ConnectTimeout <= 0 {
+		conf.ConnectTimeout = DefaultConnectTimeout
+	}
+	if conf.SocketTimeout <= 0 {
+		conf.SocketTimeout = DefaultSocketTimeout
+	}
 	// 参数检查后，设置连接池属性
 	cp := &ConnectionPool{
-		mutex:       sync.Mutex{},
-		cons:        make(chan *CommonConn, conf.MaxOpenSize),
+		idle:        make([]*CommonConn, 0, conf.MaxIdleSize),
 		connFactory: factory,
 		closed:      false, //连接池是否关闭状态
 		conf:        conf,
-		notify:      make(chan struct{}),
+		stop:        make(chan struct{}),
+		drained:     make(chan struct{}),
 	}
 	//初始化连接池中的基本连接
 	for i := 0; i < conf.MinIdleSize; i++ {
-		connRes, err := cp.connFactory(conf.Address, conf.User, conf.Passwd, conf.SpaceName)
+		connRes, err := cp.connFactory(conf)
 		//如果启动的时候都无法创建连接,说明问题严重
 		if err != nil {
 			cp.Close()
 			panic("error in newConnPool while calling connFactory")
 		}
-		cp.cons <- &CommonConn{conn: connRes, idleTime: time.Now()} // 连接放入池中
+		cp.numOpen++
+		cp.created.Add(1)
+		cp.idle = append(cp.idle, &CommonConn{conn: connRes, idleTime: time.Now()}) // 连接放入池中
 	}
 	go cp.balanceControl()
-	//go cp.addNewConnection()
 	return cp
 }
 
-// addNewConnection 异步增加一个新的连接
-//func (cp *ConnectionPool) addNewConnection() {
-//	for {
-//		<-cp.notify
-//		if cp.closed {
-//			break
-//		}
-//		used := int(cp.inUsed)
-//		idled := len(cp.cons)
-//		//未超过最大限制
-//		if used+idled < cp.conf.MaxOpenSize {
-//			connRes, err := cp.connFactory(cp.conf.Address, cp.conf.User, cp.conf.Passwd)
-//			if err != nil {
-//				log.Errorf("error in newConnPool while calling connFactory %v", err)
-//				continue
-//			}
-//			if cp.closed {
-//				connRes.close() //不要忘记关闭
-//				break
-//			}
-//			cp.cons <- &CommonConn{conn: connRes, idleTime: time.Now()} // 连接放入池中
-//		}
-//	}
-//}
-
-// balanceControl 当发现总体连接降低到最小值的时候,补充新的连接
+// balanceControl 定时清理过期、多余的空闲连接,并在空闲连接不足时补充新的连接
 func (pool *ConnectionPool) balanceControl() {
+	ticker := time.NewTicker(balanceInterval)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-time.After(5 * time.Second):
-		case <-pool.notify: //紧急通知需要增加连接
+		case <-pool.stop:
+			return
+		case <-ticker.C:
+			pool.balance()
 		}
-		//如果连接池已经关闭,则直接退出
-		if pool.closed {
-			break
+	}
+}
+
+// balance 执行一次空闲连接的维护
+func (pool *ConnectionPool) balance() {
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		return
+	}
+	var stale []*CommonConn
+	kept := pool.idle[:0]
+	for _, cc := range pool.idle {
+		if pool.isExpired(cc) {
+			stale = append(stale, cc)
+		} else {
+			kept = append(kept, cc)
 		}
-		used := int(pool.inUsed)
-		idled := len(pool.cons)
-		//未超过最大限制 宾缺
-		if used+idled < pool.conf.MaxOpenSize && idled < pool.conf.MinIdleSize {
-			if log.IsDebug() {
-				log.Debugf("current idled too little: %d", idled)
-				log.Debugf("current used: %d", used)
-			}
-			connRes, err := pool.connFactory(pool.conf.Address,
-				pool.conf.User, pool.conf.Passwd, pool.conf.SpaceName)
-			if err != nil {
-				log.Errorf("error in newConnPool while calling connFactory %v", err)
-				continue
-			}
-			if pool.closed {
-				connRes.close() //不要忘记关闭
-				break
-			}
-			pool.cons <- &CommonConn{conn: connRes, idleTime: time.Now()} // 连接放入池中
-			continue
+	}
+	clear(pool.idle[len(kept):])
+	pool.idle = kept
+	// 空闲连接过多,优先关闭空闲最久的连接
+	if excess := len(pool.idle) - pool.conf.MaxIdleSize; excess > 0 {
+		stale = append(stale, pool.idle[:excess]...)
+		pool.idle = append(pool.idle[:0], pool.idle[excess:]...)
+	}
+	pool.numOpen -= len(stale)
+	// 空闲连接不足,在不超过最大连接数的前提下补充
+	need := min(pool.conf.MinIdleSize-len(pool.idle), pool.conf.MaxOpenSize-pool.numOpen)
+	if need > 0 {
+		pool.numOpen += need
+	}
+	idled, used := len(pool.idle), pool.inUsed
+	pool.mutex.Unlock()
+
+	if log.IsDebug() && (len(stale) > 0 || need > 0) {
+		log.Debugf("hbase pool balance, idle: %d, used: %d, closed: %d, added: %d",
+			idled, used, len(stale), max(need, 0))
+	}
+	pool.closeConns(stale)
+	for i := 0; i < need; i++ {
+		pool.openNewConn()
+	}
+}
+
+// openNewConn 新建一个连接,调用前需要先占用numOpen的名额
+func (pool *ConnectionPool) openNewConn() {
+	conn, err := pool.connFactory(pool.conf)
+	pool.mutex.Lock()
+	if err != nil {
+		pool.numOpen--
+		// 创建失败,将错误交给最早的等待者,避免其一直等待
+		if req := pool.popWaiterLocked(); req != nil {
+			req <- connRequest{err: err}
 		}
-		if idled > pool.conf.MaxIdleSize {
-			if log.IsDebug() {
-				log.Debugf("current idled too much: %d", idled)
-				log.Debugf("current used: %d", used)
-			}
-			select {
-			case hbaseConn, ok := <-pool.cons:
-				if !ok {
-					// channel 已关闭，退出循环
-					return
-				}
-				hbaseConn.conn.close()
-			default:
-				// 没有可用的连接，继续
-			}
+		pool.checkDrainedLocked()
+		pool.mutex.Unlock()
+		log.Errorf("error in hbase pool while calling connFactory %v", err)
+		return
+	}
+	pool.created.Add(1)
+	keep := pool.deliverLocked(&CommonConn{conn: conn, idleTime: time.Now()}, false)
+	pool.mutex.Unlock()
+	if !keep {
+		pool.closeConn(conn)
+	}
+}
+
+// deliverLocked 将一个可用的连接交给最早的等待者,没有等待者则放入空闲列表
+// reused 表示连接是归还的而不是新建的,返回false表示连接无法保留,需要调用方在锁外关闭
+func (pool *ConnectionPool) deliverLocked(cc *CommonConn, reused bool) bool {
+	if pool.closed {
+		pool.numOpen--
+		pool.checkDrainedLocked()
+		return false
+	}
+	if req := pool.popWaiterLocked(); req != nil {
+		pool.inUsed++
+		req <- connRequest{conn: cc, reused: reused}
+		return true
+	}
+	if len(pool.idle) < pool.conf.MaxIdleSize {
+		pool.idle = append(pool.idle, cc)
+		return true
+	}
+	pool.numOpen--
+	return false
+}
+
+// releaseLocked 释放一个在用连接占用的名额,如果有请求在等待,则为其新建连接
+func (pool *ConnectionPool) releaseLocked() {
+	pool.inUsed--
+	pool.numOpen--
+	if !pool.closed && len(pool.waiters) > 0 && pool.numOpen < pool.conf.MaxOpenSize {
+		pool.numOpen++
+		go pool.openNewConn()
+	}
+	pool.checkDrainedLocked()
+}
+
+// popWaiterLocked 取出最早的等待者
+func (pool *ConnectionPool) popWaiterLocked() chan connRequest {
+	if len(pool.waiters) == 0 {
+		return nil
+	}
+	req := pool.waiters[0]
+	pool.waiters[0] = nil
+	pool.waiters = pool.waiters[1:]
+	return req
+}
+
+// removeWaiterLocked 从等待队列中移除一个请求,返回false表示该请求已经被投递过了
+func (pool *ConnectionPool) removeWaiterLocked(req chan connRequest) bool {
+	for i, w := range pool.waiters {
+		if w == req {
+			pool.waiters = append(pool.waiters[:i], pool.waiters[i+1:]...)
+			return true
 		}
 	}
+	return false
+}
+
+// checkDrainedLocked 连接池关闭后,所有连接都已经释放时通知等待关闭的一方
+func (pool *ConnectionPool) checkDrainedLocked() {
+	if pool.closed && pool.numOpen == 0 {
+		select {
+		case <-pool.drained:
+		default:
+			close(pool.drained)
+		}
+	}
+}
+
+// isExpired 判断空闲连接是否超过最大空闲时间或者最大生命周期
+func (pool *ConnectionPool) isExpired(cc *CommonConn) bool {
+	if pool.conf.MaxIdleTime > 0 && time.Since(cc.idleTime) > pool.conf.MaxIdleTime {
+		return true
+	}
+	return pool.conf.MaxLifeTime > 0 && cc.conn.IsOverdue(pool.conf.MaxLifeTime)
+}
+
+// closeConns 在锁外关闭一批连接
+func (pool *ConnectionPool) closeConns(list []*CommonConn) {
+	for _, cc := range list {
+		pool.closeConn(cc.conn)
+	}
+}
+
+// closeConn 在锁外关闭一个连接
+func (pool *ConnectionPool) closeConn(conn Connection) {
+	pool.closedCount.Add(1)
+	conn.Close()
 }
 
 // Get 从连接池中获取一个连接
-func (pool *ConnectionPool) Get(ctx context.Context) (conn Connection, err error) {
+// 没有空闲连接并且已经达到最大连接数时,按照先后顺序排队等待,直到有连接归还或者ctx结束
+func (pool *ConnectionPool) Get(ctx context.Context) (Connection, error) {
+	for {
+		cc, reused, err := pool.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = pool.prepare(ctx, cc.conn, reused)
+		if err == nil {
+			return cc.conn, nil
+		}
+		pool.Discard(cc.conn)
+		// 复用的空闲连接不可用,丢弃后继续获取;新建的连接不可用则直接返回错误
+		if !reused {
+			return nil, err
+		}
+		log.Errorf("discard invalid hbase connection: %v", err)
+	}
+}
+
+// acquire 获取一个连接,reused表示该连接来自空闲列表或者由其他调用方归还后直接转交
+func (pool *ConnectionPool) acquire(ctx context.Context) (cc *CommonConn, reused bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	pool.mutex.Lock()
 	if pool.closed {
-		return nil, PoolClosedErr
+		pool.mutex.Unlock()
+		return nil, false, PoolClosedErr
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		//如果连接池中有连接可以用
-		case hbaseConn, ok := <-pool.cons:
-			if !ok { //判断存放连接的chan是否关闭
-				return nil, PoolClosedErr
-			}
-			// 拿到的连接已经超时，将其关闭，继续取下一个
-			if time.Since(hbaseConn.idleTime) > pool.conf.MaxIdleTime ||
-				(pool.conf.MaxIdleTime != 0 && hbaseConn.conn.isOverdue(pool.conf.MaxIdleTime)) {
-				hbaseConn.conn.close()
-				continue
-			}
-			//成功从连接池中获取到一个连接,增加一个在用的连接
-			atomic.AddInt32(&pool.inUsed, 1)
-			conn, err = hbaseConn.conn, nil
-			goto prepare
-		case <-time.After(50 * time.Millisecond):
-			//超时后发送通知,告知平衡控制需要增加连接
-			{
-				pool.notify <- struct{}{}
-			}
+	// 优先使用最近归还的空闲连接,过期的连接直接关闭
+	var stale []*CommonConn
+	defer func() { pool.closeConns(stale) }()
+	for n := len(pool.idle); n > 0; n = len(pool.idle) {
+		cc = pool.idle[n-1]
+		pool.idle[n-1] = nil
+		pool.idle = pool.idle[:n-1]
+		if pool.isExpired(cc) {
+			pool.numOpen--
+			stale = append(stale, cc)
+			continue
+		}
+		pool.inUsed++
+		pool.mutex.Unlock()
+		return cc, true, nil
+	}
+	// 未达到最大连接数,直接新建
+	if pool.numOpen < pool.conf.MaxOpenSize {
+		pool.numOpen++
+		pool.inUsed++
+		pool.mutex.Unlock()
+		conn, err := pool.connFactory(pool.conf)
+		if err != nil {
+			pool.mutex.Lock()
+			pool.releaseLocked()
+			pool.mutex.Unlock()
+			return nil, false, err
 		}
+		pool.created.Add(1)
+		return &CommonConn{conn: conn, idleTime: time.Now()}, false, nil
 	}
-prepare: // 统一在此处进行链路的处理
-	if conn != nil {
-		//判断通讯链路是否是打开的
-		if !conn.isOpen() {
-			if err = conn.open(); err != nil {
-				return
+	// 排队等待
+	req := make(chan connRequest, 1)
+	pool.waiters = append(pool.waiters, req)
+	pool.waitCount++
+	pool.mutex.Unlock()
+
+	start := time.Now()
+	defer func() {
+		pool.mutex.Lock()
+		pool.waitDuration += time.Since(start)
+		pool.mutex.Unlock()
+	}()
+	select {
+	case <-ctx.Done():
+		pool.mutex.Lock()
+		removed := pool.removeWaiterLocked(req)
+		pool.timeouts++
+		pool.mutex.Unlock()
+		if !removed {
+			// 在取消的同时已经拿到了连接,将其归还
+			if r := <-req; r.conn != nil {
+				_ = pool.Put(r.conn.conn)
 			}
 		}
+		return nil, false, ctx.Err()
+	case r := <-req:
+		if r.err != nil {
+			return nil, false, r.err
+		}
+		return r.conn, r.reused, nil
 	}
-	return
+}
+
+// prepare 统一在此处进行链路的处理,复用的连接在配置了TestOnBorrow时进行可用性检测
+func (pool *ConnectionPool) prepare(ctx context.Context, conn Connection, reused bool) error {
+	//判断通讯链路是否是打开的
+	if !conn.IsOpen() {
+		if err := conn.Open(); err != nil {
+			return err
+		}
+	}
+	if reused && pool.conf.TestOnBorrow {
+		return conn.Ping(ctx)
+	}
+	return nil
 }
 
 // Put 用完归还一个连接到连接池
+// 调用过程中出现通讯异常或者超过最大生命周期的连接会被直接关闭
 func (pool *ConnectionPool) Put(conn Connection) error {
-	if pool.closed {
-		return PoolClosedErr
-	}
-	//在用的连接减少
-	atomic.AddInt32(&pool.inUsed, -1)
-	select {
-	//将连接放回到池子中，更新时间
-	case pool.cons <- &CommonConn{conn: conn, idleTime: time.Now()}:
-		return nil
-	default:
-		conn.close() // 连接池已满，无法放入资源，将这个连接关闭
+	if conn.IsBroken() ||
+		(pool.conf.MaxLifeTime > 0 && conn.IsOverdue(pool.conf.MaxLifeTime)) {
+		pool.Discard(conn)
 		return nil
 	}
+	pool.mutex.Lock()
+	pool.inUsed--
+	closed := pool.closed
+	keep := pool.deliverLocked(&CommonConn{conn: conn, idleTime: time.Now()}, true)
+	pool.mutex.Unlock()
+	if !keep {
+		pool.closeConn(conn) // 连接池已满或者已经关闭，将这个连接关闭
+	}
+	if closed {
+		return PoolClosedErr
+	}
+	return nil
+}
+
+// Discard 丢弃一个已经损坏的连接,不再放回连接池
+func (pool *ConnectionPool) Discard(conn Connection) {
+	pool.mutex.Lock()
+	pool.releaseLocked()
+	pool.mutex.Unlock()
+	pool.closeConn(conn)
 }
 
 // Close 关闭连接池
+// 空闲连接立即关闭,排队中的请求返回PoolClosedErr,在用的连接在归还时关闭
 func (pool *ConnectionPool) Close() {
+	pool.mutex.Lock()
 	if pool.closed {
+		pool.mutex.Unlock()
 		return
 	}
-	pool.mutex.Lock()
-	defer pool.mutex.Unlock()
-
 	pool.closed = true
-	close(pool.notify)
-	close(pool.cons) // 关闭通道，即连接“池”
-	for conn := range pool.cons {
-		conn.conn.close()
+	close(pool.stop)
+	idle := pool.idle
+	pool.idle = nil
+	pool.numOpen -= len(idle)
+	waiters := pool.waiters
+	pool.waiters = nil
+	for _, req := range waiters {
+		req <- connRequest{err: PoolClosedErr}
+	}
+	pool.checkDrainedLocked()
+	pool.mutex.Unlock()
+
+	pool.closeConns(idle)
+}
+
+// Shutdown 关闭连接池,并等待所有借出的连接归还,直到ctx结束
+func (pool *ConnectionPool) Shutdown(ctx context.Context) error {
+	pool.Close()
+	select {
+	case <-pool.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -264,11 +579,26 @@ type PoolConf struct {
 	User      string //用户名
 	Passwd    string //密码
 
-	MinIdleSize int           //最小空闲数
-	MaxIdleSize int           //最大空闲数
-	MaxOpenSize int           //最大连接数,总体不能超过这个
-	MaxIdleTime time.Duration //最大空闲时间
-	MaxLifeTime time.Duration //最大生命周期
+	MinIdleSize  int           //最小空闲数
+	MaxIdleSize  int           //最大空闲数,默认等于最大连接数
+	MaxOpenSize  int           //最大连接数,总体不能超过这个
+	MaxIdleTime  time.Duration //最大空闲时间,为0时不限制
+	MaxLifeTime  time.Duration //最大生命周期,为0时不限制
+	TestOnBorrow bool          //借出空闲连接时是否检测其可用性
+
+	OpHooks []OpHook //每次操作完成后的回调,可以用于日志或者监控
+
+	Retry      *RetryPolicy //幂等操作(查询、删除等)的重试策略,为nil时使用DefaultRetryPolicy
+	WriteRetry *RetryPolicy //非幂等操作(写入、建表等)的重试策略,为nil时不重试
+
+	ConnectTimeout time.Duration //建立连接的超时时间,默认1秒
+	SocketTimeout  time.Duration //单次请求的通讯超时时间,默认1秒,context中的deadline同样生效
+
+	Transport  TransportType     //通讯方式,默认为HTTP,TCP方式时 Address 的格式为 host:port
+	Protocol   ProtocolType      //序列化协议,默认为二进制协议
+	TLSConfig  *tls.Config       //不为nil时启用TLS,HTTP方式只在没有设置 HttpClient 时生效
+	Headers    map[string]string //HTTP方式额外的请求头,同名时覆盖 ACCESSKEYID、ACCESSSIGNATURE
+	HttpClient *http.Client      //HTTP方式自定义的客户端(代理、keep-alive等),为nil时根据超时配置生成,设置后超时需要自行配置
 }
 
 func NewPoolByParam(spaceName, address, user, passwd string, minIdleSize, maxIdleSize,
@@ -297,6 +627,11 @@ func NewPoolByCfg(poolCfg *PoolConf) *ConnectionPool {
 	return newConnPool(thriftHBaseConnFactory, poolCfg)
 }
 
+// NewPoolByFactory 使用自定义的连接工厂构建连接池,例如测试时使用 MemoryStore.ConnFactory
+func NewPoolByFactory(factory ConnFactory, poolCfg *PoolConf) *ConnectionPool {
+	return newConnPool(factory, poolCfg)
+}
+
 func (pool *ConnectionPool) GetConn(ctx context.Context) (Connection, error) {
 	return pool.Get(ctx)
 }
@@ -0,0 +1,464 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/metrics"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "hbase_test")
+	if err != nil {
+		panic(err)
+	}
+	logFile := filepath.Join(dir, "zap.json")
+	config := `{"level": "error", "logs": [
+		{"logpath": "` + filepath.Join(dir, "debug.log") + `", "name": "debug"},
+		{"logpath": "` + filepath.Join(dir, "info.log") + `", "name": "info"},
+		{"logpath": "` + filepath.Join(dir, "error.log") + `", "name": "error"},
+		{"logpath": "` + filepath.Join(dir, "warn.log") + `", "name": "warn"}]}`
+	if err = os.WriteFile(logFile, []byte(config), 0644); err != nil {
+		panic(err)
+	}
+	log.SetLogConf(&logFile)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeConn 用于测试连接池的假连接,只实现生命周期相关的逻辑
+type fakeConn struct {
+	Connection // 业务方法在连接池测试中不会被调用
+
+	id        int64
+	created   time.Time
+	closed    atomic.Bool
+	broken    atomic.Bool
+	pingFails atomic.Bool
+}
+
+func (c *fakeConn) IsOpen() bool { return !c.closed.Load() }
+func (c *fakeConn) Open() error  { return nil }
+func (c *fakeConn) Close()       { c.closed.Store(true) }
+func (c *fakeConn) IsOverdue(t time.Duration) bool {
+	return time.Since(c.created) > t
+}
+func (c *fakeConn) IsBroken() bool { return c.broken.Load() }
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if c.pingFails.Load() {
+		return errors.New("ping failed")
+	}
+	return nil
+}
+
+// fakeFactory 记录创建的连接
+type fakeFactory struct {
+	mutex sync.Mutex
+	conns []*fakeConn
+	fail  atomic.Bool
+}
+
+func (f *fakeFactory) create(conf *PoolConf) (Connection, error) {
+	if f.fail.Load() {
+		return nil, errors.New("factory failed")
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	c := &fakeConn{id: int64(len(f.conns)), created: time.Now()}
+	f.conns = append(f.conns, c)
+	return c, nil
+}
+
+func (f *fakeFactory) created() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.conns)
+}
+
+func (f *fakeFactory) openConns() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	n := 0
+	for _, c := range f.conns {
+		if !c.closed.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+func newTestPool(f *fakeFactory, conf *PoolConf) *ConnectionPool {
+	if conf == nil {
+		conf = &PoolConf{MinIdleSize: 1, MaxIdleSize: 2, MaxOpenSize: 2}
+	}
+	return newConnPool(f.create, conf)
+}
+
+func TestPoolReuse(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, nil)
+	defer pool.Close()
+
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pool.Put(conn); err != nil {
+		t.Fatal(err)
+	}
+	again, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != conn {
+		t.Fatal("idle connection should be reused")
+	}
+	_ = pool.Put(again)
+	if f.created() != 1 {
+		t.Fatalf("expect 1 connection created, got %d", f.created())
+	}
+}
+
+func TestPoolWaitersFIFO(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, nil)
+	defer pool.Close()
+
+	c1, _ := pool.Get(context.Background())
+	c2, _ := pool.Get(context.Background())
+
+	got := make([]chan Connection, 3)
+	for i := range got {
+		got[i] = make(chan Connection, 1)
+		go func(i int) {
+			conn, err := pool.Get(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			got[i] <- conn
+		}(i)
+		//保证等待者按照顺序入队
+		waitFor(t, func() bool {
+			pool.mutex.Lock()
+			defer pool.mutex.Unlock()
+			return len(pool.waiters) == i+1
+		})
+	}
+	//归还的连接依次交给最早的等待者
+	for i, conn := range []Connection{c1, c2} {
+		_ = pool.Put(conn)
+		if c := <-got[i]; c != conn {
+			t.Fatalf("waiter %d should get the returned connection", i)
+		}
+	}
+	_ = pool.Put(c1)
+	_ = pool.Put(<-got[2])
+	_ = pool.Put(c2)
+	if f.created() != 2 {
+		t.Fatalf("max open size exceeded, created %d", f.created())
+	}
+}
+
+func TestPoolGetTimeout(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 1, MaxOpenSize: 1})
+	defer pool.Close()
+
+	conn, _ := pool.Get(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	pool.mutex.Lock()
+	waiters := len(pool.waiters)
+	pool.mutex.Unlock()
+	if waiters != 0 {
+		t.Fatal("cancelled waiter should be removed from queue")
+	}
+	_ = pool.Put(conn)
+}
+
+func TestPoolMaxLifeTime(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 1, MaxOpenSize: 2, MaxLifeTime: 20 * time.Millisecond})
+	defer pool.Close()
+
+	time.Sleep(30 * time.Millisecond)
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.(*fakeConn).id == 0 {
+		t.Fatal("overdue connection should not be borrowed")
+	}
+	if !f.conns[0].closed.Load() {
+		t.Fatal("overdue connection should be closed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	_ = pool.Put(conn)
+	if !conn.(*fakeConn).closed.Load() {
+		t.Fatal("overdue connection should be closed on put")
+	}
+}
+
+func TestPoolTestOnBorrow(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 1, MaxOpenSize: 2, TestOnBorrow: true})
+	defer pool.Close()
+
+	f.conns[0].pingFails.Store(true)
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn == Connection(f.conns[0]) {
+		t.Fatal("invalid connection should not be borrowed")
+	}
+	if !f.conns[0].closed.Load() {
+		t.Fatal("invalid connection should be closed")
+	}
+	_ = pool.Put(conn)
+}
+
+// TestPoolTestOnBorrowHandOff 归还时直接转交给等待者的连接同样需要检测
+func TestPoolTestOnBorrowHandOff(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 1, MaxOpenSize: 1, TestOnBorrow: true})
+	defer pool.Close()
+
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan Connection, 1)
+	go func() {
+		c, err := pool.Get(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		got <- c
+	}()
+	waitFor(t, func() bool {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		return len(pool.waiters) == 1
+	})
+	conn.(*fakeConn).pingFails.Store(true)
+	_ = pool.Put(conn)
+	select {
+	case c := <-got:
+		if c == conn || !conn.(*fakeConn).closed.Load() {
+			t.Fatal("invalid connection should not be handed off")
+		}
+		_ = pool.Put(c)
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken up")
+	}
+}
+
+func TestPoolDiscardBroken(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 1, MaxOpenSize: 1})
+	defer pool.Close()
+
+	conn, _ := pool.Get(context.Background())
+	conn.(*fakeConn).broken.Store(true)
+	_ = pool.Put(conn)
+	if !conn.(*fakeConn).closed.Load() {
+		t.Fatal("broken connection should be closed")
+	}
+	//名额被释放,可以重新创建连接
+	next, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Discard(next)
+	if !next.(*fakeConn).closed.Load() {
+		t.Fatal("discarded connection should be closed")
+	}
+}
+
+func TestPoolDiscardWakesWaiter(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 1, MaxOpenSize: 1})
+	defer pool.Close()
+
+	conn, _ := pool.Get(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		c, err := pool.Get(context.Background())
+		if err == nil {
+			_ = pool.Put(c)
+		}
+		done <- err
+	}()
+	waitFor(t, func() bool {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		return len(pool.waiters) == 1
+	})
+	pool.Discard(conn)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken up after discard")
+	}
+}
+
+func TestPoolShutdownDrain(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, nil)
+
+	c1, _ := pool.Get(context.Background())
+	c2, _ := pool.Get(context.Background())
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := pool.Get(context.Background())
+		waiting <- err
+	}()
+	waitFor(t, func() bool {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		return len(pool.waiters) == 1
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown should wait for borrowed connections, got %v", err)
+	}
+	if err := <-waiting; !errors.Is(err, PoolClosedErr) {
+		t.Fatalf("waiter should get PoolClosedErr, got %v", err)
+	}
+	if _, err := pool.Get(context.Background()); !errors.Is(err, PoolClosedErr) {
+		t.Fatalf("expect PoolClosedErr, got %v", err)
+	}
+
+	if err := pool.Put(c1); !errors.Is(err, PoolClosedErr) {
+		t.Fatalf("expect PoolClosedErr, got %v", err)
+	}
+	pool.Discard(c2)
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.openConns(); n != 0 {
+		t.Fatalf("expect all connections closed, %d still open", n)
+	}
+}
+
+func TestPoolBalance(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 2, MaxIdleSize: 3, MaxOpenSize: 5, MaxIdleTime: 20 * time.Millisecond})
+	defer pool.Close()
+
+	time.Sleep(30 * time.Millisecond)
+	pool.balance()
+	pool.mutex.Lock()
+	idle, open := len(pool.idle), pool.numOpen
+	pool.mutex.Unlock()
+	if idle != 2 || open != 2 {
+		t.Fatalf("expect 2 fresh idle connections, got idle=%d open=%d", idle, open)
+	}
+	if !f.conns[0].closed.Load() || !f.conns[1].closed.Load() {
+		t.Fatal("expired idle connections should be closed")
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 2, MaxIdleSize: 4, MaxOpenSize: 4, TestOnBorrow: true})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(j%5+1)*time.Millisecond)
+				conn, err := pool.Get(ctx)
+				cancel()
+				if err != nil {
+					continue
+				}
+				if (i+j)%17 == 0 {
+					conn.(*fakeConn).broken.Store(true)
+				}
+				_ = pool.Put(conn)
+			}
+		}(i)
+	}
+	go pool.balance()
+	wg.Wait()
+
+	pool.mutex.Lock()
+	if pool.inUsed != 0 || pool.numOpen > pool.conf.MaxOpenSize {
+		t.Errorf("bad accounting: inUsed=%d numOpen=%d", pool.inUsed, pool.numOpen)
+	}
+	pool.mutex.Unlock()
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.openConns(); n != 0 {
+		t.Fatalf("expect all connections closed, %d still open", n)
+	}
+}
+
+// waitFor 等待条件满足
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not satisfied in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	f := &fakeFactory{}
+	pool := newTestPool(f, &PoolConf{MinIdleSize: 1, MaxOpenSize: 1})
+	defer pool.Close()
+
+	conn, _ := pool.Get(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _ = pool.Get(ctx)
+
+	stats := pool.Stats()
+	if stats.MaxOpen != 1 || stats.Open != 1 || stats.InUse != 1 || stats.Idle != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.WaitCount != 1 || stats.Timeouts != 1 || stats.WaitDuration < 20*time.Millisecond {
+		t.Fatalf("unexpected wait stats %+v", stats)
+	}
+	pool.Discard(conn)
+	stats = pool.Stats()
+	if stats.Created != 1 || stats.Closed != 1 || stats.Open != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	reg := metrics.NewRegistry()
+	pool.RegisterMetrics(reg, "main")
+	var out strings.Builder
+	_, _ = reg.WriteTo(&out)
+	for _, e := range []string{`hbase_pool_created_total{pool="main"} 1`, `hbase_pool_closed_total{pool="main"} 1`,
+		`hbase_pool_timeouts_total{pool="main"} 1`} {
+		if !strings.Contains(out.String(), e) {
+			t.Fatalf("missing %q in\n%s", e, out.String())
+		}
+	}
+}
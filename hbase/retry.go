@@ -0,0 +1,195 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+// DefaultRetryPolicy 幂等操作默认的重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// RetryPolicy 重试策略,重试之间按照指数退避并增加随机抖动
+type RetryPolicy struct {
+	MaxAttempts    int                  //最多尝试的次数,包括第一次调用,小于等于1表示不重试
+	InitialBackoff time.Duration        //第一次重试前的等待时间
+	MaxBackoff     time.Duration        //重试等待时间的上限
+	Multiplier     float64              //每次重试等待时间的增长倍数,小于1时按1处理
+	Jitter         float64              //随机抖动的比例,取值0~1,等待时间在[d*(1-Jitter), d]之间
+	Retryable      func(err error) bool //判断错误是否可以重试,为nil时使用IsRetryable
+}
+
+// transientServerErrors 服务端返回的可以重试的异常
+var transientServerErrors = []string{
+	"NotServingRegionException",
+	"RegionMovedException",
+	"RegionTooBusyException",
+	"RegionOpeningException",
+	"ServerNotRunningYetException",
+	"CallQueueTooBigException",
+}
+
+// IsRetryable 判断错误是否为可以重试的临时错误
+// 网络异常、连接被重置、网关返回的502/503/504/429以及region迁移等服务端临时异常可以重试,
+// 参数错误、上下文取消等其他错误不重试
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var illegalErr *th.TIllegalArgument
+	if errors.As(err, &illegalErr) {
+		return false
+	}
+	var ioErr *th.TIOError
+	if errors.As(err, &ioErr) {
+		if ioErr.CanRetry != nil {
+			return *ioErr.CanRetry
+		}
+		for _, v := range transientServerErrors {
+			if strings.Contains(ioErr.GetMessage(), v) {
+				return true
+			}
+		}
+		return false
+	}
+	var transportErr thrift.TTransportException
+	if !errors.As(err, &transportErr) {
+		return false
+	}
+	if code, ok := httpStatusCode(transportErr); ok {
+		switch code {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return false
+	}
+	switch transportErr.TypeId() {
+	case thrift.TIMED_OUT, thrift.END_OF_FILE:
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+const httpCodePrefix = "HTTP Response code: "
+
+// httpStatusCode 从THttpClient的异常信息中解析出HTTP状态码
+func httpStatusCode(err thrift.TTransportException) (int, bool) {
+	msg := err.Error()
+	idx := strings.Index(msg, httpCodePrefix)
+	if idx < 0 {
+		return 0, false
+	}
+	code, e := strconv.Atoi(msg[idx+len(httpCodePrefix):])
+	return code, e == nil
+}
+
+// backoff 计算第n次重试前的等待时间,n从1开始
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	multiplier := max(p.Multiplier, 1)
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n && d < float64(p.MaxBackoff); i++ {
+		d *= multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		d -= d * jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// retryPolicy 根据操作是否幂等选择重试策略
+func (hb *ThriftHbaseConn) retryPolicy(idempotent bool) *RetryPolicy {
+	if hb.conf == nil {
+		return nil
+	}
+	if idempotent {
+		if hb.conf.Retry != nil {
+			return hb.conf.Retry
+		}
+		return &DefaultRetryPolicy
+	}
+	return hb.conf.WriteRetry
+}
+
+// retry 按照重试策略执行一次Thrift调用
+// idempotent 表示调用是否幂等,幂等与非幂等的调用分别使用 PoolConf 中的 Retry 与 WriteRetry
+// 重试次数用完之后,返回包装了最后一次原始错误的错误
+func (hb *ThriftHbaseConn) retry(ctx context.Context, idempotent bool, fn func(ctx context.Context) error) error {
+	policy := hb.retryPolicy(idempotent)
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return fn(ctx)
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return &attemptsError{attempts: attempt, err: err}
+		}
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		//TCP链路出现通讯异常后数据流已经错位,重试之前需要重新建立链路
+		if hb.HttpClient == nil && isTransportError(err) {
+			hb.reset()
+		}
+	}
+}
+
+// attemptsError 重试次数用完之后返回的错误,包装了最后一次原始错误
+type attemptsError struct {
+	attempts int
+	err      error
+}
+
+func (e *attemptsError) Error() string {
+	return fmt.Sprintf("hbase call failed after %d attempts: %v", e.attempts, e.err)
+}
+
+func (e *attemptsError) Unwrap() error {
+	return e.err
+}
+
+// retryCall 带返回值的 retry
+func retryCall[T any](ctx context.Context, hb *ThriftHbaseConn, idempotent bool,
+	fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := hb.retry(ctx, idempotent, func(ctx context.Context) error {
+		var e error
+		result, e = fn(ctx)
+		return e
+	})
+	return result, err
+}
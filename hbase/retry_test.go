@@ -0,0 +1,158 @@
+package hbase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+// thriftHandler 只实现了测试需要的方法,其余方法调用时会panic
+type thriftHandler struct {
+	th.THBaseService
+}
+
+func (h *thriftHandler) TableExists(ctx context.Context, tableName *th.TTableName) (bool, error) {
+	return string(tableName.Qualifier) == "exist", nil
+}
+
+// newFlakyServer 前failures次请求返回502,之后正常处理Thrift请求
+func newFlakyServer(failures int32, requests *atomic.Int32) *httptest.Server {
+	return newThriftServer(&thriftHandler{}, failures, requests)
+}
+
+// newThriftServer 使用指定的实现启动一个Thrift网关,前failures次请求返回502
+func newThriftServer(service th.THBaseService, failures int32, requests *atomic.Int32) *httptest.Server {
+	protocolFactory := thrift.NewTBinaryProtocolFactoryConf(nil)
+	handler := thrift.NewThriftHandlerFunc(th.NewTHBaseServiceProcessor(service),
+		protocolFactory, protocolFactory)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		handler(w, r)
+	}))
+}
+
+func newRetryConn(t *testing.T, url string, retry, writeRetry *RetryPolicy) *ThriftHbaseConn {
+	c, err := thriftHBaseConnFactory(&PoolConf{
+		SpaceName:  SpaceName,
+		Address:    url,
+		Retry:      retry,
+		WriteRetry: writeRetry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c.(*ThriftHbaseConn)
+}
+
+var fastRetry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+
+func TestRetrySuccess(t *testing.T) {
+	var requests atomic.Int32
+	srv := newFlakyServer(2, &requests)
+	defer srv.Close()
+
+	c := newRetryConn(t, srv.URL, fastRetry, nil)
+	exist, err := c.ExistTable(context.Background(), "exist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exist || requests.Load() != 3 {
+		t.Fatalf("exist=%v requests=%d", exist, requests.Load())
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var requests atomic.Int32
+	srv := newFlakyServer(10, &requests)
+	defer srv.Close()
+
+	c := newRetryConn(t, srv.URL, fastRetry, nil)
+	_, err := c.ExistTable(context.Background(), "exist")
+	var transportErr thrift.TTransportException
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expect wrapped transport error, got %v", err)
+	}
+	if requests.Load() != 3 {
+		t.Fatalf("expect 3 attempts, got %d", requests.Load())
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	var requests atomic.Int32
+	srv := newFlakyServer(10, &requests)
+	defer srv.Close()
+
+	//非幂等操作默认不重试
+	c := newRetryConn(t, srv.URL, fastRetry, nil)
+	err := c.UpdateRow(context.Background(), "t", "row", map[string]map[string][]byte{"a": {"b": []byte("c")}})
+	if err == nil || requests.Load() != 1 {
+		t.Fatalf("err=%v requests=%d", err, requests.Load())
+	}
+
+	requests.Store(0)
+	c = newRetryConn(t, srv.URL, fastRetry, &RetryPolicy{MaxAttempts: 2})
+	_ = c.UpdateRow(context.Background(), "t", "row", map[string]map[string][]byte{"a": {"b": []byte("c")}})
+	if requests.Load() != 2 {
+		t.Fatalf("expect 2 attempts, got %d", requests.Load())
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	yes, no := true, false
+	msg := "org.apache.hadoop.hbase.NotServingRegionException: region is not online"
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION, "HTTP Response code: 503"), true},
+		{thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION, "HTTP Response code: 404"), false},
+		{thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION, "HTTP Response code: 501"), false},
+		{thrift.NewTTransportException(thrift.UNKNOWN_TRANSPORT_EXCEPTION, "HTTP Response code: 429"), true},
+		{thrift.NewTTransportException(thrift.TIMED_OUT, "timeout"), true},
+		{&th.TIOError{Message: &msg}, true},
+		{&th.TIOError{Message: &msg, CanRetry: &no}, false},
+		{&th.TIOError{CanRetry: &yes}, true},
+		{&th.TIllegalArgument{}, false},
+		{errors.New("other"), false},
+	}
+	for i, c := range cases {
+		if got := IsRetryable(c.err); got != c.want {
+			t.Errorf("case %d: IsRetryable(%v) = %v", i, c.err, got)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+	for n := 1; n <= 5; n++ {
+		want := min(10*time.Millisecond<<(n-1), 50*time.Millisecond)
+		if d := p.backoff(n); d > want || d < want/2 {
+			t.Fatalf("backoff(%d) = %v, want in [%v, %v]", n, d, want/2, want)
+		}
+	}
+}
+
+func TestConvertErrorKeepsAttempts(t *testing.T) {
+	msg := "org.apache.hadoop.hbase.RegionTooBusyException: too busy"
+	err := convertError(&attemptsError{attempts: 3, err: &th.TIOError{Message: &msg}})
+	var srvErr *serverError
+	if !errors.As(err, &srvErr) || srvErr.Error() != msg {
+		t.Fatalf("expect server error, got %v", err)
+	}
+	if err.Error() != "hbase call failed after 3 attempts: "+msg {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+}
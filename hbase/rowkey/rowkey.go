@@ -0,0 +1,337 @@
+// Package rowkey HBase行键的设计工具
+// 行键由多个带类型的字段按顺序拼接而成,每种字段的编码都保证字节序与值的顺序一致,
+// 因此可以直接用于范围扫描,同时提供加盐、MD5前缀、反转时间戳以及预分区分割点的生成
+package rowkey
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 行键相关的错误
+var (
+	ShortKeyErr   = errors.New("rowkey: key too short")
+	TextEncErr    = errors.New("rowkey: invalid text encoding")
+	TextLengthErr = errors.New("rowkey: text exceeds fixed width")
+)
+
+const (
+	textEscape     = 0x00 //变长文本中的转义字节
+	textEscapedNul = 0xff //0x00 转义后的第二个字节
+	textTerminator = 0x01 //变长文本结束标记的第二个字节
+	signBit        = 1 << 63
+)
+
+// Builder 按顺序拼接行键的各个字段
+// 第一次出错之后的调用都会被忽略,错误在 Build 时返回
+type Builder struct {
+	buf []byte
+	err error
+}
+
+// New 创建一个行键构建器
+func New() *Builder {
+	return &Builder{buf: make([]byte, 0, 32)}
+}
+
+// Build 返回拼接好的行键,可以直接作为 hbase.Connection 中的 rowKey 使用
+func (b *Builder) Build() (string, error) {
+	return string(b.buf), b.err
+}
+
+// Bytes 返回拼接好的行键的字节
+func (b *Builder) Bytes() ([]byte, error) {
+	return b.buf, b.err
+}
+
+// Uint8 单字节无符号整数
+func (b *Builder) Uint8(v uint8) *Builder {
+	b.buf = append(b.buf, v)
+	return b
+}
+
+// Uint16 2字节大端序无符号整数
+func (b *Builder) Uint16(v uint16) *Builder {
+	b.buf = binary.BigEndian.AppendUint16(b.buf, v)
+	return b
+}
+
+// Uint32 4字节大端序无符号整数
+func (b *Builder) Uint32(v uint32) *Builder {
+	b.buf = binary.BigEndian.AppendUint32(b.buf, v)
+	return b
+}
+
+// Uint64 8字节大端序无符号整数
+func (b *Builder) Uint64(v uint64) *Builder {
+	b.buf = binary.BigEndian.AppendUint64(b.buf, v)
+	return b
+}
+
+// Int32 4字节有符号整数,符号位取反,负数排在正数之前
+func (b *Builder) Int32(v int32) *Builder {
+	b.buf = binary.BigEndian.AppendUint32(b.buf, uint32(v)^(1<<31))
+	return b
+}
+
+// Int64 8字节有符号整数,符号位取反,负数排在正数之前
+func (b *Builder) Int64(v int64) *Builder {
+	b.buf = binary.BigEndian.AppendUint64(b.buf, uint64(v)^signBit)
+	return b
+}
+
+// Float64 8字节浮点数,按照数值大小排序
+func (b *Builder) Float64(v float64) *Builder {
+	bits := math.Float64bits(v)
+	if bits&signBit != 0 {
+		bits = ^bits
+	} else {
+		bits ^= signBit
+	}
+	b.buf = binary.BigEndian.AppendUint64(b.buf, bits)
+	return b
+}
+
+// Time 8字节毫秒时间戳,按照时间先后排序
+func (b *Builder) Time(t time.Time) *Builder {
+	return b.Int64(t.UnixMilli())
+}
+
+// ReverseTime 8字节反转的毫秒时间戳,时间越新越靠前,用于按照时间倒序扫描
+func (b *Builder) ReverseTime(t time.Time) *Builder {
+	return b.Uint64(uint64(ReverseTimestamp(t.UnixMilli())))
+}
+
+// FixedText 定长文本,不足 width 的部分在右侧补0x00,超过时返回TextLengthErr
+// 文本本身不能以0x00结尾,否则解析时无法区分补齐的字节
+func (b *Builder) FixedText(s string, width int) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(s) > width {
+		b.err = fmt.Errorf("%w: %q longer than %d", TextLengthErr, s, width)
+		return b
+	}
+	b.buf = append(b.buf, s...)
+	for i := len(s); i < width; i++ {
+		b.buf = append(b.buf, 0)
+	}
+	return b
+}
+
+// Text 变长文本,0x00 转义为 0x00 0xff,并以 0x00 0x01 结尾,可以出现在行键的任意位置并保持字典序
+func (b *Builder) Text(s string) *Builder {
+	for i := 0; i < len(s); i++ {
+		if s[i] == textEscape {
+			b.buf = append(b.buf, textEscape, textEscapedNul)
+			continue
+		}
+		b.buf = append(b.buf, s[i])
+	}
+	b.buf = append(b.buf, textEscape, textTerminator)
+	return b
+}
+
+// Raw 原样追加字节,不带长度信息,只能作为行键的最后一个字段
+func (b *Builder) Raw(v []byte) *Builder {
+	b.buf = append(b.buf, v...)
+	return b
+}
+
+// Salt 追加加盐的前缀,id 为计算分桶的依据,通常是行键中的业务主键
+func (b *Builder) Salt(s *Salter, id []byte) *Builder {
+	b.buf = s.appendBucket(b.buf, s.Bucket(id))
+	return b
+}
+
+// MD5Prefix 追加 id 的MD5十六进制前缀,n 为前缀的长度,取值1~32
+func (b *Builder) MD5Prefix(id []byte, n int) *Builder {
+	b.buf = append(b.buf, MD5Prefix(id, n)...)
+	return b
+}
+
+// ReverseTimestamp 反转毫秒时间戳,时间越新值越小
+func ReverseTimestamp(ms int64) int64 {
+	return math.MaxInt64 - ms
+}
+
+// Parser 按照构建时的顺序解析行键的各个字段
+// 第一次出错之后的调用都返回零值,错误通过 Err 获取
+type Parser struct {
+	buf []byte
+	err error
+}
+
+// NewParser 创建一个行键解析器
+func NewParser(key string) *Parser {
+	return &Parser{buf: []byte(key)}
+}
+
+// Err 解析过程中的第一个错误
+func (p *Parser) Err() error {
+	return p.err
+}
+
+// Remaining 尚未解析的字节数
+func (p *Parser) Remaining() int {
+	return len(p.buf)
+}
+
+// next 读取n个字节
+func (p *Parser) next(n int) []byte {
+	if p.err != nil {
+		return nil
+	}
+	if len(p.buf) < n {
+		p.err = fmt.Errorf("%w: need %d bytes, have %d", ShortKeyErr, n, len(p.buf))
+		return nil
+	}
+	v := p.buf[:n]
+	p.buf = p.buf[n:]
+	return v
+}
+
+// Uint8 单字节无符号整数
+func (p *Parser) Uint8() uint8 {
+	if v := p.next(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+// Uint16 2字节大端序无符号整数
+func (p *Parser) Uint16() uint16 {
+	if v := p.next(2); v != nil {
+		return binary.BigEndian.Uint16(v)
+	}
+	return 0
+}
+
+// Uint32 4字节大端序无符号整数
+func (p *Parser) Uint32() uint32 {
+	if v := p.next(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+// Uint64 8字节大端序无符号整数
+func (p *Parser) Uint64() uint64 {
+	if v := p.next(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+// Int32 4字节有符号整数
+func (p *Parser) Int32() int32 {
+	if v := p.next(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v) ^ (1 << 31))
+	}
+	return 0
+}
+
+// Int64 8字节有符号整数
+func (p *Parser) Int64() int64 {
+	if v := p.next(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v) ^ signBit)
+	}
+	return 0
+}
+
+// Float64 8字节浮点数
+func (p *Parser) Float64() float64 {
+	v := p.next(8)
+	if v == nil {
+		return 0
+	}
+	bits := binary.BigEndian.Uint64(v)
+	if bits&signBit != 0 {
+		bits ^= signBit
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+// Time 8字节毫秒时间戳
+func (p *Parser) Time() time.Time {
+	if v := p.next(8); v != nil {
+		return time.UnixMilli(int64(binary.BigEndian.Uint64(v) ^ signBit))
+	}
+	return time.Time{}
+}
+
+// ReverseTime 8字节反转的毫秒时间戳
+func (p *Parser) ReverseTime() time.Time {
+	if v := p.next(8); v != nil {
+		return time.UnixMilli(ReverseTimestamp(int64(binary.BigEndian.Uint64(v))))
+	}
+	return time.Time{}
+}
+
+// FixedText 定长文本,去掉右侧补齐的0x00
+func (p *Parser) FixedText(width int) string {
+	v := p.next(width)
+	end := len(v)
+	for end > 0 && v[end-1] == 0 {
+		end--
+	}
+	return string(v[:end])
+}
+
+// Text 变长文本
+func (p *Parser) Text() string {
+	if p.err != nil {
+		return ""
+	}
+	out := make([]byte, 0, len(p.buf))
+	for i := 0; i < len(p.buf); i++ {
+		if p.buf[i] != textEscape {
+			out = append(out, p.buf[i])
+			continue
+		}
+		if i+1 >= len(p.buf) {
+			break
+		}
+		switch p.buf[i+1] {
+		case textEscapedNul:
+			out = append(out, textEscape)
+			i++
+		case textTerminator:
+			p.buf = p.buf[i+2:]
+			return string(out)
+		default:
+			p.err = TextEncErr
+			return ""
+		}
+	}
+	p.err = TextEncErr
+	return ""
+}
+
+// Raw 剩余的所有字节
+func (p *Parser) Raw() []byte {
+	if p.err != nil {
+		return nil
+	}
+	v := p.buf
+	p.buf = nil
+	return v
+}
+
+// Salt 加盐的前缀,返回分桶的编号
+func (p *Parser) Salt(s *Salter) int {
+	if s.width() == 1 {
+		return int(p.Uint8())
+	}
+	return int(p.Uint16())
+}
+
+// MD5Prefix MD5十六进制前缀
+func (p *Parser) MD5Prefix(n int) string {
+	return string(p.next(n))
+}
@@ -0,0 +1,142 @@
+package rowkey
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestBuildAndParse(t *testing.T) {
+	s := NewSalter(16)
+	now := time.UnixMilli(1700000000123)
+	key, err := New().
+		Salt(s, []byte("user-1")).
+		Uint64(42).
+		Int64(-7).
+		Text("a\x00b").
+		FixedText("cn", 4).
+		ReverseTime(now).
+		Float64(-1.5).
+		Raw([]byte("tail")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewParser(key)
+	bucket := p.Salt(s)
+	if bucket != s.Bucket([]byte("user-1")) {
+		t.Fatalf("unexpected bucket %d", bucket)
+	}
+	if v := p.Uint64(); v != 42 {
+		t.Fatalf("unexpected uint64 %d", v)
+	}
+	if v := p.Int64(); v != -7 {
+		t.Fatalf("unexpected int64 %d", v)
+	}
+	if v := p.Text(); v != "a\x00b" {
+		t.Fatalf("unexpected text %q", v)
+	}
+	if v := p.FixedText(4); v != "cn" {
+		t.Fatalf("unexpected fixed text %q", v)
+	}
+	if v := p.ReverseTime(); !v.Equal(now) {
+		t.Fatalf("unexpected time %v", v)
+	}
+	if v := p.Float64(); v != -1.5 {
+		t.Fatalf("unexpected float %v", v)
+	}
+	if v := string(p.Raw()); v != "tail" || p.Err() != nil {
+		t.Fatalf("unexpected raw %q, %v", v, p.Err())
+	}
+
+	p = NewParser(key[:3])
+	p.Salt(s)
+	p.Uint64()
+	if !errors.Is(p.Err(), ShortKeyErr) {
+		t.Fatalf("expected ShortKeyErr, got %v", p.Err())
+	}
+	if _, err = New().FixedText("toolong", 3).Uint8(1).Build(); !errors.Is(err, TextLengthErr) {
+		t.Fatalf("expected TextLengthErr, got %v", err)
+	}
+}
+
+// checkOrder 检查编码后的字节序与值的顺序一致
+func checkOrder(t *testing.T, name string, keys []string) {
+	t.Helper()
+	if !sort.StringsAreSorted(keys) {
+		t.Fatalf("%s encoding does not preserve order: %q", name, keys)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	var keys []string
+	for _, v := range []int64{math.MinInt64, -100, -1, 0, 1, 100, math.MaxInt64} {
+		k, _ := New().Int64(v).Build()
+		keys = append(keys, k)
+	}
+	checkOrder(t, "int64", keys)
+
+	keys = keys[:0]
+	for _, v := range []float64{math.Inf(-1), -2.5, -0.1, 0, 0.1, 3, math.Inf(1)} {
+		k, _ := New().Float64(v).Build()
+		keys = append(keys, k)
+	}
+	checkOrder(t, "float64", keys)
+
+	keys = keys[:0]
+	for _, v := range []string{"", "a", "a\x00", "a\x00b", "ab", "b"} {
+		k, _ := New().Text(v).Uint8(0xff).Build()
+		keys = append(keys, k)
+	}
+	checkOrder(t, "text", keys)
+
+	//反转时间戳,越新的越靠前
+	keys = keys[:0]
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		k, _ := New().ReverseTime(now.Add(-time.Duration(i) * time.Hour)).Build()
+		keys = append(keys, k)
+	}
+	checkOrder(t, "reverse time", keys)
+}
+
+func TestSalter(t *testing.T) {
+	s := NewSalter(4)
+	splits := s.SplitKeys()
+	if len(splits) != 3 || !bytes.Equal(splits[0], []byte{1}) || !bytes.Equal(splits[2], []byte{3}) {
+		t.Fatalf("unexpected split keys %v", splits)
+	}
+	if wide := NewSalter(1000); len(wide.Prefix(999)) != 2 || len(wide.SplitKeys()) != 999 {
+		t.Fatal("buckets above 256 should use 2 byte prefixes")
+	}
+	counts := make([]int, s.Buckets())
+	for i := 0; i < 1000; i++ {
+		k, _ := New().Uint32(uint32(i)).Bytes()
+		counts[s.Bucket(k)]++
+	}
+	for i, c := range counts {
+		if c < 150 {
+			t.Fatalf("bucket %d is unbalanced: %v", i, counts)
+		}
+	}
+}
+
+func TestPrefixHelpers(t *testing.T) {
+	if p := MD5Prefix([]byte("abc"), 4); p != "9001" {
+		t.Fatalf("unexpected md5 prefix %q", p)
+	}
+	splits := HexSplitKeys(4, 2)
+	if len(splits) != 3 || string(splits[0]) != "40" || string(splits[1]) != "80" || string(splits[2]) != "c0" {
+		t.Fatalf("unexpected hex split keys %q", splits)
+	}
+	if end := PrefixEnd([]byte{1, 0xff}); !bytes.Equal(end, []byte{2}) {
+		t.Fatalf("unexpected prefix end %v", end)
+	}
+	if end := PrefixEnd([]byte{0xff}); end != nil {
+		t.Fatalf("expected nil prefix end, got %v", end)
+	}
+}
@@ -0,0 +1,116 @@
+package rowkey
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"math"
+)
+
+// MaxBuckets 加盐支持的最多分桶数
+const MaxBuckets = math.MaxUint16 + 1
+
+// Salter 加盐,将行键分散到固定数量的分桶中,避免单调递增的行键集中写入同一个region
+// 分桶数不超过256时前缀为1个字节,否则为2个字节
+type Salter struct {
+	buckets int
+}
+
+// NewSalter 创建加盐器,buckets 的取值为 1~MaxBuckets,超出范围时按照边界处理
+// 分桶数一旦确定就不能再修改,否则已经写入的数据无法再被找到
+func NewSalter(buckets int) *Salter {
+	return &Salter{buckets: min(max(buckets, 1), MaxBuckets)}
+}
+
+// Buckets 分桶数
+func (s *Salter) Buckets() int {
+	return s.buckets
+}
+
+// Bucket 计算 id 所在的分桶,同一个 id 总是落在同一个分桶中
+func (s *Salter) Bucket(id []byte) int {
+	h := fnv.New32a()
+	_, _ = h.Write(id)
+	return int(h.Sum32() % uint32(s.buckets))
+}
+
+// Prefix 分桶的前缀
+func (s *Salter) Prefix(bucket int) []byte {
+	return s.appendBucket(nil, bucket)
+}
+
+// Prefixes 所有分桶的前缀,加盐的行键做范围扫描时需要在每个分桶中分别扫描
+func (s *Salter) Prefixes() [][]byte {
+	prefixes := make([][]byte, 0, s.buckets)
+	for i := 0; i < s.buckets; i++ {
+		prefixes = append(prefixes, s.Prefix(i))
+	}
+	return prefixes
+}
+
+// SplitKeys 与分桶一一对应的预分区分割点,可以作为 CreateTableWithDesc 的 splitKeys 参数
+// 返回 buckets-1 个分割点,建表后每个分桶正好是一个region
+func (s *Salter) SplitKeys() [][]byte {
+	return s.Prefixes()[1:]
+}
+
+// width 前缀的字节数
+func (s *Salter) width() int {
+	if s.buckets <= math.MaxUint8+1 {
+		return 1
+	}
+	return 2
+}
+
+// appendBucket 追加分桶的前缀
+func (s *Salter) appendBucket(dst []byte, bucket int) []byte {
+	if s.width() == 1 {
+		return append(dst, byte(bucket))
+	}
+	return binary.BigEndian.AppendUint16(dst, uint16(bucket))
+}
+
+// MD5Prefix id 的MD5十六进制前缀,n 为前缀的长度,取值1~32,超出范围时按照边界处理
+func MD5Prefix(id []byte, n int) string {
+	sum := md5.Sum(id)
+	return hex.EncodeToString(sum[:])[:min(max(n, 1), md5.Size*2)]
+}
+
+// HexSplitKeys 为使用 n 位十六进制前缀的行键生成 regions 个均匀分布的预分区分割点
+// 返回 regions-1 个分割点,regions 超过前缀能够表示的数量时按照最大数量处理
+func HexSplitKeys(regions, n int) [][]byte {
+	n = min(max(n, 1), 15)
+	space := uint64(1) << (4 * n)
+	if regions < 2 {
+		return nil
+	}
+	if uint64(regions) > space {
+		regions = int(space)
+	}
+	keys := make([][]byte, 0, regions-1)
+	const digits = "0123456789abcdef"
+	for i := 1; i < regions; i++ {
+		v := space * uint64(i) / uint64(regions)
+		key := make([]byte, n)
+		for j := n - 1; j >= 0; j-- {
+			key[j] = digits[v&0xf]
+			v >>= 4
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// PrefixEnd 以 prefix 开头的行键的上界(不包含),可以作为 ScanRows 的 stopRow
+// prefix 全部为0xff时返回空,表示扫描到表尾
+func PrefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
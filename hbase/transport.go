@@ -0,0 +1,138 @@
+package hbase
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// TransportType 与Thrift服务通讯的方式
+type TransportType int
+
+const (
+	TransportHTTP     TransportType = iota //HTTP,默认方式,用于Lindorm等提供HTTP网关的服务
+	TransportFramed                        //TCP + TFramedTransport,对应ThriftServer2的 -framed 选项
+	TransportBuffered                      //TCP + TBufferedTransport,ThriftServer2默认的方式
+)
+
+// ProtocolType Thrift的序列化协议
+type ProtocolType int
+
+const (
+	ProtocolBinary  ProtocolType = iota //二进制协议,默认
+	ProtocolCompact                     //压缩协议,对应ThriftServer2的 -compact 选项
+)
+
+const (
+	maxFrameSize       = 1024 * 1024 * 256 //数据帧大小
+	bufferedTransSize  = 8192              //TBufferedTransport的缓冲区大小
+	defaultKeepAlive   = 30 * time.Second  //TCP的keep-alive间隔
+	accessKeyHeader    = "ACCESSKEYID"     //HTTP方式的用户名请求头
+	accessSecretHeader = "ACCESSSIGNATURE" //HTTP方式的密码请求头
+)
+
+// newTConfiguration 生成Thrift的基础配置
+func newTConfiguration(conf *PoolConf) *thrift.TConfiguration {
+	return &thrift.TConfiguration{
+		ConnectTimeout:     conf.ConnectTimeout,  //连接超时时间
+		SocketTimeout:      conf.SocketTimeout,   //通讯超时时间
+		MaxFrameSize:       maxFrameSize,         //数据帧大小
+		TBinaryStrictRead:  thrift.BoolPtr(true), //二进制严格读
+		TBinaryStrictWrite: thrift.BoolPtr(true), //二进制严格写
+		TLSConfig:          conf.TLSConfig,       //TCP方式的TLS配置
+	}
+}
+
+// newProtocolFactory 根据配置生成协议工厂
+func newProtocolFactory(conf *PoolConf) (thrift.TProtocolFactory, error) {
+	tConf := newTConfiguration(conf)
+	switch conf.Protocol {
+	case ProtocolBinary:
+		return thrift.NewTBinaryProtocolFactoryConf(tConf), nil
+	case ProtocolCompact:
+		return thrift.NewTCompactProtocolFactoryConf(tConf), nil
+	}
+	return nil, fmt.Errorf("unsupported hbase thrift protocol %d", conf.Protocol)
+}
+
+// newTransport 根据配置生成通讯链路,链路尚未打开
+// 第二个返回值为连接自己创建的HTTP客户端,使用 PoolConf.HttpClient 或者TCP方式时为nil
+func newTransport(conf *PoolConf) (thrift.TTransport, *http.Client, error) {
+	switch conf.Transport {
+	case TransportHTTP:
+		return newHttpTransport(conf)
+	case TransportFramed:
+		return thrift.NewTFramedTransportConf(newSocket(conf), newTConfiguration(conf)), nil, nil
+	case TransportBuffered:
+		return thrift.NewTBufferedTransport(newSocket(conf), bufferedTransSize), nil, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported hbase thrift transport %d", conf.Transport)
+}
+
+// newSocket 生成TCP链路,Address 的格式为 host:port,配置了TLSConfig时使用TLS
+// TCP方式的超时由 ConnectTimeout 与 SocketTimeout 控制,context中的deadline在调用返回后才会被检查
+func newSocket(conf *PoolConf) thrift.TTransport {
+	if conf.TLSConfig != nil {
+		return thrift.NewTSSLSocketConf(conf.Address, newTConfiguration(conf))
+	}
+	return thrift.NewTSocketConf(conf.Address, newTConfiguration(conf))
+}
+
+// newHttpTransport 生成HTTP链路,设置认证信息以及自定义的请求头
+func newHttpTransport(conf *PoolConf) (thrift.TTransport, *http.Client, error) {
+	client, owned := conf.HttpClient, (*http.Client)(nil)
+	if client == nil {
+		client = newHttpClient(conf)
+		owned = client
+	}
+	//THttpClient 不会使用TConfiguration中的超时,需要通过http.Client设置
+	transport, err := thrift.NewTHttpClientWithOptions(conf.Address,
+		thrift.THttpClientOptions{Client: client})
+	if err != nil {
+		return nil, nil, err
+	}
+	httpClient := transport.(*thrift.THttpClient)
+	//设置用户名密码,没有配置时不发送,兼容不需要认证的ThriftServer2
+	if conf.User != "" || conf.Passwd != "" {
+		httpClient.SetHeader(accessKeyHeader, conf.User)
+		httpClient.SetHeader(accessSecretHeader, conf.Passwd)
+	}
+	//THttpClient.SetHeader 是追加,同名的请求头需要先删除
+	for k, v := range conf.Headers {
+		httpClient.DelHeader(k)
+		httpClient.SetHeader(k, v)
+	}
+	return httpClient, owned, nil
+}
+
+// newHttpClient 根据配置生成HTTP客户端
+// ConnectTimeout 控制建立TCP连接的超时时间,SocketTimeout 控制一次完整请求的超时时间
+func newHttpClient(conf *PoolConf) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   conf.ConnectTimeout,
+		KeepAlive: defaultKeepAlive,
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     cloneTLSConfig(conf.TLSConfig),
+		MaxIdleConnsPerHost: 1, //一个连接对象只对应一条TCP链路
+		IdleConnTimeout:     conf.MaxIdleTime,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   conf.SocketTimeout,
+	}
+}
+
+// cloneTLSConfig 每个连接使用独立的TLS配置,避免并发修改
+func cloneTLSConfig(c *tls.Config) *tls.Config {
+	if c == nil {
+		return nil
+	}
+	return c.Clone()
+}
@@ -0,0 +1,124 @@
+package hbase
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	th "github.com/yeahyf/go_base/hbase/t2hbase"
+)
+
+// newSocketServer 启动一个TCP方式的Thrift服务,返回监听的地址
+func newSocketServer(t *testing.T, transportFactory thrift.TTransportFactory, protocolFactory thrift.TProtocolFactory) string {
+	serverSocket, err := thrift.NewTServerSocket("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = serverSocket.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	server := thrift.NewTSimpleServer4(th.NewTHBaseServiceProcessor(&thriftHandler{}),
+		serverSocket, transportFactory, protocolFactory)
+	go func() { _ = server.Serve() }()
+	t.Cleanup(func() { _ = server.Stop() })
+	return serverSocket.Addr().String()
+}
+
+func TestSocketTransport(t *testing.T) {
+	cases := []struct {
+		name             string
+		transport        TransportType
+		protocol         ProtocolType
+		transportFactory thrift.TTransportFactory
+		protocolFactory  thrift.TProtocolFactory
+	}{
+		{"framed-compact", TransportFramed, ProtocolCompact,
+			thrift.NewTFramedTransportFactoryConf(thrift.NewTTransportFactory(), nil), thrift.NewTCompactProtocolFactoryConf(nil)},
+		{"buffered-binary", TransportBuffered, ProtocolBinary,
+			thrift.NewTBufferedTransportFactory(bufferedTransSize), thrift.NewTBinaryProtocolFactoryConf(nil)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr := newSocketServer(t, c.transportFactory, c.protocolFactory)
+			conn, err := thriftHBaseConnFactory(&PoolConf{
+				SpaceName:      SpaceName,
+				Address:        addr,
+				Transport:      c.transport,
+				Protocol:       c.protocol,
+				ConnectTimeout: DefaultConnectTimeout,
+				SocketTimeout:  DefaultSocketTimeout,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			ctx := context.Background()
+			exist, err := conn.ExistTable(ctx, "exist")
+			if err != nil || !exist {
+				t.Fatalf("unexpected result %v, %v", exist, err)
+			}
+			//关闭之后可以重新建立链路
+			conn.Close()
+			if conn.IsOpen() {
+				t.Fatal("connection should be closed")
+			}
+			if err = conn.Open(); err != nil {
+				t.Fatal(err)
+			}
+			if err = conn.Ping(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestHttpTransportTLS(t *testing.T) {
+	protocolFactory := thrift.NewTCompactProtocolFactoryConf(nil)
+	handler := thrift.NewThriftHandlerFunc(th.NewTHBaseServiceProcessor(&thriftHandler{}), protocolFactory, protocolFactory)
+	var headers http.Header
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		handler(w, r)
+	}))
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	conf := &PoolConf{
+		SpaceName:      SpaceName,
+		Address:        srv.URL,
+		User:           "user",
+		Protocol:       ProtocolCompact,
+		TLSConfig:      &tls.Config{RootCAs: roots},
+		Headers:        map[string]string{"X-Trace": "abc", accessSecretHeader: "override"},
+		ConnectTimeout: DefaultConnectTimeout,
+		SocketTimeout:  DefaultSocketTimeout,
+	}
+	conn, err := thriftHBaseConnFactory(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if exist, err := conn.ExistTable(context.Background(), "exist"); err != nil || !exist {
+		t.Fatalf("unexpected result %v, %v", exist, err)
+	}
+	if headers.Get(accessKeyHeader) != "user" || headers.Get(accessSecretHeader) != "override" || headers.Get("X-Trace") != "abc" {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+
+	//自定义的HTTP客户端
+	conf.TLSConfig = nil
+	conf.HttpClient = srv.Client()
+	custom, err := thriftHBaseConnFactory(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer custom.Close()
+	if exist, err := custom.ExistTable(context.Background(), "exist"); err != nil || !exist {
+		t.Fatalf("unexpected result %v, %v", exist, err)
+	}
+}
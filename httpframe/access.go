@@ -0,0 +1,193 @@
+package httpframe
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yeahyf/go_base/log"
+)
+
+// HeadXRequestId 请求的唯一标识,客户端没有传入时由服务端生成,并在响应中返回
+const HeadXRequestId = "X-Request-Id"
+
+// maxRequestIdLen 客户端传入的 X-Request-Id 的最大长度,超过时重新生成
+const maxRequestIdLen = 128
+
+// AccessLogConf 访问日志的配置
+type AccessLogConf struct {
+	SampleRate    float64       //正常请求记录的比例,取值(0,1],小于等于0或者大于等于1表示全部记录
+	SlowThreshold time.Duration //耗时超过该值的请求使用warn级别记录,0表示不区分
+	RequestId     func() string //生成 X-Request-Id,为nil时使用随机的16字节hex
+}
+
+// DefaultAccessLog 默认的访问日志配置,记录全部请求
+var DefaultAccessLog = &AccessLogConf{}
+
+// accessEntry 处理请求的过程中需要补充到访问日志的信息
+type accessEntry struct {
+	appKey string
+	code   uint32
+}
+
+// accessKey 上下文中 accessEntry 的key
+type accessKey struct{}
+
+// setAccessEntry 在访问日志中记录appkey以及错误码,不在 AccessLog 中时忽略
+func setAccessEntry(ctx context.Context, appKey string, code uint32) {
+	if entry, ok := ctx.Value(accessKey{}).(*accessEntry); ok {
+		entry.appKey = appKey
+		entry.code = code
+	}
+}
+
+// AccessLog 记录访问日志的http中间件,每个请求输出一行结构化的日志
+// 请求的上下文中放入附带 request_id 的日志,处理过程中通过 log.FromContext 输出的日志都会带上 request_id
+// conf 为nil时使用 DefaultAccessLog
+func AccessLog(conf *AccessLogConf, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	if conf == nil {
+		conf = DefaultAccessLog
+	}
+	return track(conf, nil, next)
+}
+
+// track 记录请求的状态码、大小以及耗时,处理完成之后输出访问日志以及指标,conf、m 为nil时不输出对应的内容
+func track(conf *AccessLogConf, m *HTTPMetrics, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := r.Context()
+		var logger *log.Logger
+		if conf != nil {
+			id := r.Header.Get(HeadXRequestId)
+			if id == "" || len(id) > maxRequestIdLen {
+				id = conf.newRequestId()
+			}
+			w.Header().Set(HeadXRequestId, id)
+			logger = log.With("request_id", id)
+			ctx = log.NewContext(ctx, logger)
+		}
+		entry := &accessEntry{}
+		ctx = context.WithValue(ctx, accessKey{}, entry)
+		aw := &accessWriter{ResponseWriter: w}
+		body := &countReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		next(aw, r.WithContext(ctx))
+		latency := time.Since(start)
+		if m != nil {
+			m.observe(r, aw.status(), entry.code, body.n, aw.size, latency)
+		}
+		if conf != nil {
+			conf.write(logger, r, aw, body.n, entry, latency)
+		}
+	}
+}
+
+// newRequestId 生成 X-Request-Id
+func (c *AccessLogConf) newRequestId() string {
+	if c.RequestId != nil {
+		return c.RequestId()
+	}
+	b := make([]byte, 16)
+	_, _ = crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sampled 正常请求是否需要记录
+func (c *AccessLogConf) sampled() bool {
+	return c.SampleRate <= 0 || c.SampleRate >= 1 || rand.Float64() < c.SampleRate
+}
+
+// write 输出访问日志,出错以及慢请求不受采样的影响
+func (c *AccessLogConf) write(logger *log.Logger, r *http.Request, aw *accessWriter, reqSize int64,
+	entry *accessEntry, latency time.Duration) {
+	slow := c.SlowThreshold > 0 && latency >= c.SlowThreshold
+	failed := aw.status() >= http.StatusBadRequest || entry.code != 0
+	if !slow && !failed && !c.sampled() {
+		return
+	}
+	fields := []any{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", aw.status(),
+		"code", entry.code,
+		"appkey", entry.appKey,
+		"ip", clientIp(r),
+		"latency", latency,
+		"req_size", reqSize,
+		"resp_size", aw.size,
+	}
+	if slow {
+		logger.Warnw("slow request", fields...)
+		return
+	}
+	logger.Infow("access", fields...)
+}
+
+// clientIp 客户端地址,优先使用nginx转发的 X-Real-IP
+func clientIp(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if i := strings.LastIndex(r.RemoteAddr, ":"); i > 0 {
+		return r.RemoteAddr[:i]
+	}
+	return r.RemoteAddr
+}
+
+// accessWriter 记录响应的状态码以及写入的字节数
+type accessWriter struct {
+	http.ResponseWriter
+	code int
+	size int64
+}
+
+// WriteHeader 记录状态码
+func (w *accessWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write 记录写入的字节数
+func (w *accessWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Unwrap 返回原始的 http.ResponseWriter,供 http.ResponseController 使用
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// status 响应的状态码,没有写入时为200
+func (w *accessWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// countReader 记录读取的请求体字节数
+type countReader struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read 读取并计数
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,78 @@
+package httpframe
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/log"
+)
+
+func TestAccessLog(t *testing.T) {
+	log.SetLevel(log.LevelInfo)
+	defer log.SetLevel(log.LevelError)
+
+	handler := HandleWith(New(WithAccessLog(&AccessLogConf{SampleRate: 0.000001, SlowThreshold: 50 * time.Millisecond})),
+		func(ctx context.Context, req *ept.ErrorResponse) (*ept.ErrorResponse, error) {
+			log.FromContext(ctx).Info("handling ", req.Info)
+			if req.Code == 2 {
+				time.Sleep(60 * time.Millisecond)
+			}
+			if req.Code == 3 {
+				return nil, &ept.Error{Code: 2001, Message: "bad"}
+			}
+			return req, nil
+		})
+
+	//客户端传入的 X-Request-Id 原样返回
+	r := newSignedRequest(t, &ept.ErrorResponse{Code: 1, Info: "sampled-out"}, false)
+	r.Header.Set(HeadXRequestId, "client-id")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Header().Get(HeadXRequestId) != "client-id" {
+		t.Fatalf("unexpected request id %q", w.Header().Get(HeadXRequestId))
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, newSignedRequest(t, &ept.ErrorResponse{Code: 2, Info: "slow"}, false))
+	slowId := w.Header().Get(HeadXRequestId)
+	if len(slowId) != 32 {
+		t.Fatalf("unexpected generated request id %q", slowId)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, newSignedRequest(t, &ept.ErrorResponse{Code: 3, Info: "failed"}, false))
+	failedId := w.Header().Get(HeadXRequestId)
+
+	info := readLog(t, "info.log")
+	//采样之外的正常请求只有业务日志
+	if !strings.Contains(info, `handling sampled-out	{"request_id": "client-id"}`) ||
+		strings.Contains(info, `"request_id": "client-id", "method"`) {
+		t.Fatalf("unexpected info log %s", info)
+	}
+	if !strings.Contains(info, `"request_id": "`+failedId+`", "method": "POST", "path": "/api", "status": 400, "code": 2001, "appkey": "app"`) {
+		t.Fatalf("failed request not logged %s", info)
+	}
+	warn := readLog(t, "warn.log")
+	if !strings.Contains(warn, "slow request") || !strings.Contains(warn, `"request_id": "`+slowId+`"`) {
+		t.Fatalf("slow request not logged %s", warn)
+	}
+	errLog := readLog(t, "error.log")
+	if !strings.Contains(errLog, `"request_id": "`+failedId+`"`) {
+		t.Fatalf("error log without request id %s", errLog)
+	}
+}
+
+// readLog 读取测试日志
+func readLog(t *testing.T, name string) string {
+	data, err := os.ReadFile(filepath.Join(logDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
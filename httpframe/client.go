@@ -0,0 +1,256 @@
+package httpframe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/utils"
+	"google.golang.org/protobuf/proto"
+)
+
+// 客户端相关的错误
+var (
+	ClientStatusErr = errors.New("unexpected http status")
+	ClientConfErr   = errors.New("client base url is empty")
+)
+
+// ClientConf 客户端配置,零值字段使用默认值
+type ClientConf struct {
+	BaseURL  string          //服务地址,例如 http://127.0.0.1:8080
+	AppKey   string          //X-AppKey
+	Version  string          //X-Version,默认1.0
+	Scheme   SignatureScheme //签名算法,默认SHA1Scheme,需要与服务端按照 Version 选择的算法一致
+	Compress bool            //是否使用gzip压缩请求体
+	Millis   bool            //X-Timestamp 是否使用毫秒时间戳
+	Headers  http.Header     //每个请求都附加的请求头
+
+	Timeout        time.Duration //单次请求的超时时间,默认5秒
+	MaxAttempts    int           //最多尝试的次数,包括第一次调用,小于等于1表示不重试
+	InitialBackoff time.Duration //第一次重试前的等待时间,之后每次翻倍,默认100毫秒
+	MaxBackoff     time.Duration //重试等待时间的上限,默认2秒
+
+	MaxIdleConnsPerHost int           //每个服务地址保持的空闲连接数,默认32
+	IdleConnTimeout     time.Duration //空闲连接的超时时间,默认90秒
+	HttpClient          *http.Client  //为nil时使用内部创建的客户端,不为nil时忽略连接相关的配置
+}
+
+// Client 按照 ReqBaseCheck 校验的协议发送请求的客户端,可以被多个goroutine共用
+// 重试时会重新生成 nonce 与时间戳,服务端已经处理但响应丢失的请求可能被再次执行,
+// 非幂等的接口应该将 MaxAttempts 设置为1
+// 服务端因为时间戳拒绝请求时,按照响应中的 X-Server-Time 修正之后的时间戳,并且可以重试
+type Client struct {
+	conf   ClientConf
+	client *http.Client
+	skew   atomic.Int64 //服务器时间减去本地时间,单位纳秒
+}
+
+// NewClient 创建客户端,同一个服务地址应该共用一个客户端以复用连接
+func NewClient(conf *ClientConf) (*Client, error) {
+	if conf == nil || conf.BaseURL == "" {
+		return nil, ClientConfErr
+	}
+	c := &Client{conf: *conf}
+	c.conf.BaseURL = strings.TrimRight(c.conf.BaseURL, "/")
+	if c.conf.Version == "" {
+		c.conf.Version = "1.0"
+	}
+	if c.conf.Scheme == nil {
+		c.conf.Scheme = SHA1Scheme{}
+	}
+	if c.conf.Timeout <= 0 {
+		c.conf.Timeout = 5 * time.Second
+	}
+	if c.conf.InitialBackoff <= 0 {
+		c.conf.InitialBackoff = 100 * time.Millisecond
+	}
+	if c.conf.MaxBackoff <= 0 {
+		c.conf.MaxBackoff = 2 * time.Second
+	}
+	c.client = c.conf.HttpClient
+	if c.client == nil {
+		if c.conf.MaxIdleConnsPerHost <= 0 {
+			c.conf.MaxIdleConnsPerHost = 32
+		}
+		if c.conf.IdleConnTimeout <= 0 {
+			c.conf.IdleConnTimeout = 90 * time.Second
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = 0
+		transport.MaxIdleConnsPerHost = c.conf.MaxIdleConnsPerHost
+		transport.IdleConnTimeout = c.conf.IdleConnTimeout
+		c.client = &http.Client{Transport: transport}
+	}
+	return c, nil
+}
+
+// Call 向 path 发送 req,成功时将响应反序列化到 resp,resp 为nil时忽略响应内容
+// 服务端返回 X-Server-Ex 时返回 *ept.Error
+func (c *Client) Call(ctx context.Context, path string, req, resp proto.Message) error {
+	body, err := c.encode(req)
+	if err != nil {
+		return err
+	}
+	backoff := c.conf.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		retryable, err = c.do(ctx, path, body, resp)
+		if err == nil || !retryable || attempt >= c.conf.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, c.conf.MaxBackoff)
+	}
+}
+
+// encode 序列化请求,需要时压缩
+func (c *Client) encode(req proto.Message) ([]byte, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if !c.conf.Compress {
+		return body, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err = zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// do 发送一次请求,返回的bool表示错误是否可以重试
+func (c *Client) do(ctx context.Context, path string, body []byte, resp proto.Message) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.conf.Timeout)
+	defer cancel()
+
+	r, err := c.newRequest(ctx, path, body)
+	if err != nil {
+		return false, err
+	}
+	httpResp, err := c.client.Do(r)
+	if err != nil {
+		return isTemporary(err), err
+	}
+	defer utils.CloseAction(httpResp.Body)
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return isTemporary(err), err
+	}
+	if httpResp.Header.Get(HeadServerEx) != "" {
+		errResp := &ept.ErrorResponse{}
+		if err = proto.Unmarshal(data, errResp); err != nil {
+			return false, fmt.Errorf("couldn't unmarshal error response: %w", err)
+		}
+		//时间戳错误时修正时钟偏差,服务端没有处理该请求,可以重试
+		if errResp.Code == immut.CodeExTs && c.adjustSkew(httpResp.Header.Get(HeadXServerTime)) {
+			return true, &ept.Error{Code: errResp.Code, Message: errResp.Info}
+		}
+		return false, &ept.Error{Code: errResp.Code, Message: errResp.Info}
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		code := httpResp.StatusCode
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests,
+			fmt.Errorf("%w: %d", ClientStatusErr, code)
+	}
+	if resp != nil {
+		if err = proto.Unmarshal(data, resp); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// newRequest 构建签名之后的请求,每次调用使用新的 nonce 与时间戳
+func (c *Client) newRequest(ctx context.Context, path string, body []byte) (*http.Request, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Add(time.Duration(c.skew.Load()))
+	ts := strconv.FormatInt(now.Unix(), 10)
+	if c.conf.Millis {
+		ts = strconv.FormatInt(now.UnixMilli(), 10)
+	}
+	sign, err := c.conf.Scheme.Sign(&SignData{
+		AppKey:    c.conf.AppKey,
+		Nonce:     nonce,
+		Timestamp: ts,
+		Body:      body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	r, err := http.NewRequestWithContext(ctx, HttpPost, c.conf.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.conf.Headers {
+		r.Header[k] = v
+	}
+	r.Header.Set(HeadXVersion, c.conf.Version)
+	r.Header.Set(HeadXAppKey, c.conf.AppKey)
+	r.Header.Set(HeadXNonce, nonce)
+	r.Header.Set(HeadXTimestamp, ts)
+	r.Header.Set(HeadXSignature, sign)
+	if c.conf.Compress {
+		r.Header.Set(HeadContentEncoding, EncodingType)
+	}
+	return r, nil
+}
+
+// adjustSkew 按照服务器的毫秒时间戳修正时钟偏差,返回是否修正成功
+func (c *Client) adjustSkew(serverTime string) bool {
+	ms, err := strconv.ParseInt(serverTime, 10, 64)
+	if err != nil {
+		return false
+	}
+	c.skew.Store(int64(time.Until(time.UnixMilli(ms))))
+	return true
+}
+
+// newNonce 生成随机的 nonce
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isTemporary 网络异常以及单次请求超时可以重试,调用方取消时不重试,整体超时由 Call 判断
+func isTemporary(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,155 @@
+package httpframe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestClientCall(t *testing.T) {
+	handler := New().Handler(func(pb proto.Message) (proto.Message, error) {
+		req := pb.(*ept.ErrorResponse)
+		if req.Code == 0 {
+			return nil, ept.New(immut.CodeExAppKey, "bad code")
+		}
+		return echo(pb)
+	}, &ept.ErrorResponse{})
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	for _, compress := range []bool{false, true} {
+		c, err := NewClient(&ClientConf{BaseURL: srv.URL, AppKey: "app", Compress: compress})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := &ept.ErrorResponse{}
+		if err = c.Call(context.Background(), "api", &ept.ErrorResponse{Code: 1, Info: "hi"}, resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != 2 || resp.Info != "hi" {
+			t.Fatalf("unexpected response %v", resp)
+		}
+		err = c.Call(context.Background(), "/api", &ept.ErrorResponse{}, resp)
+		var eptErr *ept.Error
+		if !errors.As(err, &eptErr) || eptErr.Code != immut.CodeExAppKey || eptErr.Message != "bad code" {
+			t.Fatalf("expected server error, got %v", err)
+		}
+	}
+}
+
+func TestClientHMAC(t *testing.T) {
+	scheme := &HMACSHA256Scheme{Keys: StaticKeyStore{"app": "secret"}}
+	handler := Serve(Chain(WrapperHandler(echo),
+		HeaderCheck(), ReadBody(), SignatureCheckWith(VersionSchemes(SchemeRule{Scheme: scheme})),
+		Unmarshal(&ept.ErrorResponse{})))
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	c, _ := NewClient(&ClientConf{BaseURL: srv.URL, AppKey: "app", Version: "3.0", Scheme: scheme})
+	if err := c.Call(context.Background(), "/api", &ept.ErrorResponse{Code: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	c, _ = NewClient(&ClientConf{BaseURL: srv.URL, AppKey: "app", Version: "3.0"})
+	var eptErr *ept.Error
+	if err := c.Call(context.Background(), "/api", &ept.ErrorResponse{Code: 1}, nil); !errors.As(err, &eptErr) ||
+		eptErr.Code != immut.CodeExSignature {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var requests atomic.Int32
+	nonces := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces <- r.Header.Get(HeadXNonce)
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		RespHandler(w, &ept.ErrorResponse{Code: 7})
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(&ClientConf{BaseURL: srv.URL, MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	resp := &ept.ErrorResponse{}
+	if err := c.Call(context.Background(), "/api", &ept.ErrorResponse{}, resp); err != nil || resp.Code != 7 {
+		t.Fatalf("unexpected response %v, %v", resp, err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+	//每次重试使用新的nonce
+	if first, second := <-nonces, <-nonces; first == second {
+		t.Fatalf("nonce reused on retry: %s", first)
+	}
+
+	requests.Store(0)
+	c, _ = NewClient(&ClientConf{BaseURL: srv.URL, MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	if err := c.Call(context.Background(), "/api", &ept.ErrorResponse{}, resp); !errors.Is(err, ClientStatusErr) {
+		t.Fatalf("expected ClientStatusErr, got %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	c, _ := NewClient(&ClientConf{BaseURL: srv.URL, Timeout: 20 * time.Millisecond, MaxAttempts: 2,
+		InitialBackoff: time.Millisecond})
+	if err := c.Call(context.Background(), "/api", &ept.ErrorResponse{}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("timeout should be retried, got %d requests", n)
+	}
+
+	if _, err := NewClient(&ClientConf{}); err != ClientConfErr {
+		t.Fatalf("expected ClientConfErr, got %v", err)
+	}
+}
+
+func TestClientClockSkew(t *testing.T) {
+	//服务器时间比本地快10分钟
+	clock := func() time.Time { return time.Now().Add(10 * time.Minute) }
+	srv := httptest.NewServer(http.HandlerFunc(New(WithClock(clock)).Handler(echo, &ept.ErrorResponse{})))
+	defer srv.Close()
+
+	c, _ := NewClient(&ClientConf{BaseURL: srv.URL, AppKey: "app", Millis: true, MaxAttempts: 2,
+		InitialBackoff: time.Millisecond})
+	resp := &ept.ErrorResponse{}
+	if err := c.Call(context.Background(), "/api", &ept.ErrorResponse{Code: 1}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 2 {
+		t.Fatalf("unexpected response %v", resp)
+	}
+
+	//不重试时返回时间戳错误,下一次请求使用修正之后的时间
+	c, _ = NewClient(&ClientConf{BaseURL: srv.URL, AppKey: "app"})
+	err := c.Call(context.Background(), "/api", &ept.ErrorResponse{Code: 1}, nil)
+	var eptErr *ept.Error
+	if !errors.As(err, &eptErr) || eptErr.Code != immut.CodeExTs {
+		t.Fatalf("expected ts error, got %v", err)
+	}
+	if err = c.Call(context.Background(), "/api", &ept.ErrorResponse{Code: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
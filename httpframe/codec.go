@@ -0,0 +1,97 @@
+package httpframe
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	HeadContentType  = "Content-Type"
+	HeadAccept       = "Accept"
+	ContentTypeProto = "application/x-protobuf"
+	ContentTypeJSON  = "application/json"
+)
+
+// Codec 请求与响应消息的编码
+type Codec interface {
+	ContentType() string
+	Marshal(m proto.Message) ([]byte, error)
+	Unmarshal(data []byte, m proto.Message) error
+}
+
+// protoCodec 二进制的protobuf,原有客户端使用的编码
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string {
+	return ContentTypeProto
+}
+
+func (protoCodec) Marshal(m proto.Message) ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, m proto.Message) error {
+	return proto.Unmarshal(data, m)
+}
+
+// jsonCodec protojson编码,便于使用curl等工具调试,请求中未知的字段会被忽略
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(m proto.Message) ([]byte, error) {
+	return protojson.Marshal(m)
+}
+
+func (jsonCodec) Unmarshal(data []byte, m proto.Message) error {
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+// 支持的编码
+var (
+	ProtoCodec Codec = protoCodec{}
+	JSONCodec  Codec = jsonCodec{}
+)
+
+// codecs 按照媒体类型查找编码
+var codecs = map[string]Codec{
+	ContentTypeProto:           ProtoCodec,
+	"application/protobuf":     ProtoCodec,
+	"application/octet-stream": ProtoCodec,
+	ContentTypeJSON:            JSONCodec,
+}
+
+// codecByMediaType 解析媒体类型,不支持时返回nil
+func codecByMediaType(v string) Codec {
+	mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+	if err != nil {
+		return nil
+	}
+	return codecs[mediaType]
+}
+
+// RequestCodec 按照 Content-Type 选择请求的编码,没有或者不支持时使用 ProtoCodec,与原有的客户端兼容
+func RequestCodec(r *http.Request) Codec {
+	if c := codecByMediaType(r.Header.Get(HeadContentType)); c != nil {
+		return c
+	}
+	return ProtoCodec
+}
+
+// ResponseCodec 按照 Accept 选择响应的编码,使用第一个支持的类型,没有指定时与请求的编码一致
+func ResponseCodec(r *http.Request) Codec {
+	for _, accept := range r.Header.Values(HeadAccept) {
+		for _, v := range strings.Split(accept, ",") {
+			if c := codecByMediaType(v); c != nil {
+				return c
+			}
+		}
+	}
+	return RequestCodec(r)
+}
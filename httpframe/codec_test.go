@@ -0,0 +1,98 @@
+package httpframe
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodecNegotiation(t *testing.T) {
+	cases := []struct {
+		contentType, accept string
+		req, resp           Codec
+	}{
+		{"", "", ProtoCodec, ProtoCodec},
+		{"application/octet-stream", "*/*", ProtoCodec, ProtoCodec},
+		{"application/json; charset=utf-8", "", JSONCodec, JSONCodec},
+		{"application/json", "application/x-protobuf", JSONCodec, ProtoCodec},
+		{"", "text/html, application/json;q=0.9", ProtoCodec, JSONCodec},
+		{"text/plain", "", ProtoCodec, ProtoCodec},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/api", nil)
+		if c.contentType != "" {
+			r.Header.Set(HeadContentType, c.contentType)
+		}
+		if c.accept != "" {
+			r.Header.Set(HeadAccept, c.accept)
+		}
+		if RequestCodec(r) != c.req || ResponseCodec(r) != c.resp {
+			t.Fatalf("%q/%q: unexpected codecs %T, %T", c.contentType, c.accept, RequestCodec(r), ResponseCodec(r))
+		}
+	}
+}
+
+// newJSONRequest 使用JSON请求体构建签名正确的请求,签名基于原始的JSON文本
+func newJSONRequest(body string) *http.Request {
+	nonce := strconv.FormatInt(time.Now().UnixNano(), 36)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader([]byte(body)))
+	r.Header.Set(HeadContentType, ContentTypeJSON)
+	r.Header.Set(HeadXVersion, "1.0")
+	r.Header.Set(HeadXAppKey, "app")
+	r.Header.Set(HeadXNonce, nonce)
+	r.Header.Set(HeadXTimestamp, ts)
+	r.Header.Set(HeadXSignature, sha1Sign([]byte(body), nonce, ts))
+	return r
+}
+
+func TestJSONHandler(t *testing.T) {
+	handler := New().Handler(echo, &ept.ErrorResponse{})
+
+	w := httptest.NewRecorder()
+	handler(w, newJSONRequest(`{"code": 1, "info": "hi", "unknown": true}`))
+	if w.Header().Get(HeadServerEx) != "" || w.Header().Get(HeadContentType) != ContentTypeJSON {
+		t.Fatalf("unexpected headers %v, body %s", w.Header(), w.Body.String())
+	}
+	resp := &ept.ErrorResponse{}
+	if err := protojson.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Code != 2 || resp.Info != "hi" {
+		t.Fatalf("unexpected response %s, %v", w.Body.String(), err)
+	}
+
+	//JSON请求,protobuf响应
+	r := newJSONRequest(`{"code": 3}`)
+	r.Header.Set(HeadAccept, ContentTypeProto)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Code != 4 {
+		t.Fatalf("unexpected response %v, %v", resp, err)
+	}
+
+	//错误同样使用JSON输出
+	w = httptest.NewRecorder()
+	handler(w, newJSONRequest(`{"code": "x"}`))
+	if w.Header().Get(HeadServerEx) == "" {
+		t.Fatalf("expected error response, got %s", w.Body.String())
+	}
+	if err := protojson.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Code != immut.CodeExProtobufUn {
+		t.Fatalf("unexpected error response %s, %v", w.Body.String(), err)
+	}
+
+	//签名基于原始请求体,请求体变化之后签名失效
+	r = newJSONRequest(`{"code": 1}`)
+	r.Body = http.NoBody
+	r.ContentLength = 0
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if err := protojson.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Code != immut.CodeExSignature {
+		t.Fatalf("expected signature error, got %s, %v", w.Body.String(), err)
+	}
+}
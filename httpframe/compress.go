@@ -0,0 +1,232 @@
+package httpframe
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/metrics"
+)
+
+const (
+	HeadAcceptEncoding = "Accept-Encoding"
+	HeadVary           = "Vary"
+	HeadContentLength  = "Content-Length"
+	EncodingZstd       = "zstd"
+)
+
+// CompressConf 响应压缩的配置
+type CompressConf struct {
+	MinSize  int  //第一次写入的数据小于该大小时不压缩
+	Zstd     bool //是否支持zstd,客户端同时支持时优先使用zstd
+	Disabled bool //关闭响应压缩
+
+	//压缩完成之后回调,用于记录压缩前后的大小,encoding 为实际使用的压缩方式
+	Observer func(encoding string, rawSize, compressedSize int)
+}
+
+// DefaultCompress Serve 使用的压缩配置,压缩前后的字节数记录在 metrics.Default 中,需要在启动阶段修改
+var DefaultCompress = &CompressConf{MinSize: 1024, Observer: CompressObserver(metrics.Default)}
+
+// 压缩器复用,避免每个响应重新分配压缩使用的缓冲区
+var (
+	gzipWriterPool = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	zstdWriterPool = sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+)
+
+// encoder 压缩器
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// gzipEncoder 适配 gzip.Writer
+type gzipEncoder struct {
+	*gzip.Writer
+}
+
+func (e gzipEncoder) Reset(w io.Writer) {
+	e.Writer.Reset(w)
+}
+
+// zstdEncoder 适配 zstd.Encoder
+type zstdEncoder struct {
+	*zstd.Encoder
+}
+
+func (e zstdEncoder) Reset(w io.Writer) {
+	e.Encoder.Reset(w)
+}
+
+// getEncoder 从池中获取压缩器
+func getEncoder(encoding string, w io.Writer) encoder {
+	var e encoder
+	if encoding == EncodingZstd {
+		e = zstdEncoder{zstdWriterPool.Get().(*zstd.Encoder)}
+	} else {
+		e = gzipEncoder{gzipWriterPool.Get().(*gzip.Writer)}
+	}
+	e.Reset(w)
+	return e
+}
+
+// putEncoder 将压缩器放回池中
+func putEncoder(e encoder) {
+	e.Reset(io.Discard)
+	switch v := e.(type) {
+	case zstdEncoder:
+		zstdWriterPool.Put(v.Encoder)
+	case gzipEncoder:
+		gzipWriterPool.Put(v.Writer)
+	}
+}
+
+// AcceptEncoding 按照 Accept-Encoding 选择响应的压缩方式,不压缩时返回空字符串
+func (c *CompressConf) AcceptEncoding(r *http.Request) string {
+	if c == nil || c.Disabled {
+		return ""
+	}
+	var gzipOk, zstdOk bool
+	for _, accept := range r.Header.Values(HeadAcceptEncoding) {
+		for _, v := range strings.Split(accept, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+			//q=0 表示不接受
+			if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+				if f, err := strconv.ParseFloat(q, 64); err == nil && f == 0 {
+					continue
+				}
+			}
+			switch strings.ToLower(name) {
+			case EncodingType:
+				gzipOk = true
+			case EncodingZstd:
+				zstdOk = true
+			}
+		}
+	}
+	if zstdOk && c.Zstd {
+		return EncodingZstd
+	}
+	if gzipOk {
+		return EncodingType
+	}
+	return ""
+}
+
+// CompressWriter 按照协商的方式压缩响应,是否压缩由第一次写入的数据大小决定
+// RespHandler 一次写入全部的响应数据,因此阈值按照完整的响应大小判断
+// 使用之后必须调用 Close 输出剩余的数据
+type CompressWriter struct {
+	http.ResponseWriter
+
+	conf        *CompressConf
+	encoding    string  //协商的压缩方式,为空时不压缩
+	enc         encoder //压缩器,为nil时直接输出
+	counter     *countWriter
+	decided     bool //是否已经决定了压缩方式
+	status      int  //延迟输出的状态码
+	rawSize     int  //压缩之前的大小
+	wroteHeader bool
+}
+
+// countWriter 统计压缩之后的大小
+type countWriter struct {
+	w    io.Writer
+	size int
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.size += n
+	return n, err
+}
+
+// NewCompressWriter 创建压缩响应的 http.ResponseWriter,conf 为nil时使用 DefaultCompress
+func NewCompressWriter(w http.ResponseWriter, r *http.Request, conf *CompressConf) *CompressWriter {
+	if conf == nil {
+		conf = DefaultCompress
+	}
+	return &CompressWriter{ResponseWriter: w, conf: conf, encoding: conf.AcceptEncoding(r)}
+}
+
+// WriteHeader 状态码延迟到决定压缩方式之后输出,以便设置 Content-Encoding
+func (cw *CompressWriter) WriteHeader(status int) {
+	if cw.wroteHeader || cw.status != 0 {
+		return
+	}
+	cw.status = status
+}
+
+// Write 写入响应数据
+func (cw *CompressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.decide(len(p))
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	cw.rawSize += len(p)
+	return cw.enc.Write(p)
+}
+
+// decide 决定是否压缩并输出响应头
+func (cw *CompressWriter) decide(size int) {
+	cw.decided = true
+	h := cw.Header()
+	if cw.encoding != "" && size >= cw.conf.MinSize && h.Get(HeadContentEncoding) == "" {
+		h.Set(HeadContentEncoding, cw.encoding)
+		h.Del(HeadContentLength)
+		h.Add(HeadVary, HeadAcceptEncoding)
+		cw.counter = &countWriter{w: cw.ResponseWriter}
+		cw.enc = getEncoder(cw.encoding, cw.counter)
+	}
+	cw.writeHeader()
+}
+
+// writeHeader 输出延迟的状态码
+func (cw *CompressWriter) writeHeader() {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+}
+
+// Close 输出压缩器中剩余的数据并记录压缩前后的大小
+func (cw *CompressWriter) Close() error {
+	if !cw.decided {
+		cw.decided = true
+		cw.writeHeader()
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	err := cw.enc.Close()
+	putEncoder(cw.enc)
+	cw.enc = nil
+	if log.IsDebug() {
+		log.Debugf("resp compressed encoding = %s, raw size = %d, size = %d",
+			cw.encoding, cw.rawSize, cw.counter.size)
+	}
+	if cw.conf.Observer != nil {
+		cw.conf.Observer(cw.encoding, cw.rawSize, cw.counter.size)
+	}
+	return err
+}
+
+// Unwrap 用于 http.ResponseController 获取原始的 http.ResponseWriter
+func (cw *CompressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
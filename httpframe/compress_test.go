@@ -0,0 +1,117 @@
+package httpframe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/yeahyf/go_base/ept"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAcceptEncoding(t *testing.T) {
+	conf := &CompressConf{Zstd: true}
+	cases := []struct {
+		accept   string
+		conf     *CompressConf
+		encoding string
+	}{
+		{"", conf, ""},
+		{"gzip", conf, EncodingType},
+		{"gzip, deflate, br, zstd", conf, EncodingZstd},
+		{"gzip, zstd", &CompressConf{}, EncodingType},
+		{"zstd;q=0, gzip;q=0.5", conf, EncodingType},
+		{"gzip; q=0", conf, ""},
+		{"gzip", &CompressConf{Disabled: true}, ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/api", nil)
+		r.Header.Set(HeadAcceptEncoding, c.accept)
+		if got := c.conf.AcceptEncoding(r); got != c.encoding {
+			t.Fatalf("%q: expected %q, got %q", c.accept, c.encoding, got)
+		}
+	}
+}
+
+func TestCompressWriter(t *testing.T) {
+	var observed []int
+	conf := &CompressConf{MinSize: 100, Zstd: true, Observer: func(encoding string, rawSize, compressedSize int) {
+		observed = append(observed, rawSize, compressedSize)
+	}}
+	large := []byte(strings.Repeat("leaderboard ", 100))
+
+	for _, encoding := range []string{EncodingType, EncodingZstd} {
+		observed = nil
+		r := httptest.NewRequest(http.MethodPost, "/api", nil)
+		r.Header.Set(HeadAcceptEncoding, encoding)
+		w := httptest.NewRecorder()
+		cw := NewCompressWriter(w, r, conf)
+		cw.WriteHeader(http.StatusAccepted)
+		_, _ = cw.Write(large)
+		if err := cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusAccepted || w.Header().Get(HeadContentEncoding) != encoding {
+			t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+		}
+		var data []byte
+		var err error
+		if encoding == EncodingType {
+			var zr *gzip.Reader
+			if zr, err = gzip.NewReader(w.Body); err == nil {
+				data, err = io.ReadAll(zr)
+			}
+		} else {
+			var zr *zstd.Decoder
+			if zr, err = zstd.NewReader(w.Body); err == nil {
+				data, err = io.ReadAll(zr)
+				zr.Close()
+			}
+		}
+		if err != nil || !bytes.Equal(data, large) {
+			t.Fatalf("%s: couldn't decode response: %v", encoding, err)
+		}
+		if len(observed) != 2 || observed[0] != len(large) || observed[1] >= len(large) {
+			t.Fatalf("%s: unexpected sizes %v", encoding, observed)
+		}
+	}
+
+	//小于阈值不压缩
+	r := httptest.NewRequest(http.MethodPost, "/api", nil)
+	r.Header.Set(HeadAcceptEncoding, EncodingType)
+	w := httptest.NewRecorder()
+	cw := NewCompressWriter(w, r, conf)
+	_, _ = cw.Write([]byte("small"))
+	_ = cw.Close()
+	if w.Header().Get(HeadContentEncoding) != "" || w.Body.String() != "small" {
+		t.Fatalf("small response should not be compressed: %v %q", w.Header(), w.Body.String())
+	}
+}
+
+func TestServeCompress(t *testing.T) {
+	info := strings.Repeat("archive ", 500)
+	handler := Serve(Chain(WrapperHandler(echo), ReadBody(), Unmarshal(&ept.ErrorResponse{})))
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	body := mustMarshal(t, &ept.ErrorResponse{Code: 1, Info: info})
+	//Transport 自动添加 Accept-Encoding: gzip 并解压
+	resp, err := http.Post(srv.URL, ContentTypeProto, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if !resp.Uncompressed {
+		t.Fatalf("expected gzip response, headers %v", resp.Header)
+	}
+	out := &ept.ErrorResponse{}
+	if err = proto.Unmarshal(data, out); err != nil || out.Code != 2 || out.Info != info {
+		t.Fatalf("unexpected response %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package httpframe
+
+import (
+	"net/http"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+)
+
+// StatusRule 错误码在 [From, To] 区间内时使用的http状态码
+type StatusRule struct {
+	From   uint32
+	To     uint32
+	Status int
+}
+
+// DefaultStatusRules 默认的错误码与http状态码的对应关系,按照顺序匹配,单个错误码需要放在区间之前
+var DefaultStatusRules = []StatusRule{
+	{immut.CodeExHttpMethod, immut.CodeExHttpMethod, http.StatusMethodNotAllowed},
+	{immut.CodeExSignature, immut.CodeExSignature, http.StatusUnauthorized},
+	{immut.CodeExRepeatReq, immut.CodeExRepeatReq, http.StatusConflict},
+	{immut.CodeExProtobufMa, immut.CodeExProtobufMa, http.StatusInternalServerError},
+	{immut.CodeExAppKey, immut.CodeExAppKey, http.StatusForbidden},
+	{immut.CodeExBodyTooLarge, immut.CodeExBodyTooLarge, http.StatusRequestEntityTooLarge},
+	{immut.CodeExRateLimit, immut.CodeExRateLimit, http.StatusTooManyRequests},
+	{immut.CodeExNetTimeout, immut.CodeExNetTimeout, http.StatusGatewayTimeout},
+	{1000, 1099, http.StatusBadRequest},          //请求协议错误
+	{1100, 1999, http.StatusInternalServerError}, //序列化等内部错误
+	{2000, 8999, http.StatusBadRequest},          //业务错误
+	{9000, 9999, http.StatusInternalServerError}, //依赖的服务异常
+}
+
+// ErrorMapper 将错误转为http状态码
+type ErrorMapper struct {
+	Rules   []StatusRule //按照顺序匹配的规则
+	Default int          //没有匹配的规则以及非 *ept.Error 的错误使用的状态码
+	Legacy  bool         //与原有的行为兼容,始终返回200,客户端只通过 X-Server-Ex 判断错误
+
+	Silent func(e *ept.Error) bool //返回true时不记录错误日志,例如大量的无效appkey请求
+}
+
+// DefaultErrorMapper ExRespHandler 使用的映射,需要兼容原有的客户端时将 Legacy 设置为true
+var DefaultErrorMapper = &ErrorMapper{Rules: DefaultStatusRules, Default: http.StatusInternalServerError}
+
+// Status 返回错误对应的http状态码
+func (m *ErrorMapper) Status(e *ept.Error) int {
+	if m == nil || m.Legacy {
+		return http.StatusOK
+	}
+	for _, rule := range m.Rules {
+		if e.Code >= rule.From && e.Code <= rule.To {
+			return rule.Status
+		}
+	}
+	if m.Default == 0 {
+		return http.StatusInternalServerError
+	}
+	return m.Default
+}
+
+// silent 是否不记录错误日志
+func (m *ErrorMapper) silent(e *ept.Error) bool {
+	return m != nil && m.Silent != nil && m.Silent(e)
+}
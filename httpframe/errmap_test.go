@@ -0,0 +1,75 @@
+package httpframe
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+)
+
+func TestErrorMapperStatus(t *testing.T) {
+	cases := []struct {
+		code   uint32
+		status int
+	}{
+		{immut.CodeExHttpMethod, http.StatusMethodNotAllowed},
+		{immut.CodeExVersion, http.StatusBadRequest},
+		{immut.CodeExSignature, http.StatusUnauthorized},
+		{immut.CodeExAppKey, http.StatusForbidden},
+		{immut.CodeExBodyTooLarge, http.StatusRequestEntityTooLarge},
+		{immut.CodeExDdbMa, http.StatusInternalServerError},
+		{3001, http.StatusBadRequest},
+		{immut.CodeExRedis, http.StatusInternalServerError},
+		{immut.CodeExNetTimeout, http.StatusGatewayTimeout},
+		{ept.CodeUnknown, http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		if got := DefaultErrorMapper.Status(ept.New(c.code, "")); got != c.status {
+			t.Fatalf("code %d: expected %d, got %d", c.code, c.status, got)
+		}
+	}
+	legacy := &ErrorMapper{Rules: DefaultStatusRules, Legacy: true}
+	if got := legacy.Status(ept.New(immut.CodeExSignature, "")); got != http.StatusOK {
+		t.Fatalf("legacy mapper should always return 200, got %d", got)
+	}
+}
+
+func TestExRespHandlerMapping(t *testing.T) {
+	secret := errors.New("dial tcp 10.0.0.1:6379: connection refused")
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   uint32
+		info   string
+	}{
+		{"wrapped ept error", fmt.Errorf("load archive: %w", ept.New(3001, "archive not found")),
+			http.StatusBadRequest, 3001, "archive not found"},
+		{"internal cause hidden", ept.Wrap(immut.CodeExRedis, "service busy", secret),
+			http.StatusInternalServerError, immut.CodeExRedis, "service busy"},
+		{"unknown error hidden", secret, http.StatusInternalServerError, ept.CodeUnknown, ept.UnknownMessage},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		ExRespHandler(w, c.err)
+		e := decodeError(t, w)
+		if w.Code != c.status || e == nil || e.Code != c.code || e.Info != c.info {
+			t.Fatalf("%s: unexpected response %d %v", c.name, w.Code, e)
+		}
+	}
+	if !errors.Is(ept.Wrap(immut.CodeExRedis, "service busy", secret), secret) {
+		t.Fatal("wrapped cause should be visible to errors.Is")
+	}
+
+	DefaultErrorMapper.Legacy = true
+	defer func() { DefaultErrorMapper.Legacy = false }()
+	w := httptest.NewRecorder()
+	ExRespHandler(w, ept.New(immut.CodeExSignature, "bad"))
+	if w.Code != http.StatusOK || decodeError(t, w) == nil {
+		t.Fatalf("legacy response should be 200 with X-Server-Ex, got %d", w.Code)
+	}
+}
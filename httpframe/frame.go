@@ -0,0 +1,542 @@
+package httpframe
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/metrics"
+	"github.com/yeahyf/go_base/utils"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	HeadContentEncoding = "Content-Encoding"
+	HeadXVersion        = "X-Version"
+	HeadXNonce          = "X-Nonce"
+	HeadXTimestamp      = "X-Timestamp"
+	HeadXSignature      = "X-Signature"
+	HttpPost            = "POST"
+	HeadServerEx        = "X-Server-Ex"
+	EncodingType        = "gzip"
+	HeadXAppKey         = "X-AppKey"
+	HeadXServerTime     = "X-Server-Time" //错误响应中返回服务器的毫秒时间戳,客户端可以据此修正时钟偏差
+)
+
+// DefaultTimestampTolerance 默认允许的请求时间与服务器时间的差距,早于或者晚于服务器时间都适用
+const DefaultTimestampTolerance = 3 * time.Minute
+
+// millisThreshold 大于等于该值的时间戳按照毫秒处理,秒级时间戳在公元33658年之前都小于该值
+const millisThreshold = 1e12
+
+// Clock 获取当前时间,测试时可以替换
+type Clock func() time.Time
+
+// ReqData 检查之后的请求数据
+type ReqData struct {
+	ReqBody []byte
+	Nonce   string
+	Appkey  string
+}
+
+// Wrapper 对基本护理逻辑的封装
+type Wrapper func(pb proto.Message) (proto.Message, error)
+
+// IsRepeatReq 对请求进行重复检查,返回true表示重复请求,false表示无重复
+type IsRepeatReq func(nonce string) bool
+
+// IsValidAppKey 对Appkey进行检查,true为有效,false为无效
+type IsValidAppKey func(appkey string) bool
+
+// Framework 按照配置组合请求的检查以及响应的输出,创建之后可以被多个goroutine共用
+// 为nil的配置在处理请求时使用对应的包级默认值,例如 DefaultSchemes、DefaultBodyLimit
+type Framework struct {
+	appKey     AppKeyPolicy
+	registry   *AppKeyRegistry
+	nonces     NonceStore
+	minVersion float64
+	maxVersion float64
+	tsPast     time.Duration
+	tsFuture   time.Duration
+	clock      Clock
+	schemes    SchemeSelector
+	bodyLimit  *BodyLimit
+	compress   *CompressConf
+	errMapper  *ErrorMapper
+	accessLog  *AccessLogConf
+	panicHook  PanicHook
+	metrics    *HTTPMetrics
+}
+
+// Option 框架的配置项
+type Option func(fw *Framework)
+
+// WithAppKeyPolicy 设置appkey的检查策略,默认所有版本都要求appkey,但是不检查是否有效
+func WithAppKeyPolicy(policy AppKeyPolicy) Option {
+	return func(fw *Framework) {
+		fw.appKey = policy
+	}
+}
+
+// WithAppKeyRegistry 使用注册表检查appkey是否启用、允许访问的路径、最低版本以及请求频率
+// 与 AppKeyPolicy 一起使用时,只检查 AppKeyPolicy 要求appkey的版本
+func WithAppKeyRegistry(registry *AppKeyRegistry) Option {
+	return func(fw *Framework) {
+		fw.registry = registry
+	}
+}
+
+// WithNonceStore 设置记录 nonce 的存储,默认不检查重复请求
+func WithNonceStore(store NonceStore) Option {
+	return func(fw *Framework) {
+		fw.nonces = store
+	}
+}
+
+// WithVersionRange 设置允许的 X-Version 区间,0表示不限制
+func WithVersionRange(minVersion, maxVersion float64) Option {
+	return func(fw *Framework) {
+		fw.minVersion = minVersion
+		fw.maxVersion = maxVersion
+	}
+}
+
+// WithTimestampTolerance 设置允许的请求时间与服务器时间的差距,早于或者晚于服务器时间都适用,默认3分钟
+func WithTimestampTolerance(d time.Duration) Option {
+	return WithTimestampWindow(d, d)
+}
+
+// WithTimestampWindow 分别设置请求时间早于、晚于服务器时间的最大差距,小于0表示该方向不限制
+func WithTimestampWindow(past, future time.Duration) Option {
+	return func(fw *Framework) {
+		fw.tsPast = past
+		fw.tsFuture = future
+	}
+}
+
+// WithClock 设置获取当前时间的方法,默认使用 time.Now
+func WithClock(clock Clock) Option {
+	return func(fw *Framework) {
+		fw.clock = clock
+	}
+}
+
+// WithSchemes 设置签名算法的选择,默认使用 DefaultSchemes
+func WithSchemes(selector SchemeSelector) Option {
+	return func(fw *Framework) {
+		fw.schemes = selector
+	}
+}
+
+// WithBodyLimit 设置请求体的大小限制,默认使用 DefaultBodyLimit
+func WithBodyLimit(limit *BodyLimit) Option {
+	return func(fw *Framework) {
+		fw.bodyLimit = limit
+	}
+}
+
+// WithCompress 设置响应压缩的配置,默认使用 DefaultCompress
+func WithCompress(conf *CompressConf) Option {
+	return func(fw *Framework) {
+		fw.compress = conf
+	}
+}
+
+// WithErrorMapper 设置错误与http状态码的映射,默认使用 DefaultErrorMapper
+func WithErrorMapper(mapper *ErrorMapper) Option {
+	return func(fw *Framework) {
+		fw.errMapper = mapper
+	}
+}
+
+// WithAccessLog 记录访问日志,参见 AccessLog,默认不记录
+func WithAccessLog(conf *AccessLogConf) Option {
+	return func(fw *Framework) {
+		if conf == nil {
+			conf = DefaultAccessLog
+		}
+		fw.accessLog = conf
+	}
+}
+
+// WithPanicHook 设置处理请求时发生panic的回调,panic总是会被恢复并记录日志
+func WithPanicHook(hook PanicHook) Option {
+	return func(fw *Framework) {
+		fw.panicHook = hook
+	}
+}
+
+// WithMetrics 在 reg 中记录请求的指标,默认使用 metrics.Default,reg 为nil时不记录
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(fw *Framework) {
+		if reg == nil {
+			fw.metrics = nil
+			return
+		}
+		fw.metrics = NewHTTPMetrics(reg)
+	}
+}
+
+// New 创建框架
+func New(opts ...Option) *Framework {
+	fw := &Framework{tsPast: DefaultTimestampTolerance, tsFuture: DefaultTimestampTolerance, metrics: defaultHTTPMetrics()}
+	for _, opt := range opts {
+		opt(fw)
+	}
+	return fw
+}
+
+// selector 签名算法的选择,没有配置时使用 DefaultSchemes
+func (fw *Framework) selector() SchemeSelector {
+	if fw.schemes != nil {
+		return fw.schemes
+	}
+	return func(version string) (SignatureScheme, error) {
+		return DefaultSchemes(version)
+	}
+}
+
+// now 当前时间,没有配置时使用 time.Now
+func (fw *Framework) now() time.Time {
+	if fw.clock != nil {
+		return fw.clock()
+	}
+	return time.Now()
+}
+
+// mapper 错误映射,没有配置时使用 DefaultErrorMapper
+func (fw *Framework) mapper() *ErrorMapper {
+	if fw.errMapper != nil {
+		return fw.errMapper
+	}
+	return DefaultErrorMapper
+}
+
+// Stages 按照配置组合的中间件,依次为
+// 请求方法、请求头、读取请求体、签名、时间戳、解压、appkey、重复请求、反序列化
+func (fw *Framework) Stages(reqPb proto.Message) []Middleware {
+	return append(fw.checks(), Unmarshal(reqPb))
+}
+
+// checks 反序列化之前的检查
+func (fw *Framework) checks() []Middleware {
+	return []Middleware{
+		MethodCheck(HttpPost),
+		fw.HeaderCheck(),
+		ReadBodyLimit(fw.bodyLimit),
+		fw.SignatureCheck(),
+		fw.TimestampCheck(),
+		DecompressLimit(fw.bodyLimit),
+		fw.AppKeyCheck(),
+		NonceCheck(fw.nonces),
+	}
+}
+
+// Handler 使用 Stages 检查请求之后调用业务逻辑,每个请求都会重新分配一个与 reqPb 类型相同的消息
+func (fw *Framework) Handler(httpWrapper Wrapper, reqPb proto.Message) func(w http.ResponseWriter, r *http.Request) {
+	return fw.Serve(Chain(WrapperHandler(httpWrapper), fw.Stages(reqPb)...))
+}
+
+// Check 按照配置检查请求,返回解压之后的请求数据,w 可以为nil
+func (fw *Framework) Check(w http.ResponseWriter, r *http.Request) (*Request, error) {
+	req := &Request{Request: r, Writer: w, Codec: RequestCodec(r), RespCodec: ResponseCodec(r)}
+	_, err := Chain(func(req *Request) (proto.Message, error) {
+		return nil, nil
+	}, fw.checks()...)(req)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Serve 将 Handler 转为 http.HandlerFunc,按照 Content-Type 与 Accept 选择编码,输出响应或者错误
+// 响应按照 Accept-Encoding 压缩,记录请求的指标,配置了 WithAccessLog 时记录访问日志
+func (fw *Framework) Serve(h Handler) func(w http.ResponseWriter, r *http.Request) {
+	if fw.accessLog == nil && fw.metrics == nil {
+		return fw.serve(h)
+	}
+	return track(fw.accessLog, fw.metrics, fw.serve(h))
+}
+
+// serve 处理请求并输出响应或者错误
+func (fw *Framework) serve(h Handler) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cw := NewCompressWriter(w, r, fw.compress)
+		defer utils.CloseAction(cw)
+
+		req := &Request{Request: r, Writer: cw, Codec: RequestCodec(r), RespCodec: ResponseCodec(r)}
+		//需要在压缩器关闭之前输出错误响应
+		defer func() {
+			if value := recover(); value != nil {
+				setAccessEntry(r.Context(), req.AppKey, immut.CodeExInternal)
+				recovered(req.Logger(), cw, r, req.RespCodec, fw.mapper(), fw.panicHook, value)
+			}
+		}()
+		respPb, err := h(req)
+		if err != nil {
+			eptErr := ept.From(err)
+			setAccessEntry(r.Context(), req.AppKey, eptErr.Code)
+			cw.Header().Set(HeadXServerTime, strconv.FormatInt(fw.now().UnixMilli(), 10))
+			writeError(req.Logger(), cw, req.RespCodec, fw.mapper(), err)
+			return
+		}
+		setAccessEntry(r.Context(), req.AppKey, 0)
+		if respPb != nil {
+			RespHandlerWith(cw, req.RespCodec, respPb)
+		}
+	}
+}
+
+// HeaderCheck 读取并检查 X-Version、X-AppKey、X-Nonce、X-Timestamp、X-Signature 请求头
+func (fw *Framework) HeaderCheck() Middleware {
+	return stage(fw.readHeaders)
+}
+
+// SignatureCheck 校验请求的签名,需要放在 HeaderCheck、ReadBody 之后
+// X-Version 不参与签名,注册表中配置了密钥的appkey始终使用 HMACSHA256Scheme,其他appkey按照 X-Version 选择算法
+func (fw *Framework) SignatureCheck() Middleware {
+	selector := fw.selector()
+	if fw.registry == nil {
+		return SignatureCheckWith(selector)
+	}
+	keyed := &HMACSHA256Scheme{Keys: fw.registry}
+	keyedSelector := func(string) (SignatureScheme, error) {
+		return keyed, nil
+	}
+	return stage(func(req *Request) error {
+		if info, ok := fw.registry.Lookup(req.AppKey); ok && info.Secret != immut.Blank {
+			return verifySignatureWith(keyedSelector, req)
+		}
+		return verifySignatureWith(selector, req)
+	})
+}
+
+// TimestampCheck 检查请求的时间戳,需要放在 HeaderCheck 之后
+func (fw *Framework) TimestampCheck() Middleware {
+	return stage(func(req *Request) error {
+		return checkTimestamp(req.Timestamp, fw.now(), fw.tsPast, fw.tsFuture)
+	})
+}
+
+// AppKeyCheck 按照策略以及注册表检查appkey是否有效,需要放在 HeaderCheck 之后
+func (fw *Framework) AppKeyCheck() Middleware {
+	return stage(func(req *Request) error {
+		if !fw.appKeyRequired(req.Version) {
+			return nil
+		}
+		if fw.appKey.Valid != nil && !fw.appKey.Valid(req.AppKey) {
+			return &ept.Error{
+				Code:    immut.CodeExAppKey,
+				Message: "wrongful appkey",
+			}
+		}
+		if fw.registry != nil {
+			return fw.registry.Check(req)
+		}
+		return nil
+	})
+}
+
+// appKeyRequired 该版本的请求是否需要appkey
+func (fw *Framework) appKeyRequired(version string) bool {
+	ver, _ := strconv.ParseFloat(version, 64)
+	return fw.appKey.required(ver)
+}
+
+// ExRespHandler 异常响应处理,使用二进制protobuf输出
+func ExRespHandler(w http.ResponseWriter, err error) {
+	ExRespHandlerWith(w, ProtoCodec, err)
+}
+
+// ExRespHandlerWith 使用指定的编码输出异常响应,http状态码由 DefaultErrorMapper 决定
+func ExRespHandlerWith(w http.ResponseWriter, codec Codec, err error) {
+	WriteError(w, codec, DefaultErrorMapper, err)
+}
+
+// WriteError 输出异常响应,http状态码由 mapper 决定,没有设置 X-Server-Time 时使用当前时间
+// 使用 errors.As 获取错误链中的 *ept.Error,其他错误只返回通用的提示信息,原始的错误只记录日志
+func WriteError(w http.ResponseWriter, codec Codec, mapper *ErrorMapper, err error) {
+	writeError(nil, w, codec, mapper, err)
+}
+
+// writeError 输出异常响应,使用 logger 记录日志
+func writeError(logger *log.Logger, w http.ResponseWriter, codec Codec, mapper *ErrorMapper, err error) {
+	eptErr := ept.From(err)
+	if !mapper.silent(eptErr) {
+		if eptErr.Cause != nil {
+			logger.Errorf("code=%d, info=%s, cause=%v", eptErr.Code, eptErr.Message, eptErr.Cause)
+		} else {
+			logger.Error("code="+strconv.Itoa(int(eptErr.Code)), ", info="+eptErr.Message)
+		}
+	}
+	writeErrorResponse(w, codec, mapper.Status(eptErr), eptErr)
+}
+
+// writeErrorResponse 输出 ept.ErrorResponse,不记录日志
+func writeErrorResponse(w http.ResponseWriter, codec Codec, status int, eptErr *ept.Error) {
+	w.Header().Add(HeadServerEx, "1")
+	if w.Header().Get(HeadXServerTime) == "" {
+		w.Header().Set(HeadXServerTime, strconv.FormatInt(time.Now().UnixMilli(), 10))
+	}
+	w.Header().Set(HeadContentType, codec.ContentType())
+	w.WriteHeader(status)
+	resp := &ept.ErrorResponse{
+		Code: eptErr.Code,
+		Info: eptErr.Message,
+	}
+	data, _ := codec.Marshal(resp)
+	_, _ = w.Write(data)
+}
+
+// RespHandler 使用二进制protobuf输出响应
+func RespHandler(w http.ResponseWriter, pb proto.Message) {
+	RespHandlerWith(w, ProtoCodec, pb)
+}
+
+// RespHandlerWith 使用指定的编码输出响应
+func RespHandlerWith(w http.ResponseWriter, codec Codec, pb proto.Message) {
+	if pb == nil {
+		w.Write([]byte(""))
+		return
+	}
+	if log.IsDebug() {
+		log.Debugf("Resp = %s", pb)
+	}
+	result, err := codec.Marshal(pb)
+	if err != nil {
+		aErr := &ept.Error{
+			Code:    immut.CodeExProtobufMa,
+			Message: "Protobuf Ma Failed!!!",
+		}
+		ExRespHandlerWith(w, codec, aErr)
+		return
+	}
+	w.Header().Set(HeadContentType, codec.ContentType())
+	w.Write(result)
+}
+
+// checkMethod 对请求方法做判断
+func checkMethod(r *http.Request, methods ...string) error {
+	for _, m := range methods {
+		if r.Method == m {
+			return nil
+		}
+	}
+	return &ept.Error{
+		Code:    immut.CodeExHttpMethod,
+		Message: "must http " + strings.ToLower(strings.Join(methods, "/")),
+	}
+}
+
+// readHeaders 读取并检查请求头
+func (fw *Framework) readHeaders(req *Request) error {
+	r := req.Request
+	//判断请求头信息
+	version := r.Header.Get(HeadXVersion)
+	if version == immut.Blank {
+		return &ept.Error{
+			Code:    immut.CodeExVersion,
+			Message: "couldn't read head x-version",
+		}
+	}
+	ver, err := strconv.ParseFloat(version, 32)
+	if err != nil {
+		return &ept.Error{
+			Code:    immut.CodeExVersion,
+			Message: "x-version error",
+		}
+	}
+	if fw.minVersion > 0 && ver < fw.minVersion || fw.maxVersion > 0 && ver > fw.maxVersion {
+		return &ept.Error{
+			Code:    immut.CodeExVersion,
+			Message: "unsupported x-version " + version,
+		}
+	}
+	req.Version = version
+
+	//appkey不能为空
+	req.AppKey = r.Header.Get(HeadXAppKey)
+	if req.AppKey == immut.Blank && fw.appKey.required(ver) {
+		return &ept.Error{
+			Code:    immut.CodeExAppKey,
+			Message: "couldn't read req head appkey",
+		}
+	}
+
+	req.Nonce = r.Header.Get(HeadXNonce)
+	if req.Nonce == immut.Blank {
+		return &ept.Error{
+			Code:    immut.CodeExNonce,
+			Message: "couldn't req head nonce",
+		}
+	}
+
+	req.Timestamp = r.Header.Get(HeadXTimestamp)
+	if req.Timestamp == immut.Blank {
+		return &ept.Error{
+			Code:    immut.CodeExTs,
+			Message: "couldn't read req head ts",
+		}
+	}
+
+	req.Signature = r.Header.Get(HeadXSignature)
+	if req.Signature == immut.Blank {
+		return &ept.Error{
+			Code:    immut.CodeExSignature,
+			Message: "couldn't read head signature",
+		}
+	}
+
+	req.Encoding = r.Header.Get(HeadContentEncoding)
+	if log.IsDebug() {
+		logger := req.Logger()
+		logger.Debug("ts=", req.Timestamp)
+		logger.Debug("sn=", req.Signature)
+		logger.Debug("encoding=", req.Encoding)
+	}
+	return nil
+}
+
+// ParseTimestamp 解析请求的时间戳,同时支持秒和毫秒
+func ParseTimestamp(ts string) (time.Time, error) {
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n >= millisThreshold {
+		return time.UnixMilli(n), nil
+	}
+	return time.Unix(n, 0), nil
+}
+
+// checkTimestamp 对时间进行处理,早于 now 超过 past 为过期请求,晚于 now 超过 future 为时钟偏差过大的请求
+func checkTimestamp(ts string, now time.Time, past, future time.Duration) error {
+	tm, err := ParseTimestamp(ts)
+	if err != nil {
+		return &ept.Error{
+			Code:    immut.CodeExTs,
+			Message: "ts format Error!!!",
+		}
+	}
+
+	duration := now.Sub(tm)
+	//过期请求
+	if past >= 0 && duration > past {
+		return &ept.Error{
+			Code:    immut.CodeExTs,
+			Message: "ts duration error!!! duration=" + duration.String(),
+		}
+	}
+	//未来的请求
+	if future >= 0 && -duration > future {
+		return &ept.Error{
+			Code:    immut.CodeExTs,
+			Message: "ts ahead of server!!! duration=" + (-duration).String(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package httpframe
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/yeahyf/go_base/cache"
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+)
+
+func checkCode(t *testing.T, name string, err error, code uint32) {
+	t.Helper()
+	var eptErr *ept.Error
+	if code == 0 {
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		return
+	}
+	if !errors.As(err, &eptErr) || eptErr.Code != code {
+		t.Fatalf("%s: expected code %d, got %v", name, code, err)
+	}
+}
+
+func TestFrameworkAppKeyPolicy(t *testing.T) {
+	fw := New(WithAppKeyPolicy(AppKeyPolicy{MinVersion: 2.0, Valid: func(appkey string) bool {
+		return appkey == "app"
+	}}))
+	cases := []struct {
+		name    string
+		version string
+		appkey  string
+		code    uint32
+	}{
+		{"old version without appkey", "1.0", "", 0},
+		{"old version with unknown appkey", "1.0", "other", 0},
+		{"new version without appkey", "2.0", "", immut.CodeExAppKey},
+		{"new version with unknown appkey", "2.0", "other", immut.CodeExAppKey},
+		{"new version with valid appkey", "2.1", "app", 0},
+	}
+	for _, c := range cases {
+		r := newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+		r.Header.Set(HeadXVersion, c.version)
+		if c.appkey == "" {
+			r.Header.Del(HeadXAppKey)
+		} else {
+			r.Header.Set(HeadXAppKey, c.appkey)
+		}
+		_, err := fw.Check(nil, r)
+		checkCode(t, c.name, err, c.code)
+	}
+}
+
+// TestFrameworkAppKeyBeforeNonce 无效的appkey不记录nonce
+func TestFrameworkAppKeyBeforeNonce(t *testing.T) {
+	seen := 0
+	fw := New(WithAppKeyPolicy(AppKeyPolicy{Valid: func(appkey string) bool {
+		return appkey == "app"
+	}}), WithNonceStore(NonceFunc(func(nonce string) bool {
+		seen++
+		return false
+	})))
+	r := newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	r.Header.Set(HeadXAppKey, "other")
+	_, err := fw.Check(nil, r)
+	checkCode(t, "unknown appkey", err, immut.CodeExAppKey)
+	if seen != 0 {
+		t.Fatalf("nonce recorded for unknown appkey")
+	}
+	_, err = fw.Check(nil, newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false))
+	checkCode(t, "valid appkey", err, 0)
+	if seen != 1 {
+		t.Fatalf("nonce not recorded for valid appkey")
+	}
+}
+
+func TestFrameworkVersionAndTimestamp(t *testing.T) {
+	fw := New(WithVersionRange(1.0, 2.0), WithTimestampTolerance(time.Minute))
+
+	r := newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	r.Header.Set(HeadXVersion, "3.0")
+	_, err := fw.Check(nil, r)
+	checkCode(t, "version out of range", err, immut.CodeExVersion)
+
+	r = newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	ts := strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	r.Header.Set(HeadXTimestamp, ts)
+	body := mustMarshal(t, &ept.ErrorResponse{Code: 1})
+	r.Header.Set(HeadXSignature, sha1Sign(body, r.Header.Get(HeadXNonce), ts))
+	_, err = fw.Check(nil, r)
+	checkCode(t, "expired timestamp", err, immut.CodeExTs)
+
+	//默认允许3分钟
+	r = newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	r.Header.Set(HeadXTimestamp, ts)
+	r.Header.Set(HeadXSignature, sha1Sign(body, r.Header.Get(HeadXNonce), ts))
+	_, err = New().Check(nil, r)
+	checkCode(t, "default tolerance", err, 0)
+}
+
+func TestCommonCacheNonce(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	pool := cache.NewRedisPool(1, 2, 1, mr.Addr(), "")
+	fw := New(WithNonceStore(&CommonCache{ReadCache: pool, WriteCache: pool}))
+
+	r := newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	nonce := r.Header.Get(HeadXNonce)
+	_, err = fw.Check(nil, r)
+	checkCode(t, "first request", err, 0)
+
+	r = newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	r.Header.Set(HeadXNonce, nonce)
+	r.Header.Set(HeadXSignature, sha1Sign(mustMarshal(t, &ept.ErrorResponse{Code: 1}), nonce, r.Header.Get(HeadXTimestamp)))
+	_, err = fw.Check(nil, r)
+	checkCode(t, "repeated nonce", err, immut.CodeExRepeatReq)
+	if ttl := mr.TTL(nonce); ttl != NonceExpire*time.Second {
+		t.Fatalf("unexpected nonce ttl %v", ttl)
+	}
+
+	//Redis不可用时返回内部错误,不暴露连接信息
+	mr.Close()
+	handler := fw.Handler(echo, &ept.ErrorResponse{})
+	w := httptest.NewRecorder()
+	handler(w, newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false))
+	if e := decodeError(t, w); w.Code != http.StatusInternalServerError || e == nil || e.Code != immut.CodeExRedis ||
+		e.Info != "Read Redis Data Error!!!" {
+		t.Fatalf("unexpected response %d %v", w.Code, e)
+	}
+}
+
+func TestTimestampWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	body := mustMarshal(t, &ept.ErrorResponse{Code: 1})
+	cases := []struct {
+		name   string
+		opt    Option
+		ts     string
+		code   uint32
+		header bool
+	}{
+		{"seconds within window", WithTimestampTolerance(time.Minute), "1700000030", 0, false},
+		{"millis within window", WithTimestampTolerance(time.Minute), "1699999970500", 0, false},
+		{"expired", WithTimestampTolerance(time.Minute), "1699999900", immut.CodeExTs, true},
+		{"expired millis", WithTimestampTolerance(time.Minute), "1699999900000", immut.CodeExTs, true},
+		{"far future", WithTimestampTolerance(time.Minute), "1700003600", immut.CodeExTs, true},
+		{"future unlimited", WithTimestampWindow(time.Minute, -1), "1800000000", 0, false},
+		{"past unlimited", WithTimestampWindow(-1, 0), "1600000000", 0, false},
+		{"future not allowed", WithTimestampWindow(-1, 0), "1700000001", immut.CodeExTs, true},
+		{"bad format", WithTimestampTolerance(time.Minute), "abc", immut.CodeExTs, true},
+	}
+	for _, c := range cases {
+		handler := New(c.opt, WithClock(clock)).Handler(echo, &ept.ErrorResponse{})
+		r := newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+		r.Header.Set(HeadXTimestamp, c.ts)
+		r.Header.Set(HeadXSignature, sha1Sign(body, r.Header.Get(HeadXNonce), c.ts))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		e := decodeError(t, w)
+		if c.code == 0 && e != nil || c.code != 0 && (e == nil || e.Code != c.code) {
+			t.Fatalf("%s: unexpected response %v", c.name, e)
+		}
+		serverTime := w.Header().Get(HeadXServerTime)
+		if c.header && serverTime != strconv.FormatInt(now.UnixMilli(), 10) || !c.header && serverTime != "" {
+			t.Fatalf("%s: unexpected server time %q", c.name, serverTime)
+		}
+	}
+}
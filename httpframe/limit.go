@@ -0,0 +1,113 @@
+package httpframe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/utils"
+)
+
+// BodyLimit 请求体的大小限制,小于等于0表示不限制
+type BodyLimit struct {
+	MaxBodySize    int64 //原始请求体的最大字节数,压缩的请求为压缩之后的大小
+	MaxDecodedSize int64 //解压之后的最大字节数
+}
+
+// DefaultBodyLimit 默认的请求体大小限制,limit 参数为nil时使用,需要在启动阶段修改
+var DefaultBodyLimit = &BodyLimit{MaxBodySize: 8 << 20, MaxDecodedSize: 32 << 20}
+
+// bodyTooLarge 请求体超过限制的错误,响应的状态码为413
+func bodyTooLarge(limit int64) error {
+	return &ept.Error{
+		Code:    immut.CodeExBodyTooLarge,
+		Message: "request body too large, limit=" + strconv.FormatInt(limit, 10),
+	}
+}
+
+// ReadRequestBody 读取原始的请求体,超过 MaxBodySize 时返回 CodeExBodyTooLarge
+// w 用于 http.MaxBytesReader 在超过限制之后关闭连接,可以为nil
+func ReadRequestBody(w http.ResponseWriter, r *http.Request, limit *BodyLimit) ([]byte, error) {
+	//拿到数据就关闭掉
+	defer utils.CloseAction(r.Body)
+	if limit == nil {
+		limit = DefaultBodyLimit
+	}
+
+	maxSize := limit.MaxBodySize
+	body := io.Reader(r.Body)
+	if maxSize > 0 {
+		//声明的长度已经超过限制时不再读取
+		if r.ContentLength > maxSize {
+			return nil, bodyTooLarge(maxSize)
+		}
+		body = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+	var b bytes.Buffer
+	if r.ContentLength > 0 {
+		b.Grow(int(r.ContentLength))
+	}
+	if _, err := io.Copy(&b, body); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, bodyTooLarge(maxSize)
+		}
+		return nil, &ept.Error{
+			Code:    immut.CodeExReadIO,
+			Message: "couldn't read req body " + err.Error(),
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// DecodeBody 根据 encoding 解压请求体,解压之后超过 MaxDecodedSize 时返回 CodeExBodyTooLarge
+// 解压过程中一旦超过限制就停止读取,避免压缩炸弹占用内存,无法解压的数据返回 CodeExProtobufUn
+func DecodeBody(encoding string, body []byte, limit *BodyLimit) ([]byte, error) {
+	//无压缩
+	if encoding != EncodingType {
+		return body, nil
+	}
+	if limit == nil {
+		limit = DefaultBodyLimit
+	}
+
+	//解压缩
+	gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, &ept.Error{
+			Code:    immut.CodeExProtobufUn,
+			Message: "couldn't gunzip data " + err.Error(),
+		}
+	}
+	defer utils.CloseAction(gzipReader)
+
+	maxSize := limit.MaxDecodedSize
+	reader := io.Reader(gzipReader)
+	//默认为5倍的压缩大小
+	size := int64(len(body)) * 5
+	if maxSize > 0 {
+		//多读取一个字节用于判断是否超过限制
+		reader = io.LimitReader(gzipReader, maxSize+1)
+		size = min(size, maxSize)
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(size))
+	//请注意读取到unexpected EOF也是可以将数据读取完整的
+	if _, err = io.Copy(&buf, reader); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, &ept.Error{
+			Code:    immut.CodeExProtobufUn,
+			Message: "couldn't read gzip data " + err.Error(),
+		}
+	}
+	if maxSize > 0 && int64(buf.Len()) > maxSize {
+		log.Errorf("decoded body exceeds limit, compressed size = %d, limit = %d", len(body), maxSize)
+		return nil, bodyTooLarge(maxSize)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+package httpframe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+)
+
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func isTooLarge(err error) bool {
+	var eptErr *ept.Error
+	return errors.As(err, &eptErr) && eptErr.Code == immut.CodeExBodyTooLarge
+}
+
+func TestReadRequestBody(t *testing.T) {
+	limit := &BodyLimit{MaxBodySize: 10}
+
+	r := httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(make([]byte, 10)))
+	if body, err := ReadRequestBody(nil, r, limit); err != nil || len(body) != 10 {
+		t.Fatalf("unexpected body %d, %v", len(body), err)
+	}
+
+	//声明的长度超过限制
+	r = httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(make([]byte, 11)))
+	if _, err := ReadRequestBody(nil, r, limit); !isTooLarge(err) {
+		t.Fatalf("expected too large, got %v", err)
+	}
+
+	//没有声明长度时在读取过程中判断
+	r = httptest.NewRequest(http.MethodPost, "/api", io.MultiReader(bytes.NewReader(make([]byte, 11))))
+	r.ContentLength = -1
+	if _, err := ReadRequestBody(httptest.NewRecorder(), r, limit); !isTooLarge(err) {
+		t.Fatalf("expected too large, got %v", err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(make([]byte, 100)))
+	if body, err := ReadRequestBody(nil, r, &BodyLimit{}); err != nil || len(body) != 100 {
+		t.Fatalf("zero limit should not limit: %d, %v", len(body), err)
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	//压缩之后很小,解压之后为1MB
+	bomb := gzipBytes(make([]byte, 1<<20))
+	limit := &BodyLimit{MaxDecodedSize: 1 << 16}
+	if _, err := DecodeBody(EncodingType, bomb, limit); !isTooLarge(err) {
+		t.Fatalf("expected too large, got %v", err)
+	}
+	data, err := DecodeBody(EncodingType, bomb, &BodyLimit{MaxDecodedSize: 1 << 20})
+	if err != nil || len(data) != 1<<20 {
+		t.Fatalf("unexpected data %d, %v", len(data), err)
+	}
+	if data, err = DecodeBody("", []byte("raw"), limit); err != nil || string(data) != "raw" {
+		t.Fatalf("unexpected data %q, %v", data, err)
+	}
+
+	//无法解压的数据属于客户端的错误
+	corrupt := gzipBytes([]byte("hello"))
+	corrupt[len(corrupt)-10] ^= 0xff
+	for _, body := range [][]byte{[]byte("not gzip"), corrupt} {
+		_, err = DecodeBody(EncodingType, body, limit)
+		checkCode(t, "malformed gzip", err, immut.CodeExProtobufUn)
+		if status := DefaultErrorMapper.Status(ept.From(err)); status != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", status)
+		}
+	}
+}
+
+func TestServeBodyTooLarge(t *testing.T) {
+	limit := &BodyLimit{MaxBodySize: 1 << 10, MaxDecodedSize: 1 << 12}
+	handler := Serve(Chain(WrapperHandler(echo),
+		ReadBodyLimit(limit), DecompressLimit(limit), Unmarshal(&ept.ErrorResponse{})))
+
+	cases := []struct {
+		name     string
+		body     []byte
+		encoding string
+	}{
+		{"compressed body", make([]byte, 2<<10), ""},
+		{"decoded body", gzipBytes(mustMarshal(t, &ept.ErrorResponse{Info: string(make([]byte, 8<<10))})), EncodingType},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(c.body))
+		if c.encoding != "" {
+			r.Header.Set(HeadContentEncoding, c.encoding)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: expected 413, got %d", c.name, w.Code)
+		}
+		if e := decodeError(t, w); e == nil || e.Code != immut.CodeExBodyTooLarge {
+			t.Fatalf("%s: unexpected error %v", c.name, e)
+		}
+	}
+}
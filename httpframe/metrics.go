@@ -0,0 +1,69 @@
+package httpframe
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yeahyf/go_base/metrics"
+)
+
+// unmatchedPath 没有匹配 http.ServeMux 模式的请求使用的 path 标签,避免按照任意的请求路径产生无限的时间序列
+const unmatchedPath = "unmatched"
+
+// HTTPMetrics http请求的指标,按照路由区分,路由使用 http.ServeMux 匹配的模式,没有时统一记为 unmatched
+type HTTPMetrics struct {
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	reqSize  *metrics.Histogram
+	respSize *metrics.Histogram
+}
+
+// NewHTTPMetrics 在 reg 中注册http请求的指标,同一个 reg 多次调用时共用相同的指标
+func NewHTTPMetrics(reg *metrics.Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: reg.NewCounter("http_requests_total", "Total number of HTTP requests.", "path", "status", "code"),
+		duration: reg.NewHistogram("http_request_duration_seconds", "HTTP request latency.", nil, "path"),
+		reqSize:  reg.NewHistogram("http_request_size_bytes", "HTTP request body size.", metrics.SizeBuckets, "path"),
+		respSize: reg.NewHistogram("http_response_size_bytes", "HTTP response body size.", metrics.SizeBuckets, "path"),
+	}
+}
+
+// defaultHTTPMetrics 注册在 metrics.Default 中的指标,Framework 默认使用
+var defaultHTTPMetrics = sync.OnceValue(func() *HTTPMetrics {
+	return NewHTTPMetrics(metrics.Default)
+})
+
+// panicTotal 恢复的panic次数
+var panicTotal = metrics.Default.NewCounter("http_panics_total", "Total number of recovered panics in HTTP handlers.")
+
+// Instrument 记录指标的http中间件,用于没有使用 Framework 的 http.HandlerFunc,m 为nil时使用 metrics.Default
+func Instrument(m *HTTPMetrics, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	if m == nil {
+		m = defaultHTTPMetrics()
+	}
+	return track(nil, m, next)
+}
+
+// observe 记录一次请求,code 为 ept.Error 的错误码,成功时为0
+func (m *HTTPMetrics) observe(r *http.Request, status int, code uint32, reqSize, respSize int64, latency time.Duration) {
+	path := r.Pattern
+	if path == "" {
+		path = unmatchedPath
+	}
+	m.requests.Inc(path, strconv.Itoa(status), strconv.FormatUint(uint64(code), 10))
+	m.duration.Observe(latency.Seconds(), path)
+	m.reqSize.Observe(float64(reqSize), path)
+	m.respSize.Observe(float64(respSize), path)
+}
+
+// CompressObserver 在 reg 中记录压缩前后的字节数,可以作为 CompressConf.Observer
+func CompressObserver(reg *metrics.Registry) func(encoding string, raw, compressed int) {
+	rawBytes := reg.NewCounter("http_response_raw_bytes_total", "Response bytes before compression.", "encoding")
+	compressedBytes := reg.NewCounter("http_response_compressed_bytes_total", "Response bytes after compression.", "encoding")
+	return func(encoding string, raw, compressed int) {
+		rawBytes.Add(float64(raw), encoding)
+		compressedBytes.Add(float64(compressed), encoding)
+	}
+}
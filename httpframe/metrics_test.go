@@ -0,0 +1,63 @@
+package httpframe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/metrics"
+)
+
+func TestFrameworkMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/{name}", HandleWith(New(WithMetrics(reg)),
+		func(ctx context.Context, req *ept.ErrorResponse) (*ept.ErrorResponse, error) {
+			if req.Code == 0 {
+				return nil, &ept.Error{Code: 2001, Message: "bad"}
+			}
+			return req, nil
+		}))
+
+	for _, code := range []uint32{1, 2, 0} {
+		r := newSignedRequest(t, &ept.ErrorResponse{Code: code}, false)
+		r.URL.Path = "/api/x"
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	m := NewHTTPMetrics(reg)
+	if v := m.requests.Value("POST /api/{name}", "200", "0"); v != 2 {
+		t.Fatalf("unexpected success count %v", v)
+	}
+	if v := m.requests.Value("POST /api/{name}", "400", "2001"); v != 1 {
+		t.Fatalf("unexpected error count %v", v)
+	}
+	if n, sum := m.reqSize.Count("POST /api/{name}"); n != 3 || sum == 0 {
+		t.Fatalf("unexpected request size %d %v", n, sum)
+	}
+	var b strings.Builder
+	_, _ = reg.WriteTo(&b)
+	if !strings.Contains(b.String(), `http_request_duration_seconds_count{path="POST /api/{name}"} 3`) {
+		t.Fatalf("unexpected metrics\n%s", b.String())
+	}
+
+	//没有经过 http.ServeMux 的请求不按照路径区分
+	echoHandler := func(ctx context.Context, req *ept.ErrorResponse) (*ept.ErrorResponse, error) {
+		return req, nil
+	}
+	HandleWith(New(WithMetrics(reg)), echoHandler)(httptest.NewRecorder(), newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false))
+	if v := m.requests.Value(unmatchedPath, "200", "0"); v != 1 {
+		t.Fatalf("unexpected unmatched count %v", v)
+	}
+
+	//WithMetrics(nil) 不记录
+	handler := HandleWith(New(WithMetrics(nil)), echoHandler)
+	before := defaultHTTPMetrics().requests.Value(unmatchedPath, "200", "0")
+	handler(httptest.NewRecorder(), newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false))
+	if defaultHTTPMetrics().requests.Value(unmatchedPath, "200", "0") != before {
+		t.Fatal("metrics should be disabled")
+	}
+}
@@ -0,0 +1,222 @@
+package httpframe
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// Request 一次请求在中间件之间传递的数据,由各个阶段逐步填充
+type Request struct {
+	*http.Request
+
+	Writer    http.ResponseWriter //响应
+	Version   string              //X-Version
+	AppKey    string              //X-AppKey
+	Nonce     string              //X-Nonce
+	Timestamp string              //X-Timestamp
+	Signature string              //X-Signature
+	Encoding  string              //Content-Encoding
+	Body      []byte              //原始的请求体,签名基于该数据计算
+	Data      []byte              //解压之后的请求数据
+	Msg       proto.Message       //反序列化之后的请求消息
+	Key       *AppKeyInfo         //注册表中appkey的信息,配置了 WithAppKeyRegistry 时存在
+	Codec     Codec               //请求的编码,由 Content-Type 决定
+	RespCodec Codec               //响应的编码,由 Accept 决定
+}
+
+// Logger 请求的日志,经过 AccessLog 时附带 request_id
+func (req *Request) Logger() *log.Logger {
+	if req.Request == nil {
+		return nil
+	}
+	return log.FromContext(req.Context())
+}
+
+// Handler 处理一次请求,返回的消息由 Serve 输出,为nil时不输出,错误统一由 ExRespHandler 输出
+type Handler func(req *Request) (proto.Message, error)
+
+// Middleware 中间件,可以在调用下一个处理之前做检查,或者在之后处理结果
+type Middleware func(next Handler) Handler
+
+// Chain 组合中间件,第一个中间件最先执行,h 在所有中间件之后执行
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Serve 使用默认配置的框架将 Handler 转为 http.HandlerFunc,参见 Framework.Serve
+func Serve(h Handler) func(w http.ResponseWriter, r *http.Request) {
+	return New().Serve(h)
+}
+
+// WrapperHandler 将业务逻辑 Wrapper 转为 Handler,需要放在 Unmarshal 之后
+func WrapperHandler(httpWrapper Wrapper) Handler {
+	return func(req *Request) (proto.Message, error) {
+		return httpWrapper(req.Msg)
+	}
+}
+
+// DefaultStages AbstractHandler 使用的中间件,参见 Framework.Stages
+// repeatCheck、appKeyCheck 为nil时跳过对应的检查
+func DefaultStages(repeatCheck IsRepeatReq, appKeyCheck IsValidAppKey, reqPb proto.Message) []Middleware {
+	opts := []Option{WithAppKeyPolicy(AppKeyPolicy{Valid: appKeyCheck})}
+	if repeatCheck != nil {
+		opts = append(opts, WithNonceStore(NonceFunc(repeatCheck)))
+	}
+	return New(opts...).Stages(reqPb)
+}
+
+// stage 将一个检查步骤转为中间件
+func stage(check func(req *Request) error) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request) (proto.Message, error) {
+			if err := check(req); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}
+}
+
+// MethodCheck 检查请求方法
+func MethodCheck(methods ...string) Middleware {
+	return stage(func(req *Request) error {
+		return checkMethod(req.Request, methods...)
+	})
+}
+
+// HeaderCheck 使用默认配置读取并检查 X-Version、X-AppKey、X-Nonce、X-Timestamp、X-Signature 请求头
+func HeaderCheck() Middleware {
+	return New().HeaderCheck()
+}
+
+// ReadBody 使用 DefaultBodyLimit 读取原始的请求体
+func ReadBody() Middleware {
+	return ReadBodyLimit(nil)
+}
+
+// ReadBodyLimit 读取原始的请求体,超过 limit.MaxBodySize 时返回 CodeExBodyTooLarge
+func ReadBodyLimit(limit *BodyLimit) Middleware {
+	return stage(func(req *Request) (err error) {
+		req.Body, err = ReadRequestBody(req.Writer, req.Request, limit)
+		return err
+	})
+}
+
+// SignatureCheck 使用 DefaultSchemes 校验签名,需要放在 HeaderCheck、ReadBody 之后
+func SignatureCheck() Middleware {
+	return stage(verifySignature)
+}
+
+// SignatureCheckWith 使用指定的算法选择校验签名,需要放在 HeaderCheck、ReadBody 之后
+func SignatureCheckWith(selector SchemeSelector) Middleware {
+	return stage(func(req *Request) error {
+		return verifySignatureWith(selector, req)
+	})
+}
+
+// TimestampCheck 使用默认的误差检查请求的时间戳,需要放在 HeaderCheck 之后
+func TimestampCheck() Middleware {
+	return New().TimestampCheck()
+}
+
+// Decompress 按照 Content-Encoding 解压请求体,使用 DefaultBodyLimit,需要放在 ReadBody 之后
+func Decompress() Middleware {
+	return DecompressLimit(nil)
+}
+
+// DecompressLimit 按照 Content-Encoding 解压请求体,解压之后超过 limit.MaxDecodedSize 时返回 CodeExBodyTooLarge
+func DecompressLimit(limit *BodyLimit) Middleware {
+	return stage(func(req *Request) (err error) {
+		//没有经过 HeaderCheck 时直接读取请求头
+		if req.Encoding == "" {
+			req.Encoding = req.Header.Get(HeadContentEncoding)
+		}
+		req.Data, err = DecodeBody(req.Encoding, req.Body, limit)
+		return err
+	})
+}
+
+// RepeatCheck 使用 nonce 检查重复请求,repeatCheck 为nil时不检查
+func RepeatCheck(repeatCheck IsRepeatReq) Middleware {
+	if repeatCheck == nil {
+		return NonceCheck(nil)
+	}
+	return NonceCheck(NonceFunc(repeatCheck))
+}
+
+// NonceCheck 使用 store 检查重复请求,store 为nil时不检查
+func NonceCheck(store NonceStore) Middleware {
+	return stage(func(req *Request) error {
+		if store == nil {
+			return nil
+		}
+		seen, err := store.Seen(req.Nonce)
+		if err != nil {
+			return ept.Wrap(immut.CodeExRedis, "Read Redis Data Error!!!", err)
+		}
+		if seen {
+			return &ept.Error{
+				Code:    immut.CodeExRepeatReq,
+				Message: "repeat req error",
+			}
+		}
+		return nil
+	})
+}
+
+// AppKeyCheck 检查appkey是否有效,appKeyCheck 为nil时不检查
+func AppKeyCheck(appKeyCheck IsValidAppKey) Middleware {
+	return stage(func(req *Request) error {
+		if appKeyCheck != nil && !appKeyCheck(req.AppKey) {
+			return &ept.Error{
+				Code:    immut.CodeExAppKey,
+				Message: "wrongful appkey",
+			}
+		}
+		return nil
+	})
+}
+
+// Unmarshal 按照请求的编码将请求数据反序列化为与 reqPb 类型相同的新消息,每个请求使用独立的消息
+// 没有经过 Decompress 时使用原始的请求体
+func Unmarshal(reqPb proto.Message) Middleware {
+	return stage(func(req *Request) error {
+		msg := reqPb.ProtoReflect().New().Interface()
+		if err := decodeMsg(req, msg); err != nil {
+			return err
+		}
+		req.Msg = msg
+		return nil
+	})
+}
+
+// decodeMsg 按照请求的编码将请求数据反序列化到 msg
+func decodeMsg(req *Request, msg proto.Message) error {
+	data := req.Data
+	if data == nil {
+		data = req.Body
+	}
+	codec := req.Codec
+	if codec == nil {
+		codec = ProtoCodec
+	}
+	if err := codec.Unmarshal(data, msg); err != nil {
+		req.Logger().Errorf("couldn't unmarshal type = %s info = %v", reflect.TypeOf(msg).Elem().Name(), err)
+		return &ept.Error{
+			Code:    immut.CodeExProtobufUn,
+			Message: "unmarshal error",
+		}
+	}
+	if log.IsDebug() {
+		req.Logger().Debugf("req = %s", msg)
+	}
+	return nil
+}
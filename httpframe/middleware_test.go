@@ -0,0 +1,195 @@
+package httpframe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeahyf/go_base/crypto"
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// logDir 测试日志的目录
+var logDir string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "httphandle_test")
+	if err != nil {
+		panic(err)
+	}
+	logDir = dir
+	logFile := filepath.Join(dir, "zap.json")
+	config := `{"level": "error", "logs": [
+		{"logpath": "` + filepath.Join(dir, "debug.log") + `", "name": "debug"},
+		{"logpath": "` + filepath.Join(dir, "info.log") + `", "name": "info"},
+		{"logpath": "` + filepath.Join(dir, "error.log") + `", "name": "error"},
+		{"logpath": "` + filepath.Join(dir, "warn.log") + `", "name": "warn"}]}`
+	if err = os.WriteFile(logFile, []byte(config), 0644); err != nil {
+		panic(err)
+	}
+	log.SetLogConf(&logFile)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// sha1Sign 按照 ReqBaseCheck 的规则计算签名
+func sha1Sign(body []byte, nonce, ts string) string {
+	l := []string{*crypto.MD54Bytes(body), nonce, ts}
+	sort.Strings(l)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(l, "&"))))
+}
+
+// newSignedRequest 构建一个签名正确的请求
+func newSignedRequest(t *testing.T, msg proto.Message, compress bool) *http.Request {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(body)
+		_ = zw.Close()
+		body = buf.Bytes()
+	}
+	nonce := strconv.FormatInt(time.Now().UnixNano(), 36)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(body))
+	r.Header.Set(HeadXVersion, "1.0")
+	r.Header.Set(HeadXAppKey, "app")
+	r.Header.Set(HeadXNonce, nonce)
+	r.Header.Set(HeadXTimestamp, ts)
+	r.Header.Set(HeadXSignature, sha1Sign(body, nonce, ts))
+	if compress {
+		r.Header.Set(HeadContentEncoding, EncodingType)
+	}
+	return r
+}
+
+// decodeError 解析错误响应,没有 X-Server-Ex 时返回nil
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) *ept.ErrorResponse {
+	if w.Header().Get(HeadServerEx) == "" {
+		return nil
+	}
+	resp := &ept.ErrorResponse{}
+	if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func echo(pb proto.Message) (proto.Message, error) {
+	req := pb.(*ept.ErrorResponse)
+	return &ept.ErrorResponse{Code: req.Code + 1, Info: req.Info}, nil
+}
+
+func TestFrameworkHandler(t *testing.T) {
+	seen := map[string]bool{}
+	repeat := func(nonce string) bool {
+		defer func() { seen[nonce] = true }()
+		return seen[nonce]
+	}
+	handler := New(WithNonceStore(NonceFunc(repeat)),
+		WithAppKeyPolicy(AppKeyPolicy{Valid: func(appkey string) bool { return appkey == "app" }}),
+	).Handler(echo, &ept.ErrorResponse{})
+
+	r := newSignedRequest(t, &ept.ErrorResponse{Code: 1, Info: "hi"}, true)
+	nonce := r.Header.Get(HeadXNonce)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if e := decodeError(t, w); e != nil {
+		t.Fatalf("unexpected error %v", e)
+	}
+	resp := &ept.ErrorResponse{}
+	if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Code != 2 || resp.Info != "hi" {
+		t.Fatalf("unexpected response %v, %v", resp, err)
+	}
+
+	//重复的nonce
+	r = newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	r.Header.Set(HeadXNonce, nonce)
+	r.Header.Set(HeadXSignature, sha1Sign(mustMarshal(t, &ept.ErrorResponse{Code: 1}), nonce, r.Header.Get(HeadXTimestamp)))
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if e := decodeError(t, w); e == nil || e.Code != immut.CodeExRepeatReq {
+		t.Fatalf("expected repeat error, got %v", e)
+	}
+
+	//签名错误
+	r = newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	r.Header.Set(HeadXSignature, "bad")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if e := decodeError(t, w); e == nil || e.Code != immut.CodeExSignature {
+		t.Fatalf("expected signature error, got %v", e)
+	}
+}
+
+func mustMarshal(t *testing.T, msg proto.Message) []byte {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(req *Request) (proto.Message, error) {
+				order = append(order, name)
+				return next(req)
+			}
+		}
+	}
+	token := func(next Handler) Handler {
+		return func(req *Request) (proto.Message, error) {
+			if req.Header.Get("Authorization") != "Bearer ok" {
+				return nil, ept.New(immut.CodeExAppKey, "no token")
+			}
+			return next(req)
+		}
+	}
+	//不校验签名与时间戳,使用token鉴权
+	handler := Serve(Chain(WrapperHandler(echo),
+		trace("first"), token, trace("second"), ReadBody(), Unmarshal(&ept.ErrorResponse{})))
+
+	body := mustMarshal(t, &ept.ErrorResponse{Code: 5})
+	r := httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if e := decodeError(t, w); e == nil || e.Code != immut.CodeExAppKey {
+		t.Fatalf("expected token error, got %v", e)
+	}
+	if strings.Join(order, ",") != "first" {
+		t.Fatalf("unexpected order %v", order)
+	}
+
+	order = nil
+	r = httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer ok")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	resp := &ept.ErrorResponse{}
+	if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Code != 6 {
+		t.Fatalf("unexpected response %v, %v", resp, err)
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
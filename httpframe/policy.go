@@ -0,0 +1,53 @@
+package httpframe
+
+import (
+	"github.com/yeahyf/go_base/cache"
+)
+
+// AppKeyPolicy appkey的检查策略
+type AppKeyPolicy struct {
+	MinVersion float64                  //X-Version 大于等于该值时才要求并检查appkey,0表示所有版本
+	Valid      func(appkey string) bool //判断appkey是否有效,为nil时只要求不为空
+}
+
+// required 该版本的请求是否需要appkey
+func (p *AppKeyPolicy) required(version float64) bool {
+	return version >= p.MinVersion
+}
+
+// NonceStore 记录使用过的 nonce,用于拒绝重复的请求
+type NonceStore interface {
+	// Seen 判断 nonce 是否已经使用过,没有使用过时记录下来
+	Seen(nonce string) (bool, error)
+}
+
+// NonceFunc 使用函数实现 NonceStore,返回true表示重复请求
+type NonceFunc func(nonce string) bool
+
+// Seen 判断 nonce 是否已经使用过
+func (f NonceFunc) Seen(nonce string) (bool, error) {
+	return f(nonce), nil
+}
+
+// NonceExpire nonce 在Redis中保存的时间,单位秒
+const NonceExpire = 5 * 60
+
+// CommonCache 使用Redis记录 nonce,读写可以使用不同的连接池
+type CommonCache struct {
+	ReadCache  *cache.RedisPool
+	WriteCache *cache.RedisPool
+}
+
+// Seen 判断 nonce 是否已经使用过,没有使用过时写入并保存 NonceExpire 秒
+func (c *CommonCache) Seen(nonce string) (bool, error) {
+	value, err := c.ReadCache.GetValue(nonce)
+	if err != nil {
+		return false, err
+	}
+	//存在值,说明已经提交过了
+	if value != "" {
+		return true, nil
+	}
+	_ = c.WriteCache.SetValue(nonce, "1", NonceExpire)
+	return false, nil
+}
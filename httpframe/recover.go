@@ -0,0 +1,50 @@
+package httpframe
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/log"
+)
+
+// PanicHook 处理请求时发生panic的回调,可以将panic上报到其他系统,stack 为发生panic的堆栈
+type PanicHook func(r *http.Request, value any, stack []byte)
+
+// PanicCount 处理请求时恢复的panic次数,同时记录在 metrics.Default 的 http_panics_total 中
+func PanicCount() int64 {
+	return int64(panicTotal.Value())
+}
+
+// Recover 恢复处理请求时的panic,记录日志以及堆栈,并返回 CodeExInternal 的错误响应
+// 用于没有使用 Framework 的 http.HandlerFunc,hook 可以为nil
+func Recover(hook PanicHook, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if value := recover(); value != nil {
+				setAccessEntry(r.Context(), "", immut.CodeExInternal)
+				recovered(log.FromContext(r.Context()), w, r, ResponseCodec(r), DefaultErrorMapper, hook, value)
+			}
+		}()
+		next(w, r)
+	}
+}
+
+// recovered 处理恢复的panic,http.ErrAbortHandler 继续抛出,由 net/http 中断连接
+func recovered(logger *log.Logger, w http.ResponseWriter, r *http.Request, codec Codec, mapper *ErrorMapper,
+	hook PanicHook, value any) {
+	if err, ok := value.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+		panic(value)
+	}
+	stack := debug.Stack()
+	panicTotal.Inc()
+	logger.Errorf("panic: %v, path = %s\n%s", value, r.URL.Path, stack)
+	if hook != nil {
+		hook(r, value, stack)
+	}
+	eptErr := ept.Wrap(immut.CodeExInternal, ept.UnknownMessage, fmt.Errorf("panic: %v", value))
+	writeErrorResponse(w, codec, mapper.Status(eptErr), eptErr)
+}
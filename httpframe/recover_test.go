@@ -0,0 +1,65 @@
+package httpframe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+)
+
+func TestFrameworkRecover(t *testing.T) {
+	var hooked any
+	handler := HandleWith(New(WithPanicHook(func(r *http.Request, value any, stack []byte) {
+		if !strings.Contains(string(stack), "recover_test.go") {
+			t.Errorf("unexpected stack %s", stack)
+		}
+		hooked = value
+	})), func(ctx context.Context, req *ept.ErrorResponse) (*ept.ErrorResponse, error) {
+		panic("boom")
+	})
+
+	before := PanicCount()
+	w := httptest.NewRecorder()
+	handler(w, newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false))
+	e := decodeError(t, w)
+	if w.Code != http.StatusInternalServerError || e == nil || e.Code != immut.CodeExInternal || e.Info != ept.UnknownMessage {
+		t.Fatalf("unexpected response %d %v", w.Code, e)
+	}
+	if hooked != "boom" || PanicCount() != before+1 {
+		t.Fatalf("unexpected hook value %v, count %d", hooked, PanicCount()-before)
+	}
+	if errLog := readLog(t, "error.log"); !strings.Contains(errLog, "panic: boom, path = /api") {
+		t.Fatalf("panic not logged %s", errLog)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := Recover(nil, func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Fatalf("expected ErrAbortHandler, got %v", r)
+		}
+	}()
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api", nil))
+}
+
+func TestRecoverJSON(t *testing.T) {
+	handler := Recover(nil, func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["a"] = 1
+	})
+	r := httptest.NewRequest(http.MethodPost, "/api", nil)
+	r.Header.Set(HeadAccept, ContentTypeJSON)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusInternalServerError || w.Header().Get(HeadContentType) != ContentTypeJSON ||
+		!strings.Contains(w.Body.String(), "1102") {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,333 @@
+package httpframe
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yeahyf/go_base/cache"
+	"github.com/yeahyf/go_base/cfg"
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/log"
+)
+
+// AppKeyInfo appkey的元数据
+type AppKeyInfo struct {
+	AppKey     string   `json:"appkey"`
+	Secret     string   `json:"secret"`      //签名使用的密钥
+	Enabled    bool     `json:"enabled"`     //是否启用,json中没有该字段时默认启用
+	Paths      []string `json:"paths"`       //允许访问的接口路径,以*结尾表示前缀匹配,为空表示不限制
+	Quota      int      `json:"quota"`       //每秒允许的请求数,小于等于0表示不限制
+	MinVersion float64  `json:"min_version"` //允许的最低 X-Version,0表示不限制
+}
+
+// UnmarshalJSON 没有 enabled 字段时默认启用
+func (i *AppKeyInfo) UnmarshalJSON(data []byte) error {
+	type info AppKeyInfo
+	v := info{Enabled: true}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*i = AppKeyInfo(v)
+	return nil
+}
+
+// AllowPath 判断是否允许访问该路径
+func (i *AppKeyInfo) AllowPath(path string) bool {
+	if len(i.Paths) == 0 {
+		return true
+	}
+	for _, p := range i.Paths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// AppKeyLoader 加载全部的appkey
+type AppKeyLoader interface {
+	Load() ([]*AppKeyInfo, error)
+}
+
+// AppKeyLoaderFunc 使用函数实现 AppKeyLoader
+type AppKeyLoaderFunc func() ([]*AppKeyInfo, error)
+
+// Load 加载全部的appkey
+func (f AppKeyLoaderFunc) Load() ([]*AppKeyInfo, error) {
+	return f()
+}
+
+// CfgAppKeyLoader 从配置文件中加载,appkey列表为 prefix.list,以逗号分隔
+// 每个appkey的元数据为 prefix.<appkey>.secret、enabled、paths、quota、min_version,都可以省略
+func CfgAppKeyLoader(prefix string) AppKeyLoader {
+	return AppKeyLoaderFunc(func() ([]*AppKeyInfo, error) {
+		var infos []*AppKeyInfo
+		for _, appkey := range strings.Split(cfg.GetString(prefix+".list"), ",") {
+			appkey = strings.TrimSpace(appkey)
+			if appkey == immut.Blank {
+				continue
+			}
+			info, err := cfgAppKey(prefix+"."+appkey, appkey)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	})
+}
+
+// cfgAppKey 读取一个appkey的元数据
+func cfgAppKey(key, appkey string) (*AppKeyInfo, error) {
+	info := &AppKeyInfo{AppKey: appkey, Enabled: true, Secret: cfg.GetString(key + ".secret")}
+	var err error
+	if s := cfg.GetString(key + ".enabled"); s != immut.Blank {
+		if info.Enabled, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("%s.enabled: %w", key, err)
+		}
+	}
+	if s := cfg.GetString(key + ".paths"); s != immut.Blank {
+		for _, p := range strings.Split(s, ",") {
+			info.Paths = append(info.Paths, strings.TrimSpace(p))
+		}
+	}
+	if s := cfg.GetString(key + ".quota"); s != immut.Blank {
+		if info.Quota, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("%s.quota: %w", key, err)
+		}
+	}
+	if s := cfg.GetString(key + ".min_version"); s != immut.Blank {
+		if info.MinVersion, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("%s.min_version: %w", key, err)
+		}
+	}
+	return info, nil
+}
+
+// FileAppKeyLoader 从json文件中加载,文件内容为 AppKeyInfo 的数组
+func FileAppKeyLoader(path string) AppKeyLoader {
+	return AppKeyLoaderFunc(func() ([]*AppKeyInfo, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var infos []*AppKeyInfo
+		if err = json.Unmarshal(data, &infos); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return infos, nil
+	})
+}
+
+// RedisAppKeyLoader 从Redis的hash中加载,field为appkey,value为 AppKeyInfo 的json
+func RedisAppKeyLoader(pool *cache.RedisPool, key string) AppKeyLoader {
+	return AppKeyLoaderFunc(func() ([]*AppKeyInfo, error) {
+		values, err := pool.HGetAllValue(key)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]*AppKeyInfo, 0, len(values)/2)
+		for i := 0; i+1 < len(values); i += 2 {
+			info := &AppKeyInfo{}
+			if err = json.Unmarshal([]byte(values[i+1]), info); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", key, values[i], err)
+			}
+			info.AppKey = values[i]
+			infos = append(infos, info)
+		}
+		return infos, nil
+	})
+}
+
+// appKeyEntry 注册表中的一个appkey
+type appKeyEntry struct {
+	info    *AppKeyInfo
+	limiter *rateLimiter
+}
+
+// AppKeyRegistry appkey注册表,查询不加锁,重新加载时整体替换,可以被多个goroutine共用
+// 实现了 KeyStore,可以作为 HMACSHA256Scheme 的密钥存储
+type AppKeyRegistry struct {
+	loader AppKeyLoader
+	keys   atomic.Pointer[map[string]*appKeyEntry]
+	clock  Clock
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewAppKeyRegistry 创建注册表并加载一次
+func NewAppKeyRegistry(loader AppKeyLoader) (*AppKeyRegistry, error) {
+	r := &AppKeyRegistry{loader: loader, clock: time.Now, stop: make(chan struct{})}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新加载全部的appkey,失败时保留原有的数据
+// 配额没有变化的appkey保留原有的计数
+func (r *AppKeyRegistry) Reload() error {
+	infos, err := r.loader.Load()
+	if err != nil {
+		return err
+	}
+	var old map[string]*appKeyEntry
+	if p := r.keys.Load(); p != nil {
+		old = *p
+	}
+	keys := make(map[string]*appKeyEntry, len(infos))
+	for _, info := range infos {
+		if info == nil || info.AppKey == immut.Blank {
+			continue
+		}
+		entry := &appKeyEntry{info: info}
+		if info.Quota > 0 {
+			if o, ok := old[info.AppKey]; ok && o.limiter != nil && o.info.Quota == info.Quota {
+				entry.limiter = o.limiter
+			} else {
+				entry.limiter = &rateLimiter{quota: info.Quota}
+			}
+		}
+		keys[info.AppKey] = entry
+	}
+	r.keys.Store(&keys)
+	log.Infof("appkey registry loaded %d appkeys", len(keys))
+	return nil
+}
+
+// Watch 每隔 interval 重新加载一次,直到调用 Close,加载失败时只记录日志
+func (r *AppKeyRegistry) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if err := r.Reload(); err != nil {
+					log.Errorf("couldn't reload appkey registry, %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close 停止 Watch 启动的定时加载
+func (r *AppKeyRegistry) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
+
+// Lookup 查询appkey,包括未启用的appkey
+func (r *AppKeyRegistry) Lookup(appkey string) (*AppKeyInfo, bool) {
+	entry, ok := r.entry(appkey)
+	if !ok {
+		return nil, false
+	}
+	return entry.info, true
+}
+
+// entry 查询appkey对应的数据
+func (r *AppKeyRegistry) entry(appkey string) (*appKeyEntry, bool) {
+	p := r.keys.Load()
+	if p == nil {
+		return nil, false
+	}
+	entry, ok := (*p)[appkey]
+	return entry, ok
+}
+
+// Valid 判断appkey是否存在并且启用,可以作为 AppKeyPolicy.Valid
+func (r *AppKeyRegistry) Valid(appkey string) bool {
+	info, ok := r.Lookup(appkey)
+	return ok && info.Enabled
+}
+
+// Secret 获取启用的appkey的密钥,不存在、未启用或者没有密钥时返回 SecretNotFoundErr
+func (r *AppKeyRegistry) Secret(appkey string) ([]byte, error) {
+	info, ok := r.Lookup(appkey)
+	if !ok || !info.Enabled || info.Secret == immut.Blank {
+		return nil, SecretNotFoundErr
+	}
+	return []byte(info.Secret), nil
+}
+
+// Allow 判断appkey在当前这一秒内是否还有配额,并且消耗一次,没有配额限制时始终返回true
+func (r *AppKeyRegistry) Allow(appkey string) bool {
+	entry, ok := r.entry(appkey)
+	if !ok || entry.limiter == nil {
+		return true
+	}
+	return entry.limiter.allow(r.clock())
+}
+
+// Check 按照appkey的元数据检查请求,需要放在 HeaderCheck 之后,通过之后设置 req.Key
+func (r *AppKeyRegistry) Check(req *Request) error {
+	entry, ok := r.entry(req.AppKey)
+	if !ok || !entry.info.Enabled {
+		return &ept.Error{
+			Code:    immut.CodeExAppKey,
+			Message: "wrongful appkey",
+		}
+	}
+	info := entry.info
+	if info.MinVersion > 0 {
+		ver, _ := strconv.ParseFloat(req.Version, 64)
+		if ver < info.MinVersion {
+			return &ept.Error{
+				Code:    immut.CodeExVersion,
+				Message: "x-version lower than " + strconv.FormatFloat(info.MinVersion, 'f', -1, 64),
+			}
+		}
+	}
+	if req.Request != nil && !info.AllowPath(req.URL.Path) {
+		return &ept.Error{
+			Code:    immut.CodeExAppKey,
+			Message: "appkey not allowed to access " + req.URL.Path,
+		}
+	}
+	if entry.limiter != nil && !entry.limiter.allow(r.clock()) {
+		return &ept.Error{
+			Code:    immut.CodeExRateLimit,
+			Message: "appkey quota exceeded",
+		}
+	}
+	req.Key = info
+	return nil
+}
+
+// rateLimiter 按照秒计数的限流
+type rateLimiter struct {
+	mutex  sync.Mutex
+	quota  int
+	second int64
+	count  int
+}
+
+// allow 判断 now 所在的这一秒是否还有配额
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if s := now.Unix(); s != l.second {
+		l.second = s
+		l.count = 0
+	}
+	if l.count >= l.quota {
+		return false
+	}
+	l.count++
+	return true
+}
@@ -0,0 +1,160 @@
+package httpframe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/yeahyf/go_base/cache"
+	"github.com/yeahyf/go_base/cfg"
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAppKeyLoaders(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "app.properties")
+	conf := "appkey.list=a, b\nappkey.a.secret=s1\nappkey.a.paths=/api/*,/login\nappkey.a.quota=10\n" +
+		"appkey.a.min_version=2.5\nappkey.b.enabled=false\n"
+	if err := os.WriteFile(cfgFile, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Load(&cfgFile)
+	infos, err := CfgAppKeyLoader("appkey").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Secret != "s1" || len(infos[0].Paths) != 2 || infos[0].Quota != 10 ||
+		infos[0].MinVersion != 2.5 || !infos[0].Enabled || infos[1].AppKey != "b" || infos[1].Enabled {
+		t.Fatalf("unexpected cfg infos %+v %+v", infos[0], infos[1])
+	}
+
+	jsonFile := filepath.Join(dir, "appkeys.json")
+	data := `[{"appkey": "a", "secret": "s1"}, {"appkey": "b", "enabled": false}]`
+	if err = os.WriteFile(jsonFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	infos, err = FileAppKeyLoader(jsonFile).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || !infos[0].Enabled || infos[0].Secret != "s1" || infos[1].Enabled {
+		t.Fatalf("unexpected file infos %+v %+v", infos[0], infos[1])
+	}
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	mr.HSet("appkeys", "a", `{"secret": "s1", "quota": 5}`)
+	pool := cache.NewRedisPool(1, 2, 1, mr.Addr(), "")
+	infos, err = RedisAppKeyLoader(pool, "appkeys").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].AppKey != "a" || infos[0].Quota != 5 || !infos[0].Enabled {
+		t.Fatalf("unexpected redis infos %+v", infos)
+	}
+}
+
+func TestAppKeyRegistryCheck(t *testing.T) {
+	infos := []*AppKeyInfo{
+		{AppKey: "a", Enabled: true, Paths: []string{"/api/*"}, Quota: 2, MinVersion: 2.0},
+		{AppKey: "b", Enabled: false},
+	}
+	reg, err := NewAppKeyRegistry(AppKeyLoaderFunc(func() ([]*AppKeyInfo, error) {
+		return infos, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	reg.clock = func() time.Time { return now }
+
+	check := func(appkey, version, path string) error {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		return reg.Check(&Request{Request: r, AppKey: appkey, Version: version})
+	}
+	checkCode(t, "unknown", check("c", "2.0", "/api/x"), immut.CodeExAppKey)
+	checkCode(t, "disabled", check("b", "2.0", "/api/x"), immut.CodeExAppKey)
+	checkCode(t, "old version", check("a", "1.0", "/api/x"), immut.CodeExVersion)
+	checkCode(t, "path", check("a", "2.0", "/admin"), immut.CodeExAppKey)
+	checkCode(t, "first", check("a", "2.0", "/api/x"), 0)
+	checkCode(t, "second", check("a", "2.0", "/api/y"), 0)
+	checkCode(t, "quota", check("a", "2.0", "/api/x"), immut.CodeExRateLimit)
+
+	//配额不变时重新加载保留计数,下一秒重新计数
+	if err = reg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	checkCode(t, "quota after reload", check("a", "2.0", "/api/x"), immut.CodeExRateLimit)
+	now = now.Add(time.Second)
+	checkCode(t, "next second", check("a", "2.0", "/api/x"), 0)
+
+	//热加载之后立即生效
+	infos = []*AppKeyInfo{{AppKey: "c", Enabled: true}}
+	if err = reg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if reg.Valid("a") || !reg.Valid("c") {
+		t.Fatal("registry not reloaded")
+	}
+}
+
+func TestFrameworkAppKeyRegistry(t *testing.T) {
+	reg, _ := NewAppKeyRegistry(AppKeyLoaderFunc(func() ([]*AppKeyInfo, error) {
+		return []*AppKeyInfo{{AppKey: "app", Secret: "secret", Enabled: true, Quota: 100}}, nil
+	}))
+	scheme := &HMACSHA256Scheme{Keys: reg}
+	handler := HandleWith(New(WithAppKeyRegistry(reg), WithSchemes(VersionSchemes(SchemeRule{Scheme: scheme}))),
+		func(ctx context.Context, req *ept.ErrorResponse) (*ept.ErrorResponse, error) {
+			info := AppKeyInfoFromContext(ctx)
+			return &ept.ErrorResponse{Code: uint32(info.Quota), Info: info.AppKey}, nil
+		})
+
+	r := newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	body := mustMarshal(t, &ept.ErrorResponse{Code: 1})
+	sign, _ := scheme.Sign(&SignData{AppKey: "app", Nonce: r.Header.Get(HeadXNonce),
+		Timestamp: r.Header.Get(HeadXTimestamp), Body: body})
+	r.Header.Set(HeadXSignature, sign)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	resp := &ept.ErrorResponse{}
+	if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Code != 100 || resp.Info != "app" {
+		t.Fatalf("unexpected response %v %v", resp, err)
+	}
+}
+
+// TestFrameworkSchemeDowngrade 配置了密钥的appkey不能通过较低的 X-Version 使用SHA1签名
+func TestFrameworkSchemeDowngrade(t *testing.T) {
+	reg, _ := NewAppKeyRegistry(AppKeyLoaderFunc(func() ([]*AppKeyInfo, error) {
+		return []*AppKeyInfo{
+			{AppKey: "app", Secret: "secret", Enabled: true},
+			{AppKey: "legacy", Enabled: true},
+		}, nil
+	}))
+	fw := New(WithAppKeyRegistry(reg))
+
+	r := newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	_, err := fw.Check(nil, r)
+	checkCode(t, "sha1 with secret", err, immut.CodeExSignature)
+
+	r = newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	r.Header.Set(HeadXAppKey, "legacy")
+	_, err = fw.Check(nil, r)
+	checkCode(t, "sha1 without secret", err, 0)
+
+	r = newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false)
+	sign, _ := (&HMACSHA256Scheme{Keys: reg}).Sign(&SignData{AppKey: "app", Nonce: r.Header.Get(HeadXNonce),
+		Timestamp: r.Header.Get(HeadXTimestamp), Body: mustMarshal(t, &ept.ErrorResponse{Code: 1})})
+	r.Header.Set(HeadXSignature, sign)
+	_, err = fw.Check(nil, r)
+	checkCode(t, "hmac with secret", err, 0)
+}
@@ -0,0 +1,196 @@
+package httpframe
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yeahyf/go_base/crypto"
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+	"github.com/yeahyf/go_base/log"
+)
+
+// 签名相关的错误
+var (
+	SecretNotFoundErr = errors.New("secret of appkey not found")
+	SchemeNotFoundErr = errors.New("no signature scheme for version")
+)
+
+// SignData 参与签名的数据
+type SignData struct {
+	AppKey    string //X-AppKey
+	Nonce     string //X-Nonce
+	Timestamp string //X-Timestamp
+	Body      []byte //原始的请求体,压缩时为压缩之后的数据
+}
+
+// SignatureScheme 签名算法,服务端与客户端使用同一个实现计算签名
+type SignatureScheme interface {
+	Name() string                        //算法名称,用于日志
+	Sign(data *SignData) (string, error) //计算签名
+}
+
+// SHA1Scheme 兼容原有的签名方式 sha1(排序后的 md5(body)、nonce、ts 使用&连接)
+// 该方式不使用密钥,知道规则即可伪造请求,新接入的客户端应该使用 HMACSHA256Scheme
+type SHA1Scheme struct{}
+
+// Name 算法名称
+func (SHA1Scheme) Name() string {
+	return "sha1"
+}
+
+// Sign 计算签名
+func (SHA1Scheme) Sign(data *SignData) (string, error) {
+	l := []string{crypto.MD54Bs(data.Body), data.Nonce, data.Timestamp}
+	//排序
+	sort.Strings(l)
+	source := strings.Join(l, "&")
+	if log.IsDebug() {
+		log.Debugf("before signature str = %s", source)
+	}
+	sum := sha1.Sum([]byte(source))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// KeyStore 按照appkey获取签名的密钥,不存在时返回SecretNotFoundErr
+type KeyStore interface {
+	Secret(appkey string) ([]byte, error)
+}
+
+// KeyStoreFunc 使用函数实现 KeyStore
+type KeyStoreFunc func(appkey string) ([]byte, error)
+
+// Secret 获取密钥
+func (f KeyStoreFunc) Secret(appkey string) ([]byte, error) {
+	return f(appkey)
+}
+
+// StaticKeyStore 固定的 appkey -> 密钥
+type StaticKeyStore map[string]string
+
+// Secret 获取密钥
+func (s StaticKeyStore) Secret(appkey string) ([]byte, error) {
+	secret, ok := s[appkey]
+	if !ok {
+		return nil, SecretNotFoundErr
+	}
+	return []byte(secret), nil
+}
+
+// HMACSHA256Scheme 使用appkey对应的密钥计算 HMAC-SHA256
+// 签名原文为 appkey、nonce、ts、hex(sha256(body)) 使用换行连接,签名为小写的十六进制
+type HMACSHA256Scheme struct {
+	Keys KeyStore //密钥存储
+}
+
+// Name 算法名称
+func (s *HMACSHA256Scheme) Name() string {
+	return "hmac-sha256"
+}
+
+// Sign 计算签名
+func (s *HMACSHA256Scheme) Sign(data *SignData) (string, error) {
+	secret, err := s.Keys.Secret(data.AppKey)
+	if err != nil {
+		return "", err
+	}
+	bodyHash := sha256.Sum256(data.Body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data.AppKey))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(data.Nonce))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(data.Timestamp))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SchemeSelector 根据 X-Version 选择签名算法
+type SchemeSelector func(version string) (SignatureScheme, error)
+
+// SchemeRule 版本号大于等于 MinVersion 时使用 Scheme
+type SchemeRule struct {
+	MinVersion float64
+	Scheme     SignatureScheme
+}
+
+// VersionSchemes 按照版本号选择签名算法,使用 MinVersion 不大于请求版本的规则中 MinVersion 最大的一条
+// 例如 {0, SHA1Scheme{}}, {3.0, &HMACSHA256Scheme{...}} 表示声明3.0及以上的客户端使用HMAC签名
+// X-Version 由客户端提供并且不参与签名,客户端可以声明较低的版本使用 SHA1Scheme,所以版本不能作为安全的依据
+// 需要强制使用HMAC签名时在 AppKeyRegistry 中为appkey配置密钥,Framework 对这些appkey忽略版本直接使用HMAC签名
+func VersionSchemes(rules ...SchemeRule) SchemeSelector {
+	sorted := make([]SchemeRule, len(rules))
+	copy(sorted, rules)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinVersion > sorted[j].MinVersion
+	})
+	return func(version string) (SignatureScheme, error) {
+		ver, err := strconv.ParseFloat(version, 64)
+		if err != nil {
+			return nil, SchemeNotFoundErr
+		}
+		for _, rule := range sorted {
+			if ver >= rule.MinVersion {
+				return rule.Scheme, nil
+			}
+		}
+		return nil, SchemeNotFoundErr
+	}
+}
+
+// DefaultSchemes 默认所有版本都使用 SHA1Scheme,与原有的客户端兼容
+// ReqBaseCheck、SignatureCheck 以及没有密钥的appkey使用该选择
+var DefaultSchemes = VersionSchemes(SchemeRule{MinVersion: 0, Scheme: SHA1Scheme{}})
+
+// verifySignature 使用 DefaultSchemes 按照 X-Version 选择的算法校验签名
+func verifySignature(req *Request) error {
+	return verifySignatureWith(DefaultSchemes, req)
+}
+
+// verifySignatureWith 使用选择的算法校验请求的签名
+func verifySignatureWith(selector SchemeSelector, req *Request) error {
+	return VerifySignature(selector, req.Version, &SignData{
+		AppKey:    req.AppKey,
+		Nonce:     req.Nonce,
+		Timestamp: req.Timestamp,
+		Body:      req.Body,
+	}, req.Signature)
+}
+
+// VerifySignature 按照 version 选择算法校验签名,比较的耗时与签名的内容无关
+func VerifySignature(selector SchemeSelector, version string, data *SignData, signature string) error {
+	scheme, err := selector(version)
+	if err != nil {
+		return &ept.Error{
+			Code:    immut.CodeExVersion,
+			Message: "unsupported x-version for signature",
+		}
+	}
+	expected, err := scheme.Sign(data)
+	if err != nil {
+		log.Errorf("couldn't sign request, scheme = %s, appkey = %s, err = %v", scheme.Name(), data.AppKey, err)
+		return &ept.Error{
+			Code:    immut.CodeExSignature,
+			Message: "signature data error!",
+		}
+	}
+	if log.IsDebug() {
+		log.Debugf("after signature str = %s, scheme = %s", expected, scheme.Name())
+	}
+	//对比摘要
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return &ept.Error{
+			Code:    immut.CodeExSignature,
+			Message: "signature data error!",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package httpframe
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/immut"
+)
+
+func TestSHA1Scheme(t *testing.T) {
+	data := &SignData{Nonce: "abc", Timestamp: "1700000000", Body: []byte("body")}
+	sign, err := SHA1Scheme{}.Sign(data)
+	if err != nil || sign != sha1Sign(data.Body, data.Nonce, data.Timestamp) {
+		t.Fatalf("sha1 scheme is not compatible: %s, %v", sign, err)
+	}
+}
+
+func TestHMACSHA256Scheme(t *testing.T) {
+	scheme := &HMACSHA256Scheme{Keys: StaticKeyStore{"app": "secret"}}
+	data := &SignData{AppKey: "app", Nonce: "abc", Timestamp: "1700000000", Body: []byte("body")}
+	sign, err := scheme.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodyHash := sha256.Sum256(data.Body)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("app\nabc\n1700000000\n" + hex.EncodeToString(bodyHash[:])))
+	if sign != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("unexpected signature %s", sign)
+	}
+	data.AppKey = "other"
+	if _, err = scheme.Sign(data); err != SecretNotFoundErr {
+		t.Fatalf("expected SecretNotFoundErr, got %v", err)
+	}
+}
+
+func TestVersionSchemes(t *testing.T) {
+	hmacScheme := &HMACSHA256Scheme{Keys: StaticKeyStore{"app": "secret"}}
+	selector := VersionSchemes(
+		SchemeRule{MinVersion: 3.0, Scheme: hmacScheme},
+		SchemeRule{MinVersion: 1.0, Scheme: SHA1Scheme{}},
+	)
+	cases := []struct {
+		version string
+		scheme  SignatureScheme
+	}{
+		{"1.0", SHA1Scheme{}},
+		{"2.5", SHA1Scheme{}},
+		{"3.0", hmacScheme},
+		{"3.1", hmacScheme},
+		{"0.9", nil},
+		{"x", nil},
+	}
+	for _, c := range cases {
+		scheme, err := selector(c.version)
+		if scheme != c.scheme || (c.scheme == nil) != (err == SchemeNotFoundErr) {
+			t.Fatalf("version %s: unexpected scheme %v, %v", c.version, scheme, err)
+		}
+	}
+}
+
+func TestSignatureCheckWith(t *testing.T) {
+	hmacScheme := &HMACSHA256Scheme{Keys: StaticKeyStore{"app": "secret"}}
+	selector := VersionSchemes(
+		SchemeRule{MinVersion: 0, Scheme: SHA1Scheme{}},
+		SchemeRule{MinVersion: 3.0, Scheme: hmacScheme},
+	)
+	handler := Serve(Chain(WrapperHandler(echo),
+		HeaderCheck(), ReadBody(), SignatureCheckWith(selector), Unmarshal(&ept.ErrorResponse{})))
+
+	body := mustMarshal(t, &ept.ErrorResponse{Code: 1})
+	newRequest := func(version, appkey string, scheme SignatureScheme) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api", bytes.NewReader(body))
+		r.Header.Set(HeadXVersion, version)
+		r.Header.Set(HeadXAppKey, appkey)
+		r.Header.Set(HeadXNonce, "nonce")
+		r.Header.Set(HeadXTimestamp, "1700000000")
+		sign, _ := scheme.Sign(&SignData{AppKey: "app", Nonce: "nonce", Timestamp: "1700000000", Body: body})
+		r.Header.Set(HeadXSignature, sign)
+		return r
+	}
+	cases := []struct {
+		name    string
+		req     *http.Request
+		errCode uint32
+	}{
+		{"sha1 for old version", newRequest("1.0", "app", SHA1Scheme{}), 0},
+		{"hmac for new version", newRequest("3.0", "app", hmacScheme), 0},
+		{"sha1 rejected for new version", newRequest("3.0", "app", SHA1Scheme{}), immut.CodeExSignature},
+		{"unknown appkey", newRequest("3.0", "other", hmacScheme), immut.CodeExSignature},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handler(w, c.req)
+		e := decodeError(t, w)
+		if c.errCode == 0 && e != nil || c.errCode != 0 && (e == nil || e.Code != c.errCode) {
+			t.Fatalf("%s: unexpected error %v", c.name, e)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package httpframe
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ctxKey 请求上下文中使用的key
+type ctxKey struct{}
+
+// NewContext 将检查之后的请求放入上下文
+func NewContext(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, ctxKey{}, req)
+}
+
+// FromContext 获取上下文中的请求,只有经过 Handle 等处理时才存在
+func FromContext(ctx context.Context) (*Request, bool) {
+	req, ok := ctx.Value(ctxKey{}).(*Request)
+	return req, ok
+}
+
+// AppKeyFromContext 获取经过检查的appkey,不存在时返回空字符串
+func AppKeyFromContext(ctx context.Context) string {
+	if req, ok := FromContext(ctx); ok {
+		return req.AppKey
+	}
+	return ""
+}
+
+// NonceFromContext 获取请求的nonce,不存在时返回空字符串
+func NonceFromContext(ctx context.Context) string {
+	if req, ok := FromContext(ctx); ok {
+		return req.Nonce
+	}
+	return ""
+}
+
+// AppKeyInfoFromContext 获取注册表中的appkey信息,没有配置 WithAppKeyRegistry 时返回nil
+func AppKeyInfoFromContext(ctx context.Context) *AppKeyInfo {
+	if req, ok := FromContext(ctx); ok {
+		return req.Key
+	}
+	return nil
+}
+
+// TypedHandler 将带类型的业务逻辑转为 Handler,需要放在 Decompress 之后,Req 必须是具体的消息类型,例如 *ept.ErrorResponse
+// 每个请求都会分配一个新的 Req,ctx 中可以通过 AppKeyFromContext、NonceFromContext 获取请求信息
+// 返回的 Resp 为nil时不输出响应
+func TypedHandler[Req, Resp proto.Message](fn func(ctx context.Context, req Req) (Resp, error)) Handler {
+	var zero Req
+	msgType := zero.ProtoReflect().Type()
+	return func(req *Request) (proto.Message, error) {
+		msg := msgType.New().Interface().(Req)
+		if err := decodeMsg(req, msg); err != nil {
+			return nil, err
+		}
+		req.Msg = msg
+		ctx := NewContext(req.Context(), req)
+		resp, err := fn(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		if any(resp) == nil || !resp.ProtoReflect().IsValid() {
+			return nil, nil
+		}
+		return resp, nil
+	}
+}
+
+// Handle 使用默认配置的框架处理带类型的请求,参见 HandleWith
+func Handle[Req, Resp proto.Message](fn func(ctx context.Context, req Req) (Resp, error)) func(w http.ResponseWriter, r *http.Request) {
+	return HandleWith(New(), fn)
+}
+
+// HandleWith 按照 fw 的配置检查请求之后调用带类型的业务逻辑
+func HandleWith[Req, Resp proto.Message](fw *Framework,
+	fn func(ctx context.Context, req Req) (Resp, error)) func(w http.ResponseWriter, r *http.Request) {
+	return fw.Serve(Chain(TypedHandler(fn), fw.checks()...))
+}
@@ -0,0 +1,69 @@
+package httpframe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/yeahyf/go_base/ept"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandle(t *testing.T) {
+	handler := Handle(func(ctx context.Context, req *ept.ErrorResponse) (*ept.ErrorResponse, error) {
+		if req.Code == 0 {
+			return nil, &ept.Error{Code: 2001, Message: "empty code"}
+		}
+		return &ept.ErrorResponse{Code: req.Code + 1, Info: AppKeyFromContext(ctx) + ":" + NonceFromContext(ctx)}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(code uint32) {
+			defer wg.Done()
+			r := newSignedRequest(t, &ept.ErrorResponse{Code: code}, code%2 == 0)
+			w := httptest.NewRecorder()
+			handler(w, r)
+			resp := &ept.ErrorResponse{}
+			if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.Code != code+1 || resp.Info != "app:"+r.Header.Get(HeadXNonce) {
+				t.Errorf("unexpected response %v", resp)
+			}
+		}(uint32(i))
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	handler(w, newSignedRequest(t, &ept.ErrorResponse{}, false))
+	if e := decodeError(t, w); e == nil || e.Code != 2001 || w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected response %d %v", w.Code, e)
+	}
+}
+
+func TestHandleNilResponse(t *testing.T) {
+	handler := HandleWith(New(WithAppKeyPolicy(AppKeyPolicy{MinVersion: 2.0})),
+		func(ctx context.Context, req *ept.ErrorResponse) (*ept.ErrorResponse, error) {
+			if _, ok := FromContext(ctx); !ok {
+				return nil, errors.New("missing request")
+			}
+			return nil, nil
+		})
+	w := httptest.NewRecorder()
+	handler(w, newSignedRequest(t, &ept.ErrorResponse{Code: 1}, false))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get(HeadServerEx) != "" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.Bytes())
+	}
+}
+
+func TestContextWithoutRequest(t *testing.T) {
+	if AppKeyFromContext(context.Background()) != "" || NonceFromContext(context.Background()) != "" {
+		t.Fatal("expected empty values")
+	}
+}
@@ -1,48 +1,36 @@
+// Package httputil 保留原有的接口,实现已经移动到 httpframe
 package httputil
 
 import (
-	"bytes"
-	"compress/gzip"
-	"crypto/sha1"
-	"fmt"
-	"io"
 	"net/http"
 	"reflect"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/yeahyf/go_base/cfg"
-	"github.com/yeahyf/go_base/utils"
-
-	"github.com/yeahyf/go_base/cache"
-	"github.com/yeahyf/go_base/crypto"
 	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/httpframe"
 	"github.com/yeahyf/go_base/immut"
 	"github.com/yeahyf/go_base/log"
-	"github.com/yeahyf/go_base/strutil"
 	"google.golang.org/protobuf/proto"
 )
 
 const (
-	HeadContentEncoding = "Content-Encoding"
-	HeadXVersion        = "X-Version"
-	HeadXNonce          = "X-Nonce"
-	HeadXTimestamp      = "X-Timestamp"
-	HeadXSignature      = "X-Signature"
+	HeadContentEncoding = httpframe.HeadContentEncoding
+	HeadXVersion        = httpframe.HeadXVersion
+	HeadXNonce          = httpframe.HeadXNonce
+	HeadXTimestamp      = httpframe.HeadXTimestamp
+	HeadXSignature      = httpframe.HeadXSignature
 	HeadIp              = "X-Real-IP"
-	HttpPost            = "POST"
-	HeadServerEx        = "X-Server-Ex"
-	EncodingType        = "gzip"
-	HeadXAppKey         = "X-AppKey"
+	HttpPost            = httpframe.HttpPost
+	HeadServerEx        = httpframe.HeadServerEx
+	EncodingType        = httpframe.EncodingType
+	HeadXAppKey         = httpframe.HeadXAppKey
 
 	HeadUserAgent = "User-Agent"
 )
 
-type CommonCache struct {
-	ReadCache  *cache.RedisPool
-	WriteCache *cache.RedisPool
-}
+type CommonCache = httpframe.CommonCache
 
 func HttpReqHandle(w http.ResponseWriter, r *http.Request,
 	commonCache *CommonCache, pb proto.Message) bool {
@@ -52,10 +40,9 @@ func HttpReqHandle(w http.ResponseWriter, r *http.Request,
 		return false
 	}
 
-	err = proto.Unmarshal(postData, pb)
+	err = httpframe.RequestCodec(r).Unmarshal(postData, pb)
 	if err != nil {
-		log.Errorf("proto couldn't unmarshal type = %s info = %v"+
-			reflect.TypeOf(pb).Name(), err)
+		log.Errorf("proto couldn't unmarshal type = %s info = %v", reflect.TypeOf(pb).Elem().Name(), err)
 		aErr := &ept.Error{
 			Code:    immut.CodeExProtobufUn,
 			Message: "unmarshal error!!!",
@@ -70,282 +57,115 @@ func HttpReqHandle(w http.ResponseWriter, r *http.Request,
 }
 
 const (
-	ReqestTimeout = 3
+	ReqestTimeout = 3 //请求时间与服务器时间允许的差距,单位分钟,早于或者晚于服务器时间都适用
 )
 
-// CheckAppKey 判断appkey是否在白名单
-func checkAppKey(appkey string) bool {
-	s := cfg.GetString("appkey.list")
-	array := strings.Split(s, ",")
-	for _, v := range array {
-		if appkey == v {
-			return true
-		}
-	}
-	return false
-}
+// AppKeyReloadInterval 默认从配置文件加载的appkey白名单重新读取配置的间隔,cfg.Load 之后最多经过该间隔生效
+const AppKeyReloadInterval = 30 * time.Second
 
-// ReqHeadHandle 从Http请求中获取上报数据，只支持Post
-func ReqHeadHandle(r *http.Request, commonCache *CommonCache) ([]byte, error) {
-	// 对请求方法做判断
-	if r.Method != HttpPost {
-		return nil, &ept.Error{
-			Code:    immut.CodeExHttpMethod,
-			Message: "only support post method",
-		}
-	}
+var (
+	appKeysMu   sync.RWMutex
+	appKeys     *httpframe.AppKeyRegistry                     //为nil时第一次使用前从配置文件加载
+	defaultKeys bool                                          //appKeys 是否为从配置文件加载的注册表
+	frameworks  = make(map[*CommonCache]*httpframe.Framework) //使用 appKeys 创建,与 appKeys 一起替换
+)
 
-	//判断请求头信息
-	version := r.Header.Get(HeadXVersion)
-	if version == immut.Blank {
-		return nil, &ept.Error{
-			Code:    immut.CodeExVersion,
-			Message: "couldn't read head x-version",
-		}
+// SetAppKeyRegistry 设置appkey白名单,没有设置时第一次使用前从配置文件的 appkey.list 加载
+// 需要热加载时可以传入调用了 Watch 的注册表
+func SetAppKeyRegistry(registry *httpframe.AppKeyRegistry) {
+	appKeysMu.Lock()
+	defer appKeysMu.Unlock()
+	if defaultKeys {
+		appKeys.Close()
 	}
+	appKeys, defaultKeys = registry, false
+	frameworks = make(map[*CommonCache]*httpframe.Framework)
+}
 
-	if ver, err := strconv.ParseFloat(version, 32); err != nil {
-		return nil, &ept.Error{
-			Code:    immut.CodeExVersion,
-			Message: "x-version error",
-		}
-	} else if ver >= 2.0 { //判断版本大于等于2.0 开启appkey白名单校验
-		//appkey不能为空
-		appkey := r.Header.Get(HeadXAppKey)
-		if appkey == immut.Blank {
-			return nil, &ept.Error{
-				Code:    immut.CodeExAppKey,
-				Message: "could read req head appkey",
-			}
-		}
+// cfgAppKeyRegistry 从配置文件的 appkey.list 加载appkey白名单,每隔 AppKeyReloadInterval 重新读取
+// 第一次加载失败时使用空的白名单,之后的重新读取成功时生效
+func cfgAppKeyRegistry() *httpframe.AppKeyRegistry {
+	loader := httpframe.CfgAppKeyLoader("appkey")
+	loaded := false
+	registry, _ := httpframe.NewAppKeyRegistry(httpframe.AppKeyLoaderFunc(func() ([]*httpframe.AppKeyInfo, error) {
+		infos, err := loader.Load()
+		if err != nil && !loaded {
+			log.Errorf("couldn't load appkey list, %v", err)
+			return nil, nil
+		}
+		loaded = err == nil
+		return infos, err
+	}))
+	registry.Watch(AppKeyReloadInterval)
+	return registry
+}
 
-		//白名单校验
-		if !checkAppKey(appkey) {
-			if !strings.HasPrefix(appkey, "5ska3upf") {
-				log.Errorf("wrongful appkey: %s", appkey)
-			}
-			return nil, &ept.Error{
-				Code:    immut.CodeExAppKey,
-				Message: "wrongful appkey",
-			}
-		}
+// framework 原有接口使用的配置,版本大于等于2.0 开启appkey白名单校验,commonCache 不为nil时检查重复请求
+// 每个 commonCache 只创建一次,SetAppKeyRegistry 之后重新创建
+func framework(commonCache *CommonCache) *httpframe.Framework {
+	appKeysMu.RLock()
+	fw, ok := frameworks[commonCache]
+	appKeysMu.RUnlock()
+	if ok {
+		return fw
 	}
 
-	nonce := r.Header.Get(HeadXNonce)
-	if nonce == immut.Blank {
-		return nil, &ept.Error{
-			Code:    immut.CodeExNonce,
-			Message: "couldn't req head nonce",
-		}
+	appKeysMu.Lock()
+	defer appKeysMu.Unlock()
+	if fw, ok = frameworks[commonCache]; ok {
+		return fw
 	}
-
-	timestamp := r.Header.Get(HeadXTimestamp)
-	if timestamp == immut.Blank {
-		return nil, &ept.Error{
-			Code:    immut.CodeExTs,
-			Message: "couldn't read req head ts",
-		}
+	if appKeys == nil {
+		appKeys, defaultKeys = cfgAppKeyRegistry(), true
 	}
-
-	signature := r.Header.Get(HeadXSignature)
-	if signature == immut.Blank {
-		return nil, &ept.Error{
-			Code:    immut.CodeExSignature,
-			Message: "couldn't read head signature",
-		}
+	opts := []httpframe.Option{
+		httpframe.WithAppKeyPolicy(httpframe.AppKeyPolicy{MinVersion: 2.0}),
+		httpframe.WithAppKeyRegistry(appKeys),
+		httpframe.WithTimestampTolerance(ReqestTimeout * time.Minute),
 	}
-	encoding := r.Header.Get(HeadContentEncoding)
+	if commonCache != nil {
+		opts = append(opts, httpframe.WithNonceStore(commonCache))
+	}
+	fw = httpframe.New(opts...)
+	frameworks[commonCache] = fw
+	return fw
+}
+
+// ReqHeadHandle 从Http请求中获取上报数据，只支持Post
+func ReqHeadHandle(r *http.Request, commonCache *CommonCache) ([]byte, error) {
 	if log.IsDebug() {
 		//从nginx转发过来的ip地址
 		addr := r.Header.Get(HeadIp)
-		if addr == "" {
+		if addr == "" && r.RemoteAddr != "" {
 			//部分情况下是直接请求
-			if r.RemoteAddr != "" {
-				addr = strings.Split(r.RemoteAddr, ":")[0]
-			}
+			addr = strings.Split(r.RemoteAddr, ":")[0]
 		}
-		log.Debug("ts=", timestamp)
-		log.Debug("sn=", signature)
 		log.Debug("ip=", addr)
-		log.Debug("encoding=", encoding)
 		log.Debug("UserAgent=", r.Header.Get(HeadUserAgent))
 		log.Debug("ContentLength=", r.ContentLength)
 	}
-
-	//获取post的数据
-	buffer := getPostData(r)
-	postDataMD5 := crypto.MD54Bytes(buffer.Bytes())
-	l := make([]string, 0, 3)
-	l = append(l, *postDataMD5)
-	l = append(l, nonce)
-	l = append(l, timestamp)
-	//排序
-	strutil.SortString(l)
-	var builder strings.Builder
-	builder.WriteString(l[0])
-	builder.WriteByte('&')
-	builder.WriteString(l[1])
-	builder.WriteByte('&')
-	builder.WriteString(l[2])
-	source := builder.String()
-	if log.IsDebug() {
-		log.Debugf("before signature str = %s", source)
-	}
-
-	//对数据进行SHA1摘要处理
-	h := sha1.New()
-	_, _ = io.WriteString(h, source)
-	Signature := fmt.Sprintf("%x", h.Sum(nil))
-	h = nil
-
-	if log.IsDebug() {
-		log.Debugf("after signature str = %s", Signature)
-	}
-	//对比摘要
-	if Signature != signature {
-		return nil, &ept.Error{
-			Code:    immut.CodeExSignature,
-			Message: "signature data error!",
-		}
-	}
-
-	//对时间进行处理
-	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	req, err := framework(commonCache).Check(nil, r)
 	if err != nil {
-		return nil, &ept.Error{
-			Code:    immut.CodeExTs,
-			Message: "ts format Error!!!",
-		}
+		return nil, err
 	}
-	tm := time.Unix(ts, 0)
-	//超过3分钟,过期请求
-	duration := time.Since(tm)
-	if duration > ReqestTimeout*time.Minute {
-		return nil, &ept.Error{
-			Code:    immut.CodeExTs,
-			Message: fmt.Sprintf("ts duration error!!! duration=%v", duration),
-		}
-	}
-
-	if commonCache != nil {
-		//nonce
-		value, err := commonCache.ReadCache.GetValue(nonce)
-		if err != nil {
-			return nil, &ept.Error{
-				Code:    immut.CodeExRedis,
-				Message: "Read Redis Data Error!!!",
-			}
-		}
-		if value != "" { //存在值，说明已经提交过了
-			return nil, &ept.Error{
-				Code:    immut.CodeExRepeatReq,
-				Message: "Req Repeat Error!!!",
-			}
-		} else { //说明里边没有值
-			value := ""
-			_ = commonCache.WriteCache.SetValue(nonce, value, 5*60) //180秒
-		}
-	}
-	//无压缩
-	if encoding != EncodingType {
-		return buffer.Bytes(), nil
-	}
-	var gzipReader *gzip.Reader
-	gzipReader, err = gzip.NewReader(buffer)
-	if err != nil {
-		return nil, &ept.Error{
-			Code:    immut.CodeExReadIO,
-			Message: "couldn't gunzip data" + err.Error(),
-		}
-	}
-	defer utils.CloseAction(gzipReader)
-	//========================================
-	var buf bytes.Buffer
-	compressSize := buffer.Len()
-	//默认为5倍的压缩大小
-	buf.Grow(compressSize * 5)
-	//选择开设读取缓存区
-	cacheSize := 4096
-	if compressSize > 1024 {
-		cacheSize = 8092
-	}
-	p := make([]byte, cacheSize)
-	for {
-		n, err := gzipReader.Read(p)
-		if err != nil {
-			//请注意读取到unexpected EOF也是可以将数据读取完整的
-			if strings.Contains(err.Error(), "EOF") {
-				if n != 0 {
-					buf.Write(p[:n])
-					continue
-				} else {
-					break
-				}
-			}
-			return nil, &ept.Error{
-				Code:    immut.CodeExReadIO,
-				Message: "couldn't read gzip data" + err.Error(),
-			}
-		}
-		//读取到的数据如果不满，不一定代表结束
-		//需要接收数据之后，继续读取
-		if n != cacheSize {
-			buf.Write(p[:n])
-			continue
-		}
-		buf.Write(p)
-	}
-	postData := buf.Bytes()
-	return postData, nil
+	return req.Data, nil
 }
 
-func getPostData(r *http.Request) *bytes.Buffer {
-	//拿到数据就关闭掉
-	defer utils.CloseAction(r.Body)
-
-	length := r.ContentLength
-	var b bytes.Buffer
-	b.Grow(int(length))
-	_, _ = io.Copy(&b, r.Body)
-	return &b
+func HttpRespHandle(w http.ResponseWriter, pb proto.Message) {
+	httpframe.RespHandler(w, pb)
 }
 
-func HttpRespHandle(w http.ResponseWriter, pb proto.Message) {
-	if log.IsDebug() {
-		log.Debugf("resp = %s", pb)
-	}
-	result, err := proto.Marshal(pb)
-	if err != nil {
-		aErr := &ept.Error{
-			Code:    immut.CodeExProtobufMa,
-			Message: "proto couldn't marshal",
-		}
-		ExceptionRespHandle(w, aErr)
-		return
+// legacyMapper 与原有的行为兼容,错误始终返回200,客户端通过 X-Server-Ex 判断,并且不记录appkey错误的日志
+var legacyMapper = func() *httpframe.ErrorMapper {
+	mapper := *httpframe.DefaultErrorMapper
+	mapper.Legacy = true
+	mapper.Silent = func(e *ept.Error) bool {
+		return e.Code == immut.CodeExAppKey
 	}
-	_, _ = w.Write(result)
-}
+	return &mapper
+}()
 
-// ExceptionRespHandle 向客户端输出错误信息
+// ExceptionRespHandle 向客户端输出错误信息,与原有的行为一致始终返回200
 func ExceptionRespHandle(w http.ResponseWriter, err error) {
-	w.Header().Add(HeadServerEx, "1")
-	var resp proto.Message
-	if eptError, ok := err.(*ept.Error); ok {
-		//1008 为appkey错误
-		if eptError.Code != 1008 {
-			log.Errorf("code:%s, %s", strconv.Itoa(int(eptError.Code)), eptError.Message)
-		}
-		resp = &ept.ErrorResponse{
-			Code: err.(*ept.Error).Code,
-			Info: err.(*ept.Error).Message,
-		}
-	} else {
-		resp = &ept.ErrorResponse{
-			Code: 1,
-			Info: err.Error(),
-		}
-		log.Errorf("other exp info=%v", err.Error())
-	}
-	data, _ := proto.Marshal(resp)
-	_, _ = w.Write(data)
+	httpframe.WriteError(w, httpframe.ProtoCodec, legacyMapper, err)
 }
@@ -2,57 +2,37 @@ package httputil
 
 import (
 	"net/http"
-	"strconv"
 
 	"github.com/yeahyf/go_base/immut"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/yeahyf/go_base/ept"
+	"github.com/yeahyf/go_base/httpframe"
 	"github.com/yeahyf/go_base/log"
 )
 
 // Wrapper 以下方法是一种对错误统一处理的封装
 type Wrapper func(w http.ResponseWriter, r *http.Request) (proto.Message, error)
 
+// Handler 参见 httpframe.Serve,响应按照请求的 Accept、Accept-Encoding 选择编码以及压缩方式
 func Handler(httpWrapper Wrapper) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer ept.PanicHandle()
-		if pb, err := httpWrapper(w, r); err != nil {
-			ExRespHandler(w, err)
-		} else if pb != nil {
-			RespHandler(w, pb)
-		}
-	}
+	return httpframe.Serve(func(req *httpframe.Request) (proto.Message, error) {
+		return httpWrapper(req.Writer, req.Request)
+	})
 }
 
 // ExRespHandler 向客户端输出错误信息
 func ExRespHandler(w http.ResponseWriter, err error) {
-	w.Header().Add(HeadServerEx, "1")
-	var resp *ept.ErrorResponse
-	if eptErr, ok := err.(*ept.Error); ok {
-		log.Error("Code="+strconv.Itoa(int(eptErr.Code)), ", Info="+eptErr.Message)
-		resp = &ept.ErrorResponse{
-			Code: eptErr.Code,
-			Info: eptErr.Message,
-		}
-	} else {
-		log.Errorf("unknown error: %v", err)
-		resp = &ept.ErrorResponse{
-			Code: 1,
-			Info: err.Error(),
-		}
-	}
-	data, _ := proto.Marshal(resp)
-	_, _ = w.Write(data)
+	httpframe.ExRespHandler(w, err)
 }
 
-// ReqHandle 组合处理
+// ReqHandle 组合处理,请求按照 Content-Type 选择编码
 func ReqHandle(w *http.ResponseWriter, r *http.Request, commonCache *CommonCache, pb proto.Message) error {
 	postData, err := ReqHeadHandle(r, commonCache)
 	if err != nil {
 		return err
 	}
-	err = proto.Unmarshal(postData, pb)
+	err = httpframe.RequestCodec(r).Unmarshal(postData, pb)
 	if err != nil {
 		aErr := &ept.Error{
 			Code:    immut.CodeExProtobufUn,
@@ -67,18 +47,5 @@ func ReqHandle(w *http.ResponseWriter, r *http.Request, commonCache *CommonCache
 }
 
 func RespHandler(w http.ResponseWriter, pb proto.Message) {
-	if log.IsDebug() {
-		log.Debugf("Resp = %s", pb)
-	}
-
-	result, err := proto.Marshal(pb)
-	if err != nil {
-		aErr := &ept.Error{
-			Code:    immut.CodeExProtobufMa,
-			Message: "Protobuf Ma Failed!!!",
-		}
-		ExRespHandler(w, aErr)
-		return
-	}
-	w.Write(result)
+	httpframe.RespHandler(w, pb)
 }
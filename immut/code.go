@@ -1,13 +1,15 @@
 package immut
 
 const (
-	CodeExHttpMethod uint32 = 1000 //http请求方法错误
-	CodeExVersion    uint32 = 1001 //版本号错误
-	CodeExNonce      uint32 = 1002 //nonce错误
-	CodeExTs         uint32 = 1003 //时间戳格式错误
-	CodeExSignature  uint32 = 1004 //签名错误
-	CodeExRepeatReq  uint32 = 1005 //随机数重复
-	CodeExAppKey     uint32 = 1008 //appkey错误
+	CodeExHttpMethod   uint32 = 1000 //http请求方法错误
+	CodeExVersion      uint32 = 1001 //版本号错误
+	CodeExNonce        uint32 = 1002 //nonce错误
+	CodeExTs           uint32 = 1003 //时间戳格式错误
+	CodeExSignature    uint32 = 1004 //签名错误
+	CodeExRepeatReq    uint32 = 1005 //随机数重复
+	CodeExAppKey       uint32 = 1008 //appkey错误
+	CodeExBodyTooLarge uint32 = 1009 //请求体超过大小限制
+	CodeExRateLimit    uint32 = 1010 //超过appkey的请求频率限制
 
 	CodeExProtobufUn uint32 = 1006 //请求参数
 	CodeExProtobufMa uint32 = 1007 //请求参数
@@ -15,6 +17,8 @@ const (
 	CodeExDdbMa uint32 = 1100 //Ddb序列化错误
 	CodeExDdbUn uint32 = 1101 //Ddb反序列化错误
 
+	CodeExInternal uint32 = 1102 //服务内部错误,例如处理请求时发生panic
+
 	// 业务错误 2000-2999 用户系统
 	// 业务错误 3000-3999 存档系统
 	// 业务错误 4000-4999 排行榜系统
@@ -0,0 +1,131 @@
+package log
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger 附带固定字段的日志,例如在一次请求的所有日志中输出 request_id
+// nil 表示不附带字段,与包级的方法一致
+type Logger struct {
+	fields []any //键值对
+}
+
+// With 创建附带字段的日志,keysAndValues 为键值对
+func With(keysAndValues ...any) *Logger {
+	return (*Logger)(nil).With(keysAndValues...)
+}
+
+// With 在原有字段的基础上追加字段,不修改原来的日志
+func (l *Logger) With(keysAndValues ...any) *Logger {
+	var fields []any
+	if l != nil {
+		fields = append(fields, l.fields...)
+	}
+	return &Logger{fields: append(fields, keysAndValues...)}
+}
+
+// sugar 附带字段的 zap.SugaredLogger
+func (l *Logger) sugar(logger *zap.Logger) *zap.SugaredLogger {
+	if l == nil || len(l.fields) == 0 {
+		return logger.Sugar()
+	}
+	return logger.Sugar().With(l.fields...)
+}
+
+// Debug 输出日志
+func (l *Logger) Debug(msg ...interface{}) {
+	if !atom.Enabled(zapcore.DebugLevel) {
+		return
+	}
+	l.sugar(debugLog).Debug(fmt.Sprint(msg...))
+}
+
+// Debugf 按照格式输出日志
+func (l *Logger) Debugf(format string, msg ...interface{}) {
+	if !atom.Enabled(zapcore.DebugLevel) {
+		return
+	}
+	l.sugar(debugLog).Debugf(format, msg...)
+}
+
+// Info 输出日志
+func (l *Logger) Info(msg ...interface{}) {
+	if !atom.Enabled(zapcore.InfoLevel) {
+		return
+	}
+	l.sugar(infoLog).Info(fmt.Sprint(msg...))
+}
+
+// Infof 按照格式输出日志
+func (l *Logger) Infof(format string, msg ...interface{}) {
+	if !atom.Enabled(zapcore.InfoLevel) {
+		return
+	}
+	l.sugar(infoLog).Infof(format, msg...)
+}
+
+// Infow 输出结构化的日志,keysAndValues 为键值对
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	if !atom.Enabled(zapcore.InfoLevel) {
+		return
+	}
+	l.sugar(infoLog).Infow(msg, keysAndValues...)
+}
+
+// Warn 输出日志
+func (l *Logger) Warn(msg ...interface{}) {
+	if !atom.Enabled(zapcore.WarnLevel) {
+		return
+	}
+	l.sugar(warnLog).Warn(fmt.Sprint(msg...))
+}
+
+// Warnf 按照格式输出日志
+func (l *Logger) Warnf(format string, msg ...interface{}) {
+	if !atom.Enabled(zapcore.WarnLevel) {
+		return
+	}
+	l.sugar(warnLog).Warnf(format, msg...)
+}
+
+// Warnw 输出结构化的日志,keysAndValues 为键值对
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	if !atom.Enabled(zapcore.WarnLevel) {
+		return
+	}
+	l.sugar(warnLog).Warnw(msg, keysAndValues...)
+}
+
+// Error 输出日志
+func (l *Logger) Error(msg ...interface{}) {
+	if !atom.Enabled(zapcore.ErrorLevel) {
+		return
+	}
+	l.sugar(errorLog).Error(fmt.Sprint(msg...))
+}
+
+// Errorf 按照格式输出日志
+func (l *Logger) Errorf(format string, msg ...interface{}) {
+	if !atom.Enabled(zapcore.ErrorLevel) {
+		return
+	}
+	l.sugar(errorLog).Errorf(format, msg...)
+}
+
+// ctxKey 上下文中日志的key
+type ctxKey struct{}
+
+// NewContext 将日志放入上下文
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext 获取上下文中的日志,不存在时返回nil,可以直接使用
+func FromContext(ctx context.Context) *Logger {
+	l, _ := ctx.Value(ctxKey{}).(*Logger)
+	return l
+}
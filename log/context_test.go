@@ -0,0 +1,32 @@
+package log
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggerWithContext(t *testing.T) {
+	setupTestConfig(t)
+	SetLevel(LevelDebug)
+
+	ctx := NewContext(context.Background(), With("request_id", "abc"))
+	logger := FromContext(ctx).With("appkey", "app")
+	logger.Infow("access", "status", 200)
+	logger.Errorf("failed %d", 1)
+	FromContext(context.Background()).Info("no fields")
+
+	dir := filepath.Dir(testConfigFile)
+	info, _ := os.ReadFile(filepath.Join(dir, "info.log"))
+	if !strings.Contains(string(info), `"request_id": "abc", "appkey": "app", "status": 200`) ||
+		!strings.Contains(string(info), "no fields") {
+		t.Fatalf("unexpected info log %s", info)
+	}
+	errLog, _ := os.ReadFile(filepath.Join(dir, "error.log"))
+	if !strings.Contains(string(errLog), "failed 1") || !strings.Contains(string(errLog), `"request_id": "abc"`) ||
+		!strings.Contains(string(errLog), "context_test.go") {
+		t.Fatalf("unexpected error log %s", errLog)
+	}
+}
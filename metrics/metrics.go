@@ -0,0 +1,471 @@
+// Package metrics 轻量的指标统计,支持计数器、仪表盘以及直方图,按照Prometheus的文本格式输出
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 指标的类型
+const (
+	KindCounter   = "counter"
+	KindGauge     = "gauge"
+	KindHistogram = "histogram"
+)
+
+// ContentType Prometheus文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets 默认的直方图区间,适用于以秒为单位的耗时
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets 适用于以字节为单位的大小的直方图区间
+var SizeBuckets = []float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// Default 默认的注册表
+var Default = NewRegistry()
+
+// Label 标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample Collector 采集的一个数据
+type Sample struct {
+	Name   string  //指标名称
+	Help   string  //说明,同名的指标只输出第一个
+	Kind   string  //KindCounter 或者 KindGauge
+	Labels []Label //标签
+	Value  float64 //值
+}
+
+// Collector 在输出时采集数据,例如连接池的统计信息
+type Collector interface {
+	Collect(emit func(s Sample))
+}
+
+// CollectorFunc 使用函数实现 Collector
+type CollectorFunc func(emit func(s Sample))
+
+// Collect 采集数据
+func (f CollectorFunc) Collect(emit func(s Sample)) {
+	f(emit)
+}
+
+// family 注册表中的一个指标
+type family interface {
+	kind() string
+	labelNames() []string
+	write(w *bufio.Writer)
+}
+
+// Registry 指标的注册表,可以被多个goroutine共用
+type Registry struct {
+	mutex      sync.RWMutex
+	families   map[string]family
+	collectors map[string]Collector
+}
+
+// NewRegistry 创建注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		families:   make(map[string]family),
+		collectors: make(map[string]Collector),
+	}
+}
+
+// register 注册指标,同名同类型并且标签相同时返回已经注册的指标,否则panic
+func (r *Registry) register(name string, f family) family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if old, ok := r.families[name]; ok {
+		if old.kind() != f.kind() || strings.Join(old.labelNames(), ",") != strings.Join(f.labelNames(), ",") {
+			panic("metrics: " + name + " already registered with different type or labels")
+		}
+		return old
+	}
+	r.families[name] = f
+	return f
+}
+
+// NewCounter 注册计数器,已经注册时返回原有的计数器
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newVec(name, help, labels, func() *value { return &value{} })}
+	return r.register(name, c).(*Counter)
+}
+
+// NewGauge 注册仪表盘,已经注册时返回原有的仪表盘
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(name, help, labels, func() *value { return &value{} })}
+	return r.register(name, g).(*Gauge)
+}
+
+// NewHistogram 注册直方图,buckets 为递增的区间上限,为nil时使用 DefaultBuckets,已经注册时返回原有的直方图
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{newVec(name, help, labels, func() *histogramValue {
+		return &histogramValue{counts: make([]atomic.Uint64, len(buckets))}
+	}), buckets}
+	return r.register(name, h).(*Histogram)
+}
+
+// Register 注册采集器,key 相同时替换原有的采集器
+func (r *Registry) Register(key string, c Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors[key] = c
+}
+
+// Unregister 删除采集器,例如连接池关闭之后
+func (r *Registry) Unregister(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.collectors, key)
+}
+
+// WriteTo 按照Prometheus的文本格式输出全部指标,指标按照名称排序
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.RLock()
+	families := make(map[string]family, len(r.families))
+	for name, f := range r.families {
+		families[name] = f
+	}
+	keys := make([]string, 0, len(r.collectors))
+	for key := range r.collectors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	collectors := make([]Collector, len(keys))
+	for i, key := range keys {
+		collectors[i] = r.collectors[key]
+	}
+	r.mutex.RUnlock()
+
+	//采集器的数据按照名称分组
+	samples := make(map[string][]Sample)
+	for _, c := range collectors {
+		c.Collect(func(s Sample) {
+			if _, ok := families[s.Name]; !ok {
+				samples[s.Name] = append(samples[s.Name], s)
+			}
+		})
+	}
+	names := make([]string, 0, len(families)+len(samples))
+	for name := range families {
+		names = append(names, name)
+	}
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		if f, ok := families[name]; ok {
+			f.write(bw)
+			continue
+		}
+		list := samples[name]
+		writeHeader(bw, name, list[0].Help, list[0].Kind)
+		for _, s := range list {
+			writeSample(bw, name, s.Labels, s.Value)
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler 输出注册表中全部指标的http处理
+func Handler(r *Registry) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = r.WriteTo(w)
+	}
+}
+
+// value 使用原子操作的浮点数
+type value struct {
+	bits atomic.Uint64
+}
+
+// add 增加 v
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// set 设置为 v
+func (v *value) set(f float64) {
+	v.bits.Store(math.Float64bits(f))
+}
+
+// get 获取当前值
+func (v *value) get() float64 {
+	return math.Float64frombits(v.bits.Load())
+}
+
+// vec 按照标签值区分的一组数据
+type vec[T any] struct {
+	name   string
+	help   string
+	labels []string
+	newT   func() *T
+
+	mutex  sync.RWMutex
+	series map[string]*series[T]
+}
+
+// series 一组标签值对应的数据
+type series[T any] struct {
+	values []string
+	data   *T
+}
+
+// newVec 创建一组数据
+func newVec[T any](name, help string, labels []string, newT func() *T) vec[T] {
+	return vec[T]{name: name, help: help, labels: labels, newT: newT, series: make(map[string]*series[T])}
+}
+
+// labelNames 标签名称
+func (v *vec[T]) labelNames() []string {
+	return v.labels
+}
+
+// get 获取标签值对应的数据,不存在时创建,标签值的数量与标签不一致时panic
+func (v *vec[T]) get(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic("metrics: " + v.name + " expects " + strconv.Itoa(len(v.labels)) + " label values")
+	}
+	key := strings.Join(values, "\xff")
+	v.mutex.RLock()
+	s, ok := v.series[key]
+	v.mutex.RUnlock()
+	if ok {
+		return s.data
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = &series[T]{values: append([]string(nil), values...), data: v.newT()}
+		v.series[key] = s
+	}
+	return s.data
+}
+
+// sorted 按照标签值排序的全部数据
+func (v *vec[T]) sorted() []*series[T] {
+	v.mutex.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]*series[T], len(keys))
+	for i, key := range keys {
+		list[i] = v.series[key]
+	}
+	v.mutex.RUnlock()
+	return list
+}
+
+// labelPairs 标签名称与值
+func (v *vec[T]) labelPairs(values []string) []Label {
+	labels := make([]Label, len(values))
+	for i, value := range values {
+		labels[i] = Label{Name: v.labels[i], Value: value}
+	}
+	return labels
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	vec[value]
+}
+
+func (c *Counter) kind() string {
+	return KindCounter
+}
+
+// Inc 加1,labelValues 与注册时的标签一一对应
+func (c *Counter) Inc(labelValues ...string) {
+	c.get(labelValues).add(1)
+}
+
+// Add 增加 delta,delta 不能小于0
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+	c.get(labelValues).add(delta)
+}
+
+// Value 获取当前值
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.get(labelValues).get()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, KindCounter)
+	for _, s := range c.sorted() {
+		writeSample(w, c.name, c.labelPairs(s.values), s.data.get())
+	}
+}
+
+// Gauge 可以任意变化的仪表盘
+type Gauge struct {
+	vec[value]
+}
+
+func (g *Gauge) kind() string {
+	return KindGauge
+}
+
+// Set 设置为 v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.get(labelValues).set(v)
+}
+
+// Add 增加 delta,可以小于0
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.get(labelValues).add(delta)
+}
+
+// Value 获取当前值
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.get(labelValues).get()
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, KindGauge)
+	for _, s := range g.sorted() {
+		writeSample(w, g.name, g.labelPairs(s.values), s.data.get())
+	}
+}
+
+// histogramValue 直方图的数据,counts 为每个区间内的次数,输出时累加
+type histogramValue struct {
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    value
+}
+
+// Histogram 统计数据的分布,例如耗时、大小
+type Histogram struct {
+	vec[histogramValue]
+	buckets []float64
+}
+
+func (h *Histogram) kind() string {
+	return KindHistogram
+}
+
+// Observe 记录一个数据
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	hv := h.get(labelValues)
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i].Add(1)
+	}
+	hv.count.Add(1)
+	hv.sum.add(v)
+}
+
+// Count 获取记录的次数以及总和
+func (h *Histogram) Count(labelValues ...string) (uint64, float64) {
+	hv := h.get(labelValues)
+	return hv.count.Load(), hv.sum.get()
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, KindHistogram)
+	for _, s := range h.sorted() {
+		labels := h.labelPairs(s.values)
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.data.counts[i].Load()
+			writeSample(w, h.name+"_bucket", append(labels, Label{"le", formatFloat(upper)}), float64(cumulative))
+		}
+		count := s.data.count.Load()
+		writeSample(w, h.name+"_bucket", append(labels, Label{"le", "+Inf"}), float64(count))
+		writeSample(w, h.name+"_sum", labels, s.data.sum.get())
+		writeSample(w, h.name+"_count", labels, float64(count))
+	}
+}
+
+// writeHeader 输出 HELP 与 TYPE
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	if help != "" {
+		w.WriteString("# HELP " + name + " " + escape(help, false) + "\n")
+	}
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// writeSample 输出一行数据
+func writeSample(w *bufio.Writer, name string, labels []Label, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.Name + `="` + escape(l.Value, true) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+// formatFloat 按照Prometheus的格式输出浮点数
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape 转义说明以及标签值中的特殊字符
+func escape(s string, quote bool) string {
+	if !strings.ContainsAny(s, "\\\n\"") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+// countWriter 记录写入的字节数
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
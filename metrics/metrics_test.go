@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("http_requests_total", "Total requests.", "path", "status")
+	g := r.NewGauge("queue_size", "Queue size.")
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "path")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Inc("/api", "200")
+		}()
+	}
+	wg.Wait()
+	c.Add(2, "/a\"b", "500")
+	g.Set(3)
+	g.Add(-1)
+	h.Observe(0.05, "/api")
+	h.Observe(0.5, "/api")
+	h.Observe(5, "/api")
+	RegisterPool(r, "redis", "main", func() PoolStats {
+		return PoolStats{MaxOpen: 10, Open: 3, Idle: 1, InUse: 2, WaitCount: 4, WaitDuration: 1500 * time.Millisecond,
+			Created: 5, Closed: 2, Timeouts: 1}
+	})
+
+	if c.Value("/api", "200") != 100 {
+		t.Fatalf("unexpected counter %v", c.Value("/api", "200"))
+	}
+	if r.NewCounter("http_requests_total", "", "path", "status") != c {
+		t.Fatal("expected the registered counter")
+	}
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"# HELP http_requests_total Total requests.\n# TYPE http_requests_total counter\n",
+		`http_requests_total{path="/a\"b",status="500"} 2`,
+		`http_requests_total{path="/api",status="200"} 100`,
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{path="/api",le="0.1"} 1`,
+		`latency_seconds_bucket{path="/api",le="1"} 2`,
+		`latency_seconds_bucket{path="/api",le="+Inf"} 3`,
+		`latency_seconds_sum{path="/api"} 5.55`,
+		`latency_seconds_count{path="/api"} 3`,
+		"queue_size 2\n",
+		"# TYPE redis_pool_open_connections gauge\nredis_pool_open_connections{pool=\"main\"} 3\n",
+		`redis_pool_wait_seconds_total{pool="main"} 1.5`,
+		`redis_pool_created_total{pool="main"} 5`,
+		`redis_pool_closed_total{pool="main"} 2`,
+		`redis_pool_timeouts_total{pool="main"} 1`,
+	}
+	out := b.String()
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Fatalf("missing %q in\n%s", e, out)
+		}
+	}
+	if strings.Index(out, "http_requests_total") > strings.Index(out, "queue_size") {
+		t.Fatalf("metrics not sorted\n%s", out)
+	}
+
+	UnregisterPool(r, "redis", "main")
+	w := httptest.NewRecorder()
+	Handler(r)(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Header().Get("Content-Type") != ContentType || strings.Contains(w.Body.String(), "redis_pool") {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+}
+
+func TestRegistryConflict(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("requests", "")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	r.NewGauge("requests", "")
+}
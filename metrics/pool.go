@@ -0,0 +1,46 @@
+package metrics
+
+import "time"
+
+// PoolStats 连接池的统计信息,不同的连接池统一使用该结构输出,连接池没有提供的统计为0
+type PoolStats struct {
+	MaxOpen      int           //最大连接数,0表示不限制
+	Open         int           //已经打开的连接数,包括空闲以及在用的连接
+	Idle         int           //空闲的连接数
+	InUse        int           //在用的连接数
+	WaitCount    int64         //等待连接的总次数
+	WaitDuration time.Duration //等待连接的总时长
+	Created      int64         //创建的连接总数
+	Closed       int64         //关闭的连接总数
+	Timeouts     int64         //等待连接超时或者取消的次数
+}
+
+// RegisterPool 注册连接池的统计信息,system 为组件的名称,例如 redis、mysql,name 用于区分同一种组件的多个连接池
+// 输出的指标为 <system>_pool_open_connections{pool="name"} 等,同一个 system 与 name 重复注册时替换原有的注册
+func RegisterPool(r *Registry, system, name string, stats func() PoolStats) {
+	prefix := system + "_pool_"
+	r.Register(prefix+name, CollectorFunc(func(emit func(s Sample)) {
+		st := stats()
+		labels := []Label{{Name: "pool", Value: name}}
+		gauge := func(metric, help string, v float64) {
+			emit(Sample{Name: prefix + metric, Help: help, Kind: KindGauge, Labels: labels, Value: v})
+		}
+		counter := func(metric, help string, v float64) {
+			emit(Sample{Name: prefix + metric, Help: help, Kind: KindCounter, Labels: labels, Value: v})
+		}
+		gauge("max_open_connections", "Maximum number of open connections.", float64(st.MaxOpen))
+		gauge("open_connections", "Number of open connections.", float64(st.Open))
+		gauge("idle_connections", "Number of idle connections.", float64(st.Idle))
+		gauge("in_use_connections", "Number of connections in use.", float64(st.InUse))
+		counter("wait_total", "Total number of waits for a connection.", float64(st.WaitCount))
+		counter("wait_seconds_total", "Total time waited for a connection.", st.WaitDuration.Seconds())
+		counter("created_total", "Total number of connections created.", float64(st.Created))
+		counter("closed_total", "Total number of connections closed.", float64(st.Closed))
+		counter("timeouts_total", "Total number of timed out or canceled waits for a connection.", float64(st.Timeouts))
+	}))
+}
+
+// UnregisterPool 删除连接池的统计信息,例如连接池关闭之后
+func UnregisterPool(r *Registry, system, name string) {
+	r.Unregister(system + "_pool_" + name)
+}
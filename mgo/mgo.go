@@ -2,11 +2,14 @@ package mgo
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/metrics"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -14,18 +17,72 @@ import (
 
 type MongoDBClient struct {
 	*mongo.Client
-	dbName *string
+	dbName  *string
+	maxSize int
+	pool    *poolCounter
+}
+
+// poolCounter 通过连接池的事件统计连接数
+type poolCounter struct {
+	maxSize      int64
+	open         atomic.Int64
+	inUse        atomic.Int64
+	blocked      atomic.Int64 //开始获取时连接已经用完,还没有结束的获取
+	waitCount    atomic.Int64
+	waitDuration atomic.Int64
+}
+
+// monitor 连接池的事件处理
+// 驱动的事件没有标记获取连接是否发生了等待,开始获取时在用的连接数已经达到上限的才记为等待
+func (c *poolCounter) monitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: func(e *event.PoolEvent) {
+		switch e.Type {
+		case event.ConnectionCreated:
+			c.open.Add(1)
+		case event.ConnectionClosed:
+			c.open.Add(-1)
+		case event.GetStarted:
+			if c.maxSize > 0 && c.inUse.Load() >= c.maxSize {
+				c.blocked.Add(1)
+			}
+		case event.GetSucceeded:
+			c.inUse.Add(1)
+			if c.takeBlocked() {
+				c.waitCount.Add(1)
+				c.waitDuration.Add(int64(e.Duration))
+			}
+		case event.GetFailed:
+			c.takeBlocked()
+		case event.ConnectionReturned:
+			c.inUse.Add(-1)
+		}
+	}}
+}
+
+// takeBlocked 结束一次等待中的获取,没有等待中的获取时返回false
+func (c *poolCounter) takeBlocked() bool {
+	for {
+		n := c.blocked.Load()
+		if n <= 0 {
+			return false
+		}
+		if c.blocked.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
 }
 
 // NewMongoClient 创建一个mongodb客户端
 func NewMongoClient(address string, timeout, maxsize, idletime int) (*MongoDBClient, error) {
 	clientOptions := options.Client()
+	pool := &poolCounter{maxSize: int64(maxsize)}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	client, err := mongo.Connect(ctx, clientOptions.ApplyURI(address),
 		clientOptions.SetConnectTimeout(time.Duration(timeout)*time.Second),
 		clientOptions.SetMaxPoolSize(uint64(maxsize)),
-		clientOptions.SetMaxConnIdleTime(time.Duration(idletime)*time.Second))
+		clientOptions.SetMaxConnIdleTime(time.Duration(idletime)*time.Second),
+		clientOptions.SetPoolMonitor(pool.monitor()))
 
 	if err != nil {
 		return nil, err
@@ -44,12 +101,35 @@ func NewMongoClient(address string, timeout, maxsize, idletime int) (*MongoDBCli
 	dbName := "yifants"
 
 	mongoClient := &MongoDBClient{
-		client,
-		&dbName,
+		Client:  client,
+		dbName:  &dbName,
+		maxSize: maxsize,
+		pool:    pool,
 	}
 	return mongoClient, nil
 }
 
+// HealthCheck 检测主节点是否可用,可以注册到 server.Health
+func (c *MongoDBClient) HealthCheck(ctx context.Context) error {
+	return c.Ping(ctx, readpref.Primary())
+}
+
+// RegisterMetrics 将连接池的统计信息注册到 reg,name 用于区分多个客户端
+// 等待的次数以及时长只统计开始获取时连接已经用完的获取
+func (c *MongoDBClient) RegisterMetrics(reg *metrics.Registry, name string) {
+	metrics.RegisterPool(reg, "mongo", name, func() metrics.PoolStats {
+		open, inUse := int(c.pool.open.Load()), int(c.pool.inUse.Load())
+		return metrics.PoolStats{
+			MaxOpen:      c.maxSize,
+			Open:         open,
+			Idle:         max(open-inUse, 0),
+			InUse:        inUse,
+			WaitCount:    c.pool.waitCount.Load(),
+			WaitDuration: time.Duration(c.pool.waitDuration.Load()),
+		}
+	})
+}
+
 // SetDatabaseName 提供一个修改数据库名称的接口
 func (c *MongoDBClient) SetDatabaseName(dbName *string) {
 	c.dbName = dbName
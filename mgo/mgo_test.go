@@ -7,6 +7,7 @@ import (
 
 	"github.com/yeahyf/go_base/log"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -289,3 +290,18 @@ func TestUpdate(t *testing.T) {
 		fmt.Println(match, up)
 	}
 }
+
+func TestPoolCounterWait(t *testing.T) {
+	c := &poolCounter{maxSize: 1}
+	m := c.monitor()
+	m.Event(&event.PoolEvent{Type: event.ConnectionCreated})
+	m.Event(&event.PoolEvent{Type: event.GetStarted})
+	m.Event(&event.PoolEvent{Type: event.GetSucceeded, Duration: time.Millisecond})
+	//连接已经用完,第二次获取需要等待
+	m.Event(&event.PoolEvent{Type: event.GetStarted})
+	m.Event(&event.PoolEvent{Type: event.ConnectionReturned})
+	m.Event(&event.PoolEvent{Type: event.GetSucceeded, Duration: time.Second})
+	if c.waitCount.Load() != 1 || time.Duration(c.waitDuration.Load()) != time.Second || c.inUse.Load() != 1 {
+		t.Fatalf("unexpected wait %d %d", c.waitCount.Load(), c.waitDuration.Load())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/yeahyf/go_base/metrics"
 )
 
 var (
@@ -55,6 +56,28 @@ func NewClient(cfg *Config) *RedisClient {
 	}
 }
 
+// HealthCheck 使用PING检测Redis是否可用,可以注册到 server.Health
+func (r *RedisClient) HealthCheck(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// RegisterMetrics 将连接池的统计信息注册到 reg,name 用于区分多个客户端
+// 指标的前缀为 ncache_pool_,与 cache 包的连接池区分
+func (r *RedisClient) RegisterMetrics(reg *metrics.Registry, name string) {
+	metrics.RegisterPool(reg, "ncache", name, func() metrics.PoolStats {
+		st := r.client.PoolStats()
+		return metrics.PoolStats{
+			MaxOpen:      r.client.Options().PoolSize,
+			Open:         int(st.TotalConns),
+			Idle:         int(st.IdleConns),
+			InUse:        int(st.TotalConns) - int(st.IdleConns),
+			WaitCount:    int64(st.WaitCount),
+			WaitDuration: time.Duration(st.WaitDurationNs),
+			Timeouts:     int64(st.Timeouts),
+		}
+	})
+}
+
 // NewRedisClientByDB 构建新的Redis连接
 func NewRedisClientByDB(init, maxsize, idle int, address, password string, dbIndex int) *RedisClient {
 	cfg := &Config{
@@ -1,10 +1,12 @@
 package rds
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/yeahyf/go_base/metrics"
 	"github.com/yeahyf/go_base/utils"
 )
 
@@ -55,6 +57,27 @@ func NewSQLClient(address string, opts ...Option) *MySQLClient {
 	return &MySQLClient{db}
 }
 
+// HealthCheck 检测数据库是否可用,可以注册到 server.Health
+func (client *MySQLClient) HealthCheck(ctx context.Context) error {
+	return client.PingContext(ctx)
+}
+
+// RegisterMetrics 将连接池的统计信息注册到 reg,name 用于区分多个数据库
+func (client *MySQLClient) RegisterMetrics(reg *metrics.Registry, name string) {
+	metrics.RegisterPool(reg, "mysql", name, func() metrics.PoolStats {
+		st := client.Stats()
+		return metrics.PoolStats{
+			MaxOpen:      st.MaxOpenConnections,
+			Open:         st.OpenConnections,
+			Idle:         st.Idle,
+			InUse:        st.InUse,
+			WaitCount:    st.WaitCount,
+			WaitDuration: st.WaitDuration,
+			Closed:       st.MaxIdleClosed + st.MaxIdleTimeClosed + st.MaxLifetimeClosed,
+		}
+	})
+}
+
 // CloseMySQL 关闭数据库
 func (client *MySQLClient) CloseMySQL() {
 	if client != nil {
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yeahyf/go_base/system"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+
+	DefaultCheckTimeout = 2 * time.Second //检查没有指定超时时间时使用
+)
+
+// HealthCheckTimeoutErr 检查在超时时间内没有返回
+var HealthCheckTimeoutErr = errors.New("health check timeout")
+
+// HealthCheck 组件的健康检查,返回nil表示可用,需要在 ctx 结束时尽快返回
+type HealthCheck func(ctx context.Context) error
+
+// CheckResult 单个检查的结果
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthStatus 汇总的检查结果,作为 /healthz 以及 /readyz 的响应
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type healthEntry struct {
+	timeout time.Duration
+	check   HealthCheck
+}
+
+// Health 健康检查的注册表,各组件注册检查之后通过 /healthz 以及 /readyz 输出
+type Health struct {
+	mu       sync.RWMutex
+	checks   map[string]healthEntry
+	shutdown atomic.Bool
+}
+
+// DefaultHealth 默认的注册表
+var DefaultHealth = NewHealth()
+
+// NewHealth 创建健康检查的注册表
+func NewHealth() *Health {
+	return &Health{checks: make(map[string]healthEntry)}
+}
+
+// Register 注册名称为 name 的检查,相同的名称替换原有的检查,timeout <= 0 时使用 DefaultCheckTimeout
+func (h *Health) Register(name string, timeout time.Duration, check HealthCheck) {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	h.mu.Lock()
+	h.checks[name] = healthEntry{timeout: timeout, check: check}
+	h.mu.Unlock()
+}
+
+// Unregister 删除名称为 name 的检查
+func (h *Health) Unregister(name string) {
+	h.mu.Lock()
+	delete(h.checks, name)
+	h.mu.Unlock()
+}
+
+// Shutdown 标记服务开始关闭,之后 /readyz 返回503,负载均衡不再转发新的请求
+func (h *Health) Shutdown() {
+	h.shutdown.Store(true)
+}
+
+// ShuttingDown 服务是否已经开始关闭
+func (h *Health) ShuttingDown() bool {
+	return h.shutdown.Load()
+}
+
+// Check 并发执行所有的检查,每个检查使用各自的超时时间
+func (h *Health) Check(ctx context.Context) HealthStatus {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]healthEntry, len(names))
+	for i, name := range names {
+		entries[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, e)
+		}()
+	}
+	wg.Wait()
+
+	status := HealthStatus{Status: StatusOK, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		if results[i].Status != StatusOK {
+			status.Status = StatusFail
+		}
+		status.Checks[name] = results[i]
+	}
+	return status
+}
+
+// runCheck 执行单个检查,检查没有响应 ctx 时在超时后直接返回
+func runCheck(ctx context.Context, e healthEntry) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- e.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = HealthCheckTimeoutErr
+	}
+	result := CheckResult{Status: StatusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// LivezHandler 存活检查,进程能够处理请求即返回200,不执行注册的检查
+func (h *Health) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, HealthStatus{Status: StatusOK})
+}
+
+// HealthzHandler 执行所有的检查,全部通过时返回200,否则返回503
+func (h *Health) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, h.Check(r.Context()))
+}
+
+// ReadyzHandler 就绪检查,服务开始关闭之后直接返回503,否则与 HealthzHandler 相同
+func (h *Health) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if h.ShuttingDown() {
+		writeHealth(w, HealthStatus{Status: StatusShuttingDown})
+		return
+	}
+	writeHealth(w, h.Check(r.Context()))
+}
+
+func writeHealth(w http.ResponseWriter, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if status.Status == StatusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// DiskCheck 检查 path 所在磁盘的使用比例,超过 maxUsedRatio (0~1) 时失败
+func DiskCheck(path string, maxUsedRatio float64) HealthCheck {
+	return func(ctx context.Context) error {
+		disk := system.DiskUsage(path)
+		if disk.All == 0 {
+			return fmt.Errorf("unable to stat disk of %s", path)
+		}
+		ratio := float64(disk.Used) / float64(disk.All)
+		if ratio > maxUsedRatio {
+			return fmt.Errorf("disk usage of %s is %.1f%%, exceeds %.1f%%", path, ratio*100, maxUsedRatio*100)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	h := NewHealth()
+	mux := http.NewServeMux()
+	s := &GracefulServer{mux: mux}
+	WithHealth(h)(s)
+
+	get := func(path string) (int, HealthStatus) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var status HealthStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, status
+	}
+
+	h.Register("redis", 0, func(ctx context.Context) error { return nil })
+	h.Register("disk", 0, DiskCheck(t.TempDir(), 1))
+	if code, status := get("/healthz"); code != http.StatusOK || status.Status != StatusOK || len(status.Checks) != 2 {
+		t.Fatalf("unexpected healthz %d %+v", code, status)
+	}
+
+	h.Register("mysql", 0, func(ctx context.Context) error { return errors.New("connection refused") })
+	h.Register("hbase", 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	code, status := get("/readyz")
+	if code != http.StatusServiceUnavailable || status.Status != StatusFail ||
+		status.Checks["mysql"].Error != "connection refused" ||
+		status.Checks["hbase"].Error != HealthCheckTimeoutErr.Error() ||
+		status.Checks["redis"].Status != StatusOK {
+		t.Fatalf("unexpected readyz %d %+v", code, status)
+	}
+
+	h.Unregister("mysql")
+	h.Unregister("hbase")
+	h.Shutdown()
+	if code, status := get("/readyz"); code != http.StatusServiceUnavailable || status.Status != StatusShuttingDown {
+		t.Fatalf("unexpected readyz after shutdown %d %+v", code, status)
+	}
+	if code, _ := get("/livez"); code != http.StatusOK {
+		t.Fatalf("unexpected livez %d", code)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("unexpected healthz after shutdown %d", code)
+	}
+}
@@ -10,14 +10,52 @@ import (
 	"time"
 
 	"github.com/yeahyf/go_base/log"
+	"github.com/yeahyf/go_base/metrics"
 )
 
 // GracefulServer 定义Server
 type GracefulServer struct {
 	Server           *http.Server
+	mux              *http.ServeMux
+	health           *Health       //关闭时标记为未就绪
+	drainDelay       time.Duration //标记为未就绪之后等待负载均衡摘除流量的时间
 	shutdownFinished chan struct{}
 }
 
+// Option 服务的配置项
+type Option func(s *GracefulServer)
+
+// WithMetrics 在 path 上按照Prometheus的文本格式输出 reg 中的指标,reg 为nil时使用 metrics.Default
+func WithMetrics(path string, reg *metrics.Registry) Option {
+	return func(s *GracefulServer) {
+		if reg == nil {
+			reg = metrics.Default
+		}
+		s.mux.HandleFunc(path, metrics.Handler(reg))
+	}
+}
+
+// WithHealth 在 mux 上注册 /livez、/healthz 以及 /readyz,h 为nil时使用 DefaultHealth
+// 收到退出信号之后 /readyz 立即返回503
+func WithHealth(h *Health) Option {
+	return func(s *GracefulServer) {
+		if h == nil {
+			h = DefaultHealth
+		}
+		s.health = h
+		s.mux.HandleFunc("/livez", h.LivezHandler)
+		s.mux.HandleFunc("/healthz", h.HealthzHandler)
+		s.mux.HandleFunc("/readyz", h.ReadyzHandler)
+	}
+}
+
+// WithDrainDelay 收到退出信号并标记为未就绪之后,等待 d 再关闭服务,使负载均衡有时间摘除流量
+func WithDrainDelay(d time.Duration) Option {
+	return func(s *GracefulServer) {
+		s.drainDelay = d
+	}
+}
+
 // ListenAndServe 启动服务
 func (s *GracefulServer) listenAndServe() (err error) {
 	if s.shutdownFinished == nil {
@@ -43,6 +81,14 @@ func (s *GracefulServer) waitForExitingSignal(timeout time.Duration) {
 
 	<-waiter
 
+	if s.health != nil {
+		s.health.Shutdown()
+	}
+	if s.drainDelay > 0 {
+		log.Infof("draining for %s before shutdown", s.drainDelay)
+		time.Sleep(s.drainDelay)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	err := s.Server.Shutdown(ctx)
@@ -54,12 +100,17 @@ func (s *GracefulServer) waitForExitingSignal(timeout time.Duration) {
 	}
 }
 
-func StartServer(port int, mux *http.ServeMux) {
+// StartServer 启动服务并阻塞到收到退出的信号,opts 可以在 mux 上注册指标、健康检查等附加的接口
+func StartServer(port int, mux *http.ServeMux, opts ...Option) {
 	server := &GracefulServer{
 		Server: &http.Server{
 			Addr:    fmt.Sprintf(":%d", port),
 			Handler: mux,
 		},
+		mux: mux,
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
 	//异步监听退出信号
 	go server.waitForExitingSignal(10 * time.Second)